@@ -35,7 +35,8 @@ type ClusterwideNetworkPolicy struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec PolicySpec `json:"spec,omitempty"`
+	Spec   PolicySpec   `json:"spec,omitempty"`
+	Status PolicyStatus `json:"status,omitempty"`
 }
 
 // ClusterwideNetworkPolicyList contains a list of ClusterwideNetworkPolicy
@@ -71,6 +72,36 @@ type PolicySpec struct {
 	// Clusters are isolated by default.
 	// +optional
 	Egress []EgressRule `json:"egress,omitempty"`
+
+	// IPS sends the connections allowed by this policy to suricata for inline inspection,
+	// they are dropped if a drop rule of suricata matches. It requires the IDS to be enabled.
+	// +optional
+	IPS bool `json:"ips,omitempty"`
+}
+
+// PolicyStatus contains the traffic statistics of the rules of a ClusterwideNetworkPolicy
+type PolicyStatus struct {
+	// Statistics of the ingress rules in the order of the spec
+	// +optional
+	Ingress []PolicyRuleStatus `json:"ingress,omitempty"`
+
+	// Statistics of the egress rules in the order of the spec
+	// +optional
+	Egress []PolicyRuleStatus `json:"egress,omitempty"`
+
+	// Updated is the time the statistics last changed
+	// +optional
+	Updated metav1.Time `json:"lastRun,omitempty"`
+}
+
+// PolicyRuleStatus contains the statistics of the nftables rules generated for a single ingress or egress rule
+type PolicyRuleStatus struct {
+	// Counter sums up the counters of all nftables rules generated for this rule
+	Counter Counter `json:"counter"`
+
+	// LastHit is the time the rule was last seen to match traffic
+	// +optional
+	LastHit *metav1.Time `json:"lastHit,omitempty"`
 }
 
 // IngressRule describes a particular set of traffic that is allowed to the cluster.
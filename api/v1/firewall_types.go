@@ -79,13 +79,365 @@ type Data struct {
 	EgressRules []EgressRuleSNAT `json:"egressRules,omitempty"`
 	// FirewallNetworks holds the networks known at the metal-api for this firewall machine
 	FirewallNetworks []FirewallNetwork `json:"firewallNetworks,omitempty"`
+	// FlowExport configures the export of flow records of finished connections, no flows are exported if it is not set
+	// +optional
+	FlowExport *FlowExport `json:"flowExport,omitempty"`
+	// IDS configures the ruleset of the IDS, the rules baked into the firewall image are used if it is not set
+	// +optional
+	IDS *IDSRuleset `json:"ids,omitempty"`
+	// AutoBlock configures the automatic blocking of the sources of IDS alerts, no source is blocked if it is not set
+	// +optional
+	AutoBlock *AutoBlock `json:"autoBlock,omitempty"`
+	// RoutingPolicies configure the route filtering of the external networks in FRR, all routes are exchanged with a network without policy
+	// +optional
+	RoutingPolicies []RoutingPolicy `json:"routingPolicies,omitempty"`
 }
 
+// RoutingPolicy configures which routes are exchanged between the private network of the firewall and an external network
+type RoutingPolicy struct {
+	// NetworkID is the id of the external firewall network the policy applies to
+	NetworkID string `json:"networkid"`
+	// Accept are the prefixes accepted from the external network, all prefixes are accepted if it is empty
+	// +optional
+	Accept []PrefixFilter `json:"accept,omitempty"`
+	// Announce are the prefixes announced to the external network, all prefixes are announced if it is empty
+	// +optional
+	Announce []PrefixFilter `json:"announce,omitempty"`
+	// LocalPreference is set on the routes accepted from the external network to prefer or avoid it
+	// +optional
+	LocalPreference *uint32 `json:"localPreference,omitempty"`
+	// Communities are added to the routes announced to the external network, e.g. 65000:100 or no-export
+	// +optional
+	Communities []string `json:"communities,omitempty"`
+}
+
+// PrefixFilter matches a prefix and optionally its more specific prefixes
+type PrefixFilter struct {
+	// Prefix in CIDR notation, e.g. 10.0.0.0/8
+	Prefix string `json:"prefix"`
+	// GE matches the more specific prefixes of at least this length instead of the prefix itself
+	// +kubebuilder:validation:Maximum=32
+	// +optional
+	GE *uint8 `json:"ge,omitempty"`
+	// LE matches the more specific prefixes of at most this length instead of the prefix itself
+	// +kubebuilder:validation:Maximum=32
+	// +optional
+	LE *uint8 `json:"le,omitempty"`
+}
+
+// AutoBlock configures the automatic blocking of the sources of IDS alerts
+type AutoBlock struct {
+	// Severity is the lowest severity of an alert which blocks its source, 1 is the highest severity of suricata, defaults to 2
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Severity int `json:"severity,omitempty"`
+	// Timeout is the duration a source is blocked after its last alert, defaults to 1h
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+	// AllowList contains the networks which are never blocked,
+	// the internal prefixes and the prefixes of the private and underlay networks are never blocked as well
+	// +optional
+	AllowList []string `json:"allowList,omitempty"`
+}
+
+// IDSRuleset configures the ruleset of suricata, the rule sources are managed with suricata-update
+type IDSRuleset struct {
+	// Sources are the enabled rule sources of suricata-update, e.g. et/open
+	// +optional
+	Sources []string `json:"sources,omitempty"`
+	// DisabledSIDs are the signature ids of rules which are disabled
+	// +optional
+	DisabledSIDs []int64 `json:"disabledSIDs,omitempty"`
+	// Rules are custom local rules
+	// +optional
+	Rules []string `json:"rules,omitempty"`
+	// ConfigMaps are ConfigMaps in the namespace of the firewall which extend the ruleset,
+	// the keys sources, disabledSIDs and rules contain one entry per line
+	// +optional
+	ConfigMaps []string `json:"configMaps,omitempty"`
+}
+
+// FlowExport configures the export of flow records to a flow collector
+type FlowExport struct {
+	// Collector is the address of the flow collector, e.g. 10.1.2.3:4739
+	Collector string `json:"collector"`
+	// Protocol of the export, either ipfix or netflow9, defaults to ipfix
+	// +kubebuilder:validation:Enum=ipfix;netflow9
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+}
+
+const (
+	// FlowExportIPFIX exports the flows with IPFIX
+	FlowExportIPFIX = "ipfix"
+	// FlowExportNetFlow9 exports the flows with NetFlow v9
+	FlowExportNetFlow9 = "netflow9"
+)
+
 // FirewallStatus defines the observed state of Firewall
 type FirewallStatus struct {
-	Message       string        `json:"message,omitempty"`
-	FirewallStats FirewallStats `json:"stats"`
-	Updated       metav1.Time   `json:"lastRun,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Summary summarizes the runtime data, the details are in the FirewallMonitor of the same name
+	// +optional
+	Summary FirewallSummary `json:"summary,omitempty"`
+	// FirewallStats contains the rule, device and IDS statistics of the status before the FirewallMonitor was introduced.
+	//
+	// Deprecated: the statistics are in the FirewallMonitor of the same name, the field will be removed with the next release.
+	// +optional
+	FirewallStats *FirewallStats `json:"stats,omitempty"`
+	// BGP counts the BGP sessions of FRR, the sessions are in the FirewallMonitor
+	// +optional
+	BGP *BGPStatus `json:"bgp,omitempty"`
+	// IDS contains the state of the suricata engine, it is only set if the IDS is enabled
+	// +optional
+	IDS *IDSStatus `json:"ids,omitempty"`
+	// IDSRules contains the state of the ruleset of the IDS, it is only set if the ruleset is configured
+	// +optional
+	IDSRules *IDSRulesStatus `json:"idsRules,omitempty"`
+	// IDSAlerts counts the alerts of the IDS, the most frequent alerts are in the FirewallMonitor
+	// +optional
+	IDSAlerts *IDSAlertSummary `json:"idsAlerts,omitempty"`
+	// IPS contains the statistics of the queue of the inline IPS, it is only set if connections are inspected inline
+	// +optional
+	IPS *IPSQueueStats `json:"ips,omitempty"`
+	// AutoBlock counts the sources which are blocked because of IDS alerts, all sources are in the FirewallMonitor
+	// +optional
+	AutoBlock *AutoBlockStatus `json:"autoBlock,omitempty"`
+	// Drops summarizes the packets dropped by the firewall rules, it is only set if the dropped packets are streamed
+	// +optional
+	Drops *DropSummary `json:"drops,omitempty"`
+	// DroptailerCertificate contains the validity of the client certificate for the droptailer servers
+	// +optional
+	DroptailerCertificate *CertificateStatus `json:"droptailerCertificate,omitempty"`
+	// Conditions contains the latest observations of the firewall state
+	// +optional
+	Conditions []FirewallCondition `json:"conditions,omitempty"`
+	Updated    metav1.Time         `json:"lastRun,omitempty"`
+}
+
+// IDSStatus contains the state of the suricata engine, the details are in the counters of the FirewallMonitor
+type IDSStatus struct {
+	// Running is true if suricata answers on its command socket
+	Running bool `json:"running"`
+	// Version of suricata
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Uptime of suricata
+	// +optional
+	Uptime metav1.Duration `json:"uptime,omitempty"`
+	// KernelPackets is the number of packets captured by suricata
+	KernelPackets uint64 `json:"kernelPackets"`
+	// KernelDrops is the number of packets dropped by the kernel because suricata could not keep up
+	KernelDrops uint64 `json:"kernelDrops"`
+	// DecoderInvalid is the number of packets suricata was not able to decode
+	DecoderInvalid uint64 `json:"decoderInvalid"`
+	// MemcapHits is the number of events which hit a memcap of suricata, e.g. flows or tcp segments which were not tracked
+	MemcapHits uint64 `json:"memcapHits"`
+}
+
+// IDSRulesStatus contains the state of the ruleset of the IDS
+type IDSRulesStatus struct {
+	// Loaded is the number of rules loaded by suricata
+	Loaded int `json:"loaded"`
+	// Failed is the number of rules suricata failed to load
+	Failed int `json:"failed"`
+	// LastReload is the time the controller last reloaded the ruleset
+	// +optional
+	LastReload *metav1.Time `json:"lastReload,omitempty"`
+	// Error describes why the ruleset could not be applied
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// IDSAlertSummary summarizes the alerts of the IDS since the controller started to read them
+type IDSAlertSummary struct {
+	// Total is the number of alerts
+	Total uint64 `json:"total"`
+	// Since is the time the controller started to read the alerts
+	Since metav1.Time `json:"since"`
+}
+
+// IDSAlert contains the alerts of a signature for traffic from a source to a destination
+type IDSAlert struct {
+	// SignatureID is the id of the signature which raised the alert
+	SignatureID int64 `json:"signatureID"`
+	// Signature describes the signature
+	Signature string `json:"signature"`
+	// Category of the signature
+	// +optional
+	Category string `json:"category,omitempty"`
+	// Severity of the signature, 1 is the highest severity
+	Severity int `json:"severity"`
+	// Source is the ip address the traffic originated from
+	Source string `json:"source"`
+	// Destination is the ip address the traffic was sent to
+	Destination string `json:"destination"`
+	// Count is the number of alerts
+	Count uint64 `json:"count"`
+	// Blocked is the number of packets of the alerts which were dropped by the inline IPS
+	// +optional
+	Blocked uint64 `json:"blocked,omitempty"`
+	// FirstSeen is the time of the first alert
+	FirstSeen metav1.Time `json:"firstSeen"`
+	// LastSeen is the time of the last alert
+	LastSeen metav1.Time `json:"lastSeen"`
+}
+
+// AutoBlockStatus counts the sources which are blocked because of IDS alerts
+type AutoBlockStatus struct {
+	// Total is the number of blocked sources
+	Total int `json:"total"`
+	// Blocked contains the most recently blocked sources with their expiry, at most 10
+	// +optional
+	Blocked []BlockedSource `json:"blocked,omitempty"`
+}
+
+// BlockedSource is a source which is blocked because of an IDS alert
+type BlockedSource struct {
+	// IP is the address of the source
+	IP string `json:"ip"`
+	// SignatureID is the id of the signature of the last alert which blocked the source
+	SignatureID int64 `json:"signatureID"`
+	// Signature describes the signature
+	Signature string `json:"signature"`
+	// Severity of the signature
+	Severity int `json:"severity"`
+	// Since is the time the source was blocked
+	Since metav1.Time `json:"since"`
+	// Expires is the time the block expires unless the source raises further alerts
+	Expires metav1.Time `json:"expires"`
+}
+
+// BGPStatus counts the BGP sessions of all vrfs
+type BGPStatus struct {
+	// Established is the number of established sessions
+	Established int `json:"established"`
+	// Total is the number of configured sessions
+	Total int `json:"total"`
+}
+
+// BGPNeighbor contains the state of a BGP session
+type BGPNeighbor struct {
+	// VRF of the session, default for the underlay
+	VRF string `json:"vrf"`
+	// AddressFamily of the session, e.g. ipv4Unicast or l2VpnEvpn
+	AddressFamily string `json:"addressFamily"`
+	// Peer is the address or interface of the neighbor
+	Peer string `json:"peer"`
+	// Hostname of the neighbor, if announced
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+	// RemoteAS is the autonomous system of the neighbor
+	RemoteAS int64 `json:"remoteAS"`
+	// State of the session, e.g. Established, Active or Idle
+	State string `json:"state"`
+	// Uptime is the time the session is established or down
+	Uptime metav1.Duration `json:"uptime"`
+	// PrefixesReceived is the number of prefixes received from the neighbor
+	PrefixesReceived int64 `json:"prefixesReceived"`
+	// PrefixesAdvertised is the number of prefixes advertised to the neighbor
+	PrefixesAdvertised int64 `json:"prefixesAdvertised"`
+}
+
+// BGPStateEstablished is the state of a BGP session which is up
+const BGPStateEstablished = "Established"
+
+// FirewallSummary summarizes the runtime data of a firewall
+type FirewallSummary struct {
+	// Rules is the number of rules with statistics
+	Rules int `json:"rules"`
+	// Rates contains the current traffic rates
+	// +optional
+	Rates *TrafficSample `json:"rates,omitempty"`
+	// LastReload is the time the ruleset was last reloaded by the controller
+	// +optional
+	LastReload *metav1.Time `json:"lastReload,omitempty"`
+	// ConntrackUsage is the usage of the connection tracking table in percent
+	// +optional
+	ConntrackUsage *int `json:"conntrackUsage,omitempty"`
+	// SNATUsage is the highest usage of the ports of a source nat address in percent
+	// +optional
+	SNATUsage *int `json:"snatUsage,omitempty"`
+}
+
+// FirewallConditionType is the type of a firewall condition
+type FirewallConditionType string
+
+const (
+	// FirewallMonitorUpdated indicates whether the runtime data could be written to the FirewallMonitor
+	FirewallMonitorUpdated FirewallConditionType = "MonitorUpdated"
+	// FirewallBGPEstablished indicates whether all BGP sessions of FRR are established
+	FirewallBGPEstablished FirewallConditionType = "BGPEstablished"
+	// FirewallIDSRulesLoaded indicates whether the configured ruleset of the IDS is loaded
+	FirewallIDSRulesLoaded FirewallConditionType = "IDSRulesLoaded"
+	// FirewallIDSHealthy indicates whether suricata is running and answers on its command socket
+	FirewallIDSHealthy FirewallConditionType = "IDSHealthy"
+	// FirewallDroptailerDiscovered indicates whether droptailer servers were discovered for the dropped packets
+	FirewallDroptailerDiscovered FirewallConditionType = "DroptailerDiscovered"
+	// FirewallDroptailerCertificateValid indicates whether the client certificate for the droptailer servers is valid and not about to expire
+	FirewallDroptailerCertificateValid FirewallConditionType = "DroptailerCertificateValid"
+)
+
+// FirewallCondition describes an observation of the firewall state
+type FirewallCondition struct {
+	// Type of the condition
+	Type FirewallConditionType `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status ConditionStatus `json:"status"`
+	// LastTransitionTime is the time the condition last changed its status
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable reason for the last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ConditionStatus is the status of a condition
+type ConditionStatus string
+
+// The statuses of a condition
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// SetCondition sets a condition of the firewall status, the transition time is only updated if the status changes
+func (s *FirewallStatus) SetCondition(t FirewallConditionType, status ConditionStatus, reason, message string) {
+	now := metav1.Now()
+	for i := range s.Conditions {
+		c := &s.Conditions[i]
+		if c.Type != t {
+			continue
+		}
+		if c.Status != status {
+			c.LastTransitionTime = now
+		}
+		c.Status = status
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	s.Conditions = append(s.Conditions, FirewallCondition{
+		Type:               t,
+		Status:             status,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// GetCondition returns the condition of the given type, nil if it is not set
+func (s *FirewallStatus) GetCondition(t FirewallConditionType) *FirewallCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
 }
 
 // FirewallStats contains firewall statistics
@@ -93,17 +445,233 @@ type FirewallStats struct {
 	RuleStats   RuleStatsByAction   `json:"rules"`
 	DeviceStats DeviceStatsByDevice `json:"devices"`
 	IDSStats    IDSStatsByDevice    `json:"idsstats"`
+	// IDSCounters contains the counters of the suricata engine like in its stats.log, e.g. capture.kernel_drops
+	// +optional
+	IDSCounters map[string]uint64 `json:"idsCounters,omitempty"`
+	// Links contains the statistics of the interfaces of the firewall networks, grouped by network id and interface name.
+	// In contrast to the device statistics they are read from the kernel and are not reset by reloads of the ruleset.
+	// +optional
+	Links LinkStatsByNetwork `json:"links,omitempty"`
+	// LastReload is the time the ruleset was last reloaded by the controller, which resets all counters
+	// +optional
+	LastReload *metav1.Time `json:"lastReload,omitempty"`
+	// Rates contains the current traffic rates computed from the counters of the last two status updates
+	// +optional
+	Rates *TrafficSample `json:"rates,omitempty"`
+	// Samples contains the traffic rates of the last status updates, the oldest first
+	// +optional
+	Samples []TrafficSample `json:"samples,omitempty"`
+	// Conntrack contains the statistics of the connection tracking table
+	// +optional
+	Conntrack *ConntrackStats `json:"conntrack,omitempty"`
+	// IPSQueue contains the statistics of the queue of the inline IPS
+	// +optional
+	IPSQueue *IPSQueueStats `json:"ipsQueue,omitempty"`
+	// TopTalkers contains the clients with the most traffic to the services and external networks
+	// +optional
+	TopTalkers *TopTalkers `json:"topTalkers,omitempty"`
+	// UnusedRules contains the rules generated for kubernetes objects which did not match any traffic for a configurable period
+	// +optional
+	UnusedRules []UnusedRule `json:"unusedRules,omitempty"`
+	// BGPNeighbors contains the BGP sessions of FRR ordered by vrf, address family and peer
+	// +optional
+	BGPNeighbors []BGPNeighbor `json:"bgpNeighbors,omitempty"`
+	// IDSAlerts contains the most frequent alerts of the IDS, aggregated by signature, severity, source and destination
+	// +optional
+	IDSAlerts []IDSAlert `json:"idsAlerts,omitempty"`
+	// AutoBlocked contains the sources which are blocked because of IDS alerts, the most recently blocked first
+	// +optional
+	AutoBlocked []BlockedSource `json:"autoBlocked,omitempty"`
+}
+
+// CertificateStatus contains the validity of a certificate
+type CertificateStatus struct {
+	// Subject is the common name of the certificate
+	Subject   string      `json:"subject"`
+	NotBefore metav1.Time `json:"notBefore"`
+	NotAfter  metav1.Time `json:"notAfter"`
+	// CANotAfter is the expiry of the ca which signed the certificate
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+}
+
+// DropSummary contains the packets dropped by the firewall rules within a sliding window
+type DropSummary struct {
+	// Updated is the time the summary was created
+	Updated metav1.Time `json:"updated"`
+	// Window is the period the dropped packets are aggregated for
+	Window metav1.Duration `json:"window"`
+	// Drops contains the aggregates with the most dropped packets, ordered by packets
+	// +optional
+	Drops []DropAggregate `json:"drops,omitempty"`
+	// Services contains the packets dropped on their way to the load balancer ips of the services by namespace/name
+	// +optional
+	Services map[string]uint64 `json:"services,omitempty"`
+}
+
+// DropAggregate contains the packets dropped from a source network to a destination and port
+type DropAggregate struct {
+	// SourceNetwork is the id of the firewall network the sources belong to, for other sources it is their /24 network
+	SourceNetwork string `json:"sourceNetwork"`
+	// Destination is the destination ip of the dropped packets
+	Destination string `json:"destination"`
+	// Service is the namespace/name of the service the destination is a load balancer ip of
+	// +optional
+	Service string `json:"service,omitempty"`
+	// Protocol of the dropped packets, e.g. TCP
+	Protocol string `json:"protocol"`
+	// Port is the destination port of the dropped packets, it is zero for protocols without ports
+	// +optional
+	Port uint16 `json:"port,omitempty"`
+	// Packets is the number of packets dropped within the window
+	Packets uint64 `json:"packets"`
+}
+
+// TopTalkers contains the clients with the most traffic in the open connections, ordered by bytes
+type TopTalkers struct {
+	// Updated is the time the connections were analyzed
+	Updated metav1.Time `json:"updated"`
+	// Services contains the top talkers of the services by namespace/name
+	// +optional
+	Services map[string][]Talker `json:"services,omitempty"`
+	// Networks contains the top talkers to the external networks of the egress rules by network id
+	// +optional
+	Networks map[string][]Talker `json:"networks,omitempty"`
+}
+
+// Talker contains the traffic of a client
+type Talker struct {
+	// IP of the client
+	IP string `json:"ip"`
+	// Connections is the number of open connections of the client
+	Connections uint64 `json:"connections"`
+	// Bytes is the traffic of the open connections in both directions
+	Bytes uint64 `json:"bytes"`
+}
+
+// UnusedRule is a rule which did not match any traffic for a configurable period
+type UnusedRule struct {
+	// Action of the rule, e.g. accept
+	Action string `json:"action"`
+	// Comment of the rule, which keys its statistics
+	Comment string `json:"comment"`
+	// Source identifies the kubernetes object the rule was generated for
+	// +optional
+	Source *RuleSource `json:"source,omitempty"`
+	// LastHit is the time the rule last matched traffic, it is empty if the rule never matched traffic since the controller knows it
+	// +optional
+	LastHit *metav1.Time `json:"lastHit,omitempty"`
+	// Since is the time since which the rule did not match any traffic
+	Since metav1.Time `json:"since"`
+}
+
+// IPSQueueStats contains the statistics of the NFQUEUE the connections inspected inline by suricata are sent to
+type IPSQueueStats struct {
+	// Queue is the number of the queue
+	Queue uint16 `json:"queue"`
+	// Listening is true if suricata is bound to the queue, otherwise the packets bypass the inspection
+	Listening bool `json:"listening"`
+	// Waiting is the number of packets waiting for the verdict of suricata
+	Waiting uint64 `json:"waiting"`
+	// QueueDropped is the number of packets dropped because the queue was full
+	QueueDropped uint64 `json:"queueDropped"`
+	// UserDropped is the number of packets which could not be passed to suricata
+	UserDropped uint64 `json:"userDropped"`
+}
+
+// ConntrackStats contains the statistics of the connection tracking table
+type ConntrackStats struct {
+	// Entries is the number of connections in the table
+	Entries uint64 `json:"entries"`
+	// Max is the size of the table, new connections are dropped if it is full
+	Max uint64 `json:"max"`
+	// InsertFailed is the number of connections which could not be inserted into the table
+	InsertFailed uint64 `json:"insertFailed"`
+	// Drop is the number of packets dropped because a connection could not be tracked
+	Drop uint64 `json:"drop"`
+	// EarlyDrop is the number of connections evicted to make room for new connections in a full table
+	EarlyDrop uint64 `json:"earlyDrop"`
+	// SNAT contains the usage of the source nat addresses of the egress rules by address
+	// +optional
+	SNAT map[string]SNATStat `json:"snat,omitempty"`
+}
+
+// SNATStat contains the usage of a source nat address
+type SNATStat struct {
+	// NetworkID is the network the address belongs to
+	NetworkID string `json:"networkid"`
+	// Connections is the number of connections translated to the address
+	Connections uint64 `json:"connections"`
+	// Ports is the highest number of ports of the address in use for a single destination,
+	// new connections to this destination fail when all ports are in use
+	Ports uint64 `json:"ports"`
+}
+
+// TrafficSample contains the traffic rates of an interval between two status updates
+type TrafficSample struct {
+	// Time is the end of the interval
+	Time metav1.Time `json:"time"`
+	// Devices contains the rates of the devices, e.g. internal and external
+	Devices map[string]DeviceRate `json:"devices"`
+	// Drop contains the rate of the packets dropped by the firewall rules
+	Drop Rate `json:"drop"`
+}
+
+// DeviceRate contains the traffic rates of a device by direction
+type DeviceRate struct {
+	In  Rate `json:"in"`
+	Out Rate `json:"out"`
+}
+
+// Rate contains a traffic rate
+type Rate struct {
+	BytesPerSecond   uint64 `json:"bytesPerSecond"`
+	PacketsPerSecond uint64 `json:"packetsPerSecond"`
 }
 
 // RuleStatsByAction contains firewall rule statistics groups by action: e.g. accept, drop, policy, masquerade
 type RuleStatsByAction map[string]RuleStats
 
+// Count returns the number of rules with statistics
+func (r RuleStatsByAction) Count() int {
+	count := 0
+	for _, ruleStats := range r {
+		count += len(ruleStats)
+	}
+	return count
+}
+
 // RuleStats contains firewall rule statistics of all rules of an action
 type RuleStats map[string]RuleStat
 
 // RuleStat contains the statistics for a single nftables rule
 type RuleStat struct {
+	// Counter holds the values since the last reload of the ruleset
 	Counter Counter `json:"counter"`
+	// Cumulative holds the values accumulated across reloads of the ruleset
+	Cumulative Counter `json:"cumulative"`
+	// Source identifies the kubernetes object the rule was generated for, it is empty for static rules
+	// +optional
+	Source *RuleSource `json:"source,omitempty"`
+}
+
+// RuleSource identifies a nftables rule generated for a kubernetes object
+type RuleSource struct {
+	// Kind of the object, e.g. Service or ClusterwideNetworkPolicy
+	Kind string `json:"kind"`
+	// Namespace of the object, it may be empty if the identifier did not fit into the rule
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the object, it may be empty if the identifier did not fit into the rule
+	// +optional
+	Name string `json:"name,omitempty"`
+	// UID of the object
+	// +optional
+	UID string `json:"uid,omitempty"`
+	// Rule identifies the rule within the object, e.g. ingress-0 or nodeport
+	Rule string `json:"rule"`
+	// Protocol of the rule, e.g. tcp or udp
+	Protocol string `json:"protocol"`
 }
 
 // Counter holds values of a nftables counter object
@@ -131,12 +699,38 @@ type DeviceStatsByDevice map[string]DeviceStat
 
 // DeviceStat contains statistics of a device
 type DeviceStat struct {
-	InBytes  uint64 `json:"in"`
-	OutBytes uint64 `json:"out"`
-	// Deprecated: TotalBytes is kept for backwards compatibility
+	InBytes    uint64 `json:"in"`
+	OutBytes   uint64 `json:"out"`
+	InPackets  uint64 `json:"inpackets"`
+	OutPackets uint64 `json:"outpackets"`
+	// CumulativeInBytes and CumulativeOutBytes are accumulated across reloads of the ruleset
+	CumulativeInBytes  uint64 `json:"cumulativein"`
+	CumulativeOutBytes uint64 `json:"cumulativeout"`
+	// CumulativeInPackets and CumulativeOutPackets are accumulated across reloads of the ruleset
+	CumulativeInPackets  uint64 `json:"cumulativeinpackets"`
+	CumulativeOutPackets uint64 `json:"cumulativeoutpackets"`
+	// TotalBytes is the sum of the in and out bytes
 	TotalBytes uint64 `json:"total"`
 }
 
+// LinkStatsByNetwork contains the statistics of the interfaces grouped by network id
+type LinkStatsByNetwork map[string]LinkStatsByInterface
+
+// LinkStatsByInterface contains the statistics of the interfaces of a network grouped by interface name
+type LinkStatsByInterface map[string]LinkStat
+
+// LinkStat contains the statistics of a network interface, received traffic is counted as in, transmitted traffic as out
+type LinkStat struct {
+	InBytes    uint64 `json:"in"`
+	OutBytes   uint64 `json:"out"`
+	InPackets  uint64 `json:"inpackets"`
+	OutPackets uint64 `json:"outpackets"`
+	InErrors   uint64 `json:"inerrors"`
+	OutErrors  uint64 `json:"outerrors"`
+	InDropped  uint64 `json:"indropped"`
+	OutDropped uint64 `json:"outdropped"`
+}
+
 type IDSStatsByDevice map[string]InterfaceStat
 
 type InterfaceStat struct {
@@ -19,8 +19,10 @@ package v1
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestSerialization(t *testing.T) {
@@ -133,3 +135,47 @@ func TestSerialization(t *testing.T) {
 		})
 	}
 }
+
+func TestFirewallStatus_SetCondition(t *testing.T) {
+	s := FirewallStatus{}
+
+	s.SetCondition(FirewallMonitorUpdated, ConditionFalse, "UpdateFailed", "forbidden")
+	c := s.GetCondition(FirewallMonitorUpdated)
+	if c == nil {
+		t.Fatal("condition was not set")
+	}
+	transition := c.LastTransitionTime
+
+	c.LastTransitionTime = metav1.NewTime(transition.Add(-time.Minute))
+	s.SetCondition(FirewallMonitorUpdated, ConditionFalse, "UpdateFailed", "timeout")
+	c = s.GetCondition(FirewallMonitorUpdated)
+	if !c.LastTransitionTime.Equal(&metav1.Time{Time: transition.Add(-time.Minute)}) {
+		t.Errorf("transition time changed without a change of the status")
+	}
+	if c.Message != "timeout" {
+		t.Errorf("message was not updated, got %q", c.Message)
+	}
+
+	s.SetCondition(FirewallMonitorUpdated, ConditionTrue, "Updated", "")
+	c = s.GetCondition(FirewallMonitorUpdated)
+	if c.Status != ConditionTrue || !c.LastTransitionTime.After(transition.Add(-time.Minute)) {
+		t.Errorf("transition was not recorded, got %v", c)
+	}
+	if len(s.Conditions) != 1 {
+		t.Errorf("expected exactly one condition, got %d", len(s.Conditions))
+	}
+	if s.GetCondition("Unknown") != nil {
+		t.Errorf("expected no condition of an unknown type")
+	}
+}
+
+func TestRuleStatsByAction_Count(t *testing.T) {
+	stats := RuleStatsByAction{
+		"accept": RuleStats{"a": RuleStat{}, "b": RuleStat{}},
+		"drop":   RuleStats{"c": RuleStat{}},
+		"other":  RuleStats{},
+	}
+	if got := stats.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+}
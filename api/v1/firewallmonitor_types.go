@@ -0,0 +1,50 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallMonitor contains the bulky runtime data of a firewall, e.g. the rule, device and IDS statistics.
+// It is owned by the Firewall of the same name and updated with its own rate limit to keep the Firewall small.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=fwmon
+// +kubebuilder:printcolumn:name="Last Run",type=date,JSONPath=`.lastRun`
+type FirewallMonitor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Stats contains the statistics of the rules, devices and the IDS
+	// +optional
+	Stats FirewallStats `json:"stats,omitempty"`
+	// Updated is the time the runtime data was collected
+	// +optional
+	Updated metav1.Time `json:"lastRun,omitempty"`
+}
+
+// FirewallMonitorList contains a list of FirewallMonitor
+// +kubebuilder:object:root=true
+type FirewallMonitorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FirewallMonitor `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FirewallMonitor{}, &FirewallMonitorList{})
+}
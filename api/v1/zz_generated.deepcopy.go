@@ -25,12 +25,124 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoBlock) DeepCopyInto(out *AutoBlock) {
+	*out = *in
+	if in.AllowList != nil {
+		in, out := &in.AllowList, &out.AllowList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoBlock.
+func (in *AutoBlock) DeepCopy() *AutoBlock {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoBlock)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoBlockStatus) DeepCopyInto(out *AutoBlockStatus) {
+	*out = *in
+	if in.Blocked != nil {
+		in, out := &in.Blocked, &out.Blocked
+		*out = make([]BlockedSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoBlockStatus.
+func (in *AutoBlockStatus) DeepCopy() *AutoBlockStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoBlockStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPNeighbor) DeepCopyInto(out *BGPNeighbor) {
+	*out = *in
+	out.Uptime = in.Uptime
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPNeighbor.
+func (in *BGPNeighbor) DeepCopy() *BGPNeighbor {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPNeighbor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPStatus) DeepCopyInto(out *BGPStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPStatus.
+func (in *BGPStatus) DeepCopy() *BGPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlockedSource) DeepCopyInto(out *BlockedSource) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+	in.Expires.DeepCopyInto(&out.Expires)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlockedSource.
+func (in *BlockedSource) DeepCopy() *BlockedSource {
+	if in == nil {
+		return nil
+	}
+	out := new(BlockedSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateStatus) DeepCopyInto(out *CertificateStatus) {
+	*out = *in
+	in.NotBefore.DeepCopyInto(&out.NotBefore)
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	if in.CANotAfter != nil {
+		in, out := &in.CANotAfter, &out.CANotAfter
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateStatus.
+func (in *CertificateStatus) DeepCopy() *CertificateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterwideNetworkPolicy) DeepCopyInto(out *ClusterwideNetworkPolicy) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterwideNetworkPolicy.
@@ -83,6 +195,28 @@ func (in *ClusterwideNetworkPolicyList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConntrackStats) DeepCopyInto(out *ConntrackStats) {
+	*out = *in
+	if in.SNAT != nil {
+		in, out := &in.SNAT, &out.SNAT
+		*out = make(map[string]SNATStat, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConntrackStats.
+func (in *ConntrackStats) DeepCopy() *ConntrackStats {
+	if in == nil {
+		return nil
+	}
+	out := new(ConntrackStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Counter) DeepCopyInto(out *Counter) {
 	*out = *in
@@ -125,6 +259,28 @@ func (in *Data) DeepCopyInto(out *Data) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.FlowExport != nil {
+		in, out := &in.FlowExport, &out.FlowExport
+		*out = new(FlowExport)
+		**out = **in
+	}
+	if in.IDS != nil {
+		in, out := &in.IDS, &out.IDS
+		*out = new(IDSRuleset)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoBlock != nil {
+		in, out := &in.AutoBlock, &out.AutoBlock
+		*out = new(AutoBlock)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RoutingPolicies != nil {
+		in, out := &in.RoutingPolicies, &out.RoutingPolicies
+		*out = make([]RoutingPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Data.
@@ -137,6 +293,23 @@ func (in *Data) DeepCopy() *Data {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceRate) DeepCopyInto(out *DeviceRate) {
+	*out = *in
+	out.In = in.In
+	out.Out = in.Out
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceRate.
+func (in *DeviceRate) DeepCopy() *DeviceRate {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceRate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeviceStat) DeepCopyInto(out *DeviceStat) {
 	*out = *in
@@ -173,6 +346,50 @@ func (in DeviceStatsByDevice) DeepCopy() DeviceStatsByDevice {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DropAggregate) DeepCopyInto(out *DropAggregate) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DropAggregate.
+func (in *DropAggregate) DeepCopy() *DropAggregate {
+	if in == nil {
+		return nil
+	}
+	out := new(DropAggregate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DropSummary) DeepCopyInto(out *DropSummary) {
+	*out = *in
+	in.Updated.DeepCopyInto(&out.Updated)
+	out.Window = in.Window
+	if in.Drops != nil {
+		in, out := &in.Drops, &out.Drops
+		*out = make([]DropAggregate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make(map[string]uint64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DropSummary.
+func (in *DropSummary) DeepCopy() *DropSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(DropSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EgressRule) DeepCopyInto(out *EgressRule) {
 	*out = *in
@@ -249,6 +466,22 @@ func (in *Firewall) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallCondition) DeepCopyInto(out *FirewallCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallCondition.
+func (in *FirewallCondition) DeepCopy() *FirewallCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FirewallList) DeepCopyInto(out *FirewallList) {
 	*out = *in
@@ -281,6 +514,65 @@ func (in *FirewallList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallMonitor) DeepCopyInto(out *FirewallMonitor) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Stats.DeepCopyInto(&out.Stats)
+	in.Updated.DeepCopyInto(&out.Updated)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallMonitor.
+func (in *FirewallMonitor) DeepCopy() *FirewallMonitor {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallMonitor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FirewallMonitor) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallMonitorList) DeepCopyInto(out *FirewallMonitorList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FirewallMonitor, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallMonitorList.
+func (in *FirewallMonitorList) DeepCopy() *FirewallMonitorList {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallMonitorList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FirewallMonitorList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FirewallNetwork) DeepCopyInto(out *FirewallNetwork) {
 	*out = *in
@@ -366,7 +658,7 @@ func (in *FirewallStats) DeepCopyInto(out *FirewallStats) {
 				in, out := &val, &outVal
 				*out = make(RuleStats, len(*in))
 				for key, val := range *in {
-					(*out)[key] = val
+					(*out)[key] = *val.DeepCopy()
 				}
 			}
 			(*out)[key] = outVal
@@ -386,6 +678,88 @@ func (in *FirewallStats) DeepCopyInto(out *FirewallStats) {
 			(*out)[key] = val
 		}
 	}
+	if in.IDSCounters != nil {
+		in, out := &in.IDSCounters, &out.IDSCounters
+		*out = make(map[string]uint64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Links != nil {
+		in, out := &in.Links, &out.Links
+		*out = make(LinkStatsByNetwork, len(*in))
+		for key, val := range *in {
+			var outVal map[string]LinkStat
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make(LinkStatsByInterface, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.LastReload != nil {
+		in, out := &in.LastReload, &out.LastReload
+		*out = (*in).DeepCopy()
+	}
+	if in.Rates != nil {
+		in, out := &in.Rates, &out.Rates
+		*out = new(TrafficSample)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Samples != nil {
+		in, out := &in.Samples, &out.Samples
+		*out = make([]TrafficSample, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conntrack != nil {
+		in, out := &in.Conntrack, &out.Conntrack
+		*out = new(ConntrackStats)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPSQueue != nil {
+		in, out := &in.IPSQueue, &out.IPSQueue
+		*out = new(IPSQueueStats)
+		**out = **in
+	}
+	if in.TopTalkers != nil {
+		in, out := &in.TopTalkers, &out.TopTalkers
+		*out = new(TopTalkers)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnusedRules != nil {
+		in, out := &in.UnusedRules, &out.UnusedRules
+		*out = make([]UnusedRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BGPNeighbors != nil {
+		in, out := &in.BGPNeighbors, &out.BGPNeighbors
+		*out = make([]BGPNeighbor, len(*in))
+		copy(*out, *in)
+	}
+	if in.IDSAlerts != nil {
+		in, out := &in.IDSAlerts, &out.IDSAlerts
+		*out = make([]IDSAlert, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AutoBlocked != nil {
+		in, out := &in.AutoBlocked, &out.AutoBlocked
+		*out = make([]BlockedSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallStats.
@@ -401,7 +775,59 @@ func (in *FirewallStats) DeepCopy() *FirewallStats {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FirewallStatus) DeepCopyInto(out *FirewallStatus) {
 	*out = *in
-	in.FirewallStats.DeepCopyInto(&out.FirewallStats)
+	in.Summary.DeepCopyInto(&out.Summary)
+	if in.FirewallStats != nil {
+		in, out := &in.FirewallStats, &out.FirewallStats
+		*out = new(FirewallStats)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BGP != nil {
+		in, out := &in.BGP, &out.BGP
+		*out = new(BGPStatus)
+		**out = **in
+	}
+	if in.IDS != nil {
+		in, out := &in.IDS, &out.IDS
+		*out = new(IDSStatus)
+		**out = **in
+	}
+	if in.IDSRules != nil {
+		in, out := &in.IDSRules, &out.IDSRules
+		*out = new(IDSRulesStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IDSAlerts != nil {
+		in, out := &in.IDSAlerts, &out.IDSAlerts
+		*out = new(IDSAlertSummary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPS != nil {
+		in, out := &in.IPS, &out.IPS
+		*out = new(IPSQueueStats)
+		**out = **in
+	}
+	if in.AutoBlock != nil {
+		in, out := &in.AutoBlock, &out.AutoBlock
+		*out = new(AutoBlockStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Drops != nil {
+		in, out := &in.Drops, &out.Drops
+		*out = new(DropSummary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DroptailerCertificate != nil {
+		in, out := &in.DroptailerCertificate, &out.DroptailerCertificate
+		*out = new(CertificateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]FirewallCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.Updated.DeepCopyInto(&out.Updated)
 }
 
@@ -416,10 +842,146 @@ func (in *FirewallStatus) DeepCopy() *FirewallStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in IDSStatsByDevice) DeepCopyInto(out *IDSStatsByDevice) {
-	{
-		in := &in
-		*out = make(IDSStatsByDevice, len(*in))
+func (in *FirewallSummary) DeepCopyInto(out *FirewallSummary) {
+	*out = *in
+	if in.Rates != nil {
+		in, out := &in.Rates, &out.Rates
+		*out = new(TrafficSample)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastReload != nil {
+		in, out := &in.LastReload, &out.LastReload
+		*out = (*in).DeepCopy()
+	}
+	if in.ConntrackUsage != nil {
+		in, out := &in.ConntrackUsage, &out.ConntrackUsage
+		*out = new(int)
+		**out = **in
+	}
+	if in.SNATUsage != nil {
+		in, out := &in.SNATUsage, &out.SNATUsage
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallSummary.
+func (in *FirewallSummary) DeepCopy() *FirewallSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowExport) DeepCopyInto(out *FlowExport) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowExport.
+func (in *FlowExport) DeepCopy() *FlowExport {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDSAlert) DeepCopyInto(out *IDSAlert) {
+	*out = *in
+	in.FirstSeen.DeepCopyInto(&out.FirstSeen)
+	in.LastSeen.DeepCopyInto(&out.LastSeen)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDSAlert.
+func (in *IDSAlert) DeepCopy() *IDSAlert {
+	if in == nil {
+		return nil
+	}
+	out := new(IDSAlert)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDSAlertSummary) DeepCopyInto(out *IDSAlertSummary) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDSAlertSummary.
+func (in *IDSAlertSummary) DeepCopy() *IDSAlertSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(IDSAlertSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDSRulesStatus) DeepCopyInto(out *IDSRulesStatus) {
+	*out = *in
+	if in.LastReload != nil {
+		in, out := &in.LastReload, &out.LastReload
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDSRulesStatus.
+func (in *IDSRulesStatus) DeepCopy() *IDSRulesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IDSRulesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDSRuleset) DeepCopyInto(out *IDSRuleset) {
+	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DisabledSIDs != nil {
+		in, out := &in.DisabledSIDs, &out.DisabledSIDs
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMaps != nil {
+		in, out := &in.ConfigMaps, &out.ConfigMaps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDSRuleset.
+func (in *IDSRuleset) DeepCopy() *IDSRuleset {
+	if in == nil {
+		return nil
+	}
+	out := new(IDSRuleset)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in IDSStatsByDevice) DeepCopyInto(out *IDSStatsByDevice) {
+	{
+		in := &in
+		*out = make(IDSStatsByDevice, len(*in))
 		for key, val := range *in {
 			(*out)[key] = val
 		}
@@ -436,6 +998,37 @@ func (in IDSStatsByDevice) DeepCopy() IDSStatsByDevice {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDSStatus) DeepCopyInto(out *IDSStatus) {
+	*out = *in
+	out.Uptime = in.Uptime
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDSStatus.
+func (in *IDSStatus) DeepCopy() *IDSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IDSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPSQueueStats) DeepCopyInto(out *IPSQueueStats) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPSQueueStats.
+func (in *IPSQueueStats) DeepCopy() *IPSQueueStats {
+	if in == nil {
+		return nil
+	}
+	out := new(IPSQueueStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressRule) DeepCopyInto(out *IngressRule) {
 	*out = *in
@@ -480,6 +1073,94 @@ func (in *InterfaceStat) DeepCopy() *InterfaceStat {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LinkStat) DeepCopyInto(out *LinkStat) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinkStat.
+func (in *LinkStat) DeepCopy() *LinkStat {
+	if in == nil {
+		return nil
+	}
+	out := new(LinkStat)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in LinkStatsByInterface) DeepCopyInto(out *LinkStatsByInterface) {
+	{
+		in := &in
+		*out = make(LinkStatsByInterface, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinkStatsByInterface.
+func (in LinkStatsByInterface) DeepCopy() LinkStatsByInterface {
+	if in == nil {
+		return nil
+	}
+	out := new(LinkStatsByInterface)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in LinkStatsByNetwork) DeepCopyInto(out *LinkStatsByNetwork) {
+	{
+		in := &in
+		*out = make(LinkStatsByNetwork, len(*in))
+		for key, val := range *in {
+			var outVal map[string]LinkStat
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make(LinkStatsByInterface, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinkStatsByNetwork.
+func (in LinkStatsByNetwork) DeepCopy() LinkStatsByNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(LinkStatsByNetwork)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyRuleStatus) DeepCopyInto(out *PolicyRuleStatus) {
+	*out = *in
+	out.Counter = in.Counter
+	if in.LastHit != nil {
+		in, out := &in.LastHit, &out.LastHit
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyRuleStatus.
+func (in *PolicyRuleStatus) DeepCopy() *PolicyRuleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyRuleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PolicySpec) DeepCopyInto(out *PolicySpec) {
 	*out = *in
@@ -509,6 +1190,76 @@ func (in *PolicySpec) DeepCopy() *PolicySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyStatus) DeepCopyInto(out *PolicyStatus) {
+	*out = *in
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = make([]PolicyRuleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		*out = make([]PolicyRuleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Updated.DeepCopyInto(&out.Updated)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyStatus.
+func (in *PolicyStatus) DeepCopy() *PolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrefixFilter) DeepCopyInto(out *PrefixFilter) {
+	*out = *in
+	if in.GE != nil {
+		in, out := &in.GE, &out.GE
+		*out = new(uint8)
+		**out = **in
+	}
+	if in.LE != nil {
+		in, out := &in.LE, &out.LE
+		*out = new(uint8)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefixFilter.
+func (in *PrefixFilter) DeepCopy() *PrefixFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(PrefixFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rate) DeepCopyInto(out *Rate) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rate.
+func (in *Rate) DeepCopy() *Rate {
+	if in == nil {
+		return nil
+	}
+	out := new(Rate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RateLimit) DeepCopyInto(out *RateLimit) {
 	*out = *in
@@ -524,10 +1275,70 @@ func (in *RateLimit) DeepCopy() *RateLimit {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoutingPolicy) DeepCopyInto(out *RoutingPolicy) {
+	*out = *in
+	if in.Accept != nil {
+		in, out := &in.Accept, &out.Accept
+		*out = make([]PrefixFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Announce != nil {
+		in, out := &in.Announce, &out.Announce
+		*out = make([]PrefixFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LocalPreference != nil {
+		in, out := &in.LocalPreference, &out.LocalPreference
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Communities != nil {
+		in, out := &in.Communities, &out.Communities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoutingPolicy.
+func (in *RoutingPolicy) DeepCopy() *RoutingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RoutingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuleSource) DeepCopyInto(out *RuleSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuleSource.
+func (in *RuleSource) DeepCopy() *RuleSource {
+	if in == nil {
+		return nil
+	}
+	out := new(RuleSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RuleStat) DeepCopyInto(out *RuleStat) {
 	*out = *in
 	out.Counter = in.Counter
+	out.Cumulative = in.Cumulative
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(RuleSource)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuleStat.
@@ -546,7 +1357,7 @@ func (in RuleStats) DeepCopyInto(out *RuleStats) {
 		in := &in
 		*out = make(RuleStats, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 }
@@ -574,7 +1385,7 @@ func (in RuleStatsByAction) DeepCopyInto(out *RuleStatsByAction) {
 				in, out := &val, &outVal
 				*out = make(RuleStats, len(*in))
 				for key, val := range *in {
-					(*out)[key] = val
+					(*out)[key] = *val.DeepCopy()
 				}
 			}
 			(*out)[key] = outVal
@@ -591,3 +1402,130 @@ func (in RuleStatsByAction) DeepCopy() RuleStatsByAction {
 	in.DeepCopyInto(out)
 	return *out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SNATStat) DeepCopyInto(out *SNATStat) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SNATStat.
+func (in *SNATStat) DeepCopy() *SNATStat {
+	if in == nil {
+		return nil
+	}
+	out := new(SNATStat)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Talker) DeepCopyInto(out *Talker) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Talker.
+func (in *Talker) DeepCopy() *Talker {
+	if in == nil {
+		return nil
+	}
+	out := new(Talker)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopTalkers) DeepCopyInto(out *TopTalkers) {
+	*out = *in
+	in.Updated.DeepCopyInto(&out.Updated)
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make(map[string][]Talker, len(*in))
+		for key, val := range *in {
+			var outVal []Talker
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]Talker, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make(map[string][]Talker, len(*in))
+		for key, val := range *in {
+			var outVal []Talker
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]Talker, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopTalkers.
+func (in *TopTalkers) DeepCopy() *TopTalkers {
+	if in == nil {
+		return nil
+	}
+	out := new(TopTalkers)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficSample) DeepCopyInto(out *TrafficSample) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make(map[string]DeviceRate, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.Drop = in.Drop
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficSample.
+func (in *TrafficSample) DeepCopy() *TrafficSample {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficSample)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnusedRule) DeepCopyInto(out *UnusedRule) {
+	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(RuleSource)
+		**out = **in
+	}
+	if in.LastHit != nil {
+		in, out := &in.LastHit, &out.LastHit
+		*out = (*in).DeepCopy()
+	}
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnusedRule.
+func (in *UnusedRule) DeepCopy() *UnusedRule {
+	if in == nil {
+		return nil
+	}
+	out := new(UnusedRule)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -1,25 +1,36 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/collector"
+	"github.com/metal-stack/firewall-controller/pkg/droptailer"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
 	"github.com/txn2/txeh"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -32,6 +43,8 @@ const (
 	secretKeyCertificateKey = "droptailer-client.key"
 	secretKeyCaCertificate  = "ca.crt"
 	defaultCertificateBase  = "/etc/droptailer-client"
+	// certificateBaseEnv overrides the directory the certificates are written to
+	certificateBaseEnv = "DROPTAILER_CLIENT_CERTIFICATE_BASE"
 )
 
 // DroptailerReconciler reconciles a Droptailer object
@@ -40,19 +53,40 @@ type DroptailerReconciler struct {
 	Log       logr.Logger
 	Scheme    *runtime.Scheme
 	HostsFile string
+	// StreamDrops streams the dropped packets of the DropLogGroup to the droptailer servers instead of the droptailer client on the host
+	StreamDrops  bool
+	DropLogGroup uint16
+	// Drops aggregates the streamed drops, it is optional
+	Drops *collector.DropAggregator
+	// ExpiryWarning is the period ahead of the expiry of the client certificate a warning is emitted
+	ExpiryWarning time.Duration
 	// FIXME is not filled properly
 	certificateBase string
-	oldPodIP        string
+	oldServerIP     string
 	hosts           *txeh.Hosts
+	stream          *droptailer.Client
+	recorder        record.EventRecorder
+
+	// the result of the last discovery of the droptailer servers
+	lock         sync.Mutex
+	discovered   bool
+	servers      []string
+	discoveryErr error
+
+	// the client certificate of the last secret and the error if it was invalid
+	certificate       *droptailer.Certificate
+	certificateErr    error
+	certificateWarned string
 }
 
 const (
 	droptailerReconcileInterval = time.Second * 10
 )
 
-// Reconcile droptailer with certificate and droptailer-server ip from pod inspection
+// Reconcile droptailer with certificate and the droptailer servers from the endpoints of their services
 // +kubebuilder:rbac:groups=metal-stack.io,resources=Droptailers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=metal-stack.io,resources=Droptailers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=services;endpoints;secrets,verbs=get;list;watch
 func (r *DroptailerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("Droptailer", req.NamespacedName)
@@ -63,12 +97,36 @@ func (r *DroptailerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return requeue, nil
 	}
 
+	// the certificates are applied even if no server is discovered, the error is reported in the condition of the firewall
+	var errors *multierror.Error
+	servers, err := r.discoverServers(ctx)
+	r.setDiscovery(servers, err)
+	if err != nil {
+		log.Error(err, "unable to discover droptailer servers")
+		errors = multierror.Append(errors, err)
+	} else if r.stream != nil {
+		r.stream.SetServers(servers)
+	} else if err := r.updateHosts(servers[0], log); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+
+	if err := r.reconcileSecret(ctx, log); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+	if err := errors.ErrorOrNil(); err != nil {
+		return requeue, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileSecret applies the certificates of the droptailer-client secret if it exists
+func (r *DroptailerReconciler) reconcileSecret(ctx context.Context, log logr.Logger) error {
 	var secrets corev1.SecretList
 	if err := r.List(ctx, &secrets, &client.ListOptions{Namespace: namespace}); err != nil {
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return client.IgnoreNotFound(err)
 	}
 
 	var droptailerSecret corev1.Secret
@@ -82,96 +140,290 @@ func (r *DroptailerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	}
 	if !secretFound {
 		log.Info("droptailer-secret not found")
-		return ctrl.Result{}, nil
+		return nil
 	}
 
 	log.Info("droptailer-secret", "name", droptailerSecret.Name)
-	err := r.writeSecret(droptailerSecret)
+	return r.applySecret(droptailerSecret, log)
+}
+
+// discoverServers returns the addresses of the ready endpoints of the services labeled as droptailer servers
+func (r *DroptailerReconciler) discoverServers(ctx context.Context) ([]string, error) {
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services, client.InNamespace(namespace), client.MatchingLabels{droptailer.ServiceLabel: droptailer.ServiceLabelValue}); err != nil {
+		return nil, fmt.Errorf("unable to list droptailer services: %w", err)
+	}
+	if len(services.Items) == 0 {
+		return nil, fmt.Errorf("no service with label %s=%s in namespace %s", droptailer.ServiceLabel, droptailer.ServiceLabelValue, namespace)
+	}
+
+	names := []string{}
+	endpoints := []corev1.Endpoints{}
+	for _, svc := range services.Items {
+		names = append(names, svc.Name)
+		var e corev1.Endpoints
+		if err := r.Get(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, &e); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get endpoints of droptailer service %s: %w", svc.Name, err)
+		}
+		endpoints = append(endpoints, e)
+	}
+	servers := droptailer.Servers(endpoints)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("droptailer services %s have no ready endpoints", strings.Join(names, ", "))
+	}
+	return servers, nil
+}
+
+func (r *DroptailerReconciler) setDiscovery(servers []string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.discovered = true
+	r.servers = servers
+	r.discoveryErr = err
+}
+
+// updateHosts points the hosts entry of the droptailer client on the host to the first server, it supports only one server
+func (r *DroptailerReconciler) updateHosts(server string, log logr.Logger) error {
+	ip, _, err := net.SplitHostPort(server)
 	if err != nil {
-		return requeue, err
+		return err
+	}
+	if ip == r.oldServerIP {
+		return nil
 	}
+	log.Info("droptailer server changed, update /etc/hosts", "old", r.oldServerIP, "new", ip)
+	r.hosts.RemoveHost("droptailer")
+	r.hosts.AddHost(ip, "droptailer")
+	if err := r.hosts.Save(); err != nil {
+		log.Error(err, "could not write droptailer hosts entry")
+		return fmt.Errorf("could not write droptailer hosts entry:%v", err)
+	}
+	r.oldServerIP = ip
+	return nil
+}
 
-	var pods corev1.PodList
-	if err := r.List(ctx, &pods, &client.ListOptions{Namespace: namespace}); err != nil {
-		return ctrl.Result{}, fmt.Errorf("no pod running in namespace %v", namespace)
+// updateDiscoveryCondition sets the condition DroptailerDiscovered of the firewall to the result of the last discovery
+func (r *DroptailerReconciler) updateDiscoveryCondition(f *firewallv1.Firewall) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.discovered {
+		return
+	}
+	if r.discoveryErr != nil {
+		f.Status.SetCondition(firewallv1.FirewallDroptailerDiscovered, firewallv1.ConditionFalse, "NotFound", r.discoveryErr.Error())
+		return
+	}
+	message := fmt.Sprintf("droptailer servers %s", strings.Join(r.servers, ", "))
+	if r.stream != nil {
+		if server := r.stream.Server(); server != "" {
+			message += fmt.Sprintf(", streaming to %s", server)
+		} else {
+			message += ", not connected"
+		}
 	}
+	f.Status.SetCondition(firewallv1.FirewallDroptailerDiscovered, firewallv1.ConditionTrue, "Discovered", message)
+}
 
-	var droptailerPod *corev1.Pod
-	for _, p := range pods.Items {
-		if strings.HasPrefix(p.Name, "droptailer") && p.Status.Phase == corev1.PodRunning {
-			droptailerPod = &p
-			break
+// updateCertificateStatus sets the validity of the client certificate in the status of the firewall,
+// it returns a warning once the certificate is about to expire, expired or is not yet valid
+func (r *DroptailerReconciler) updateCertificateStatus(f *firewallv1.Firewall, now time.Time) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := r.certificate
+	if c != nil {
+		f.Status.DroptailerCertificate = &firewallv1.CertificateStatus{
+			Subject:   c.Subject,
+			NotBefore: metav1.NewTime(c.NotBefore),
+			NotAfter:  metav1.NewTime(c.NotAfter),
+		}
+		if !c.CANotAfter.IsZero() {
+			caNotAfter := metav1.NewTime(c.CANotAfter)
+			f.Status.DroptailerCertificate.CANotAfter = &caNotAfter
 		}
 	}
-	if droptailerPod == nil {
-		return ctrl.Result{}, fmt.Errorf("droptailer server pod not found")
+	// the invalid secret is reported at the secret, the previous certificates are still in use
+	if r.certificateErr != nil {
+		f.Status.SetCondition(firewallv1.FirewallDroptailerCertificateValid, firewallv1.ConditionFalse, "Invalid", r.certificateErr.Error())
+		return nil
+	}
+	if c == nil {
+		return nil
 	}
 
-	podIP := droptailerPod.Status.PodIP
-	if podIP != "" && r.oldPodIP != podIP {
-		log.Info("podIP changed, update /etc/hosts", "old", r.oldPodIP, "new", podIP)
-		r.hosts.RemoveHost("droptailer")
-		r.hosts.AddHost(podIP, "droptailer")
-		err := r.hosts.Save()
-		if err != nil {
-			log.Error(err, "could not write droptailer hosts entry")
-			return requeue, fmt.Errorf("could not write droptailer hosts entry:%v", err)
-		}
-		r.oldPodIP = podIP
+	expiry := c.Expiry()
+	expiring := fmt.Sprintf("client certificate %s", c.Subject)
+	if !expiry.Equal(c.NotAfter) {
+		expiring = fmt.Sprintf("ca of the client certificate %s", c.Subject)
+	}
+	status := firewallv1.ConditionTrue
+	var reason, message string
+	switch {
+	case now.Before(c.NotBefore):
+		status, reason = firewallv1.ConditionFalse, "NotYetValid"
+		message = fmt.Sprintf("client certificate %s is not valid before %s", c.Subject, c.NotBefore.Format(time.RFC3339))
+	case !now.Before(expiry):
+		status, reason = firewallv1.ConditionFalse, "Expired"
+		message = fmt.Sprintf("%s expired at %s", expiring, expiry.Format(time.RFC3339))
+	case expiry.Sub(now) < r.ExpiryWarning:
+		reason = "Expiring"
+		message = fmt.Sprintf("%s expires at %s", expiring, expiry.Format(time.RFC3339))
+	default:
+		reason = "Valid"
+		message = fmt.Sprintf("client certificate %s is valid until %s", c.Subject, expiry.Format(time.RFC3339))
 	}
+	f.Status.SetCondition(firewallv1.FirewallDroptailerCertificateValid, status, reason, message)
 
-	return ctrl.Result{}, nil
+	// every certificate is warned about once per reason
+	warned := reason + " " + expiry.String()
+	if reason == "Valid" || warned == r.certificateWarned {
+		return nil
+	}
+	r.certificateWarned = warned
+	return []string{message}
 }
 
-func (r *DroptailerReconciler) writeSecret(secret corev1.Secret) error {
+// applySecret validates the certificates of the secret and writes those which changed,
+// the drop forwarder is signaled to reload them afterwards.
+// The certificates of an invalid secret are not written, it is reported at the secret.
+func (r *DroptailerReconciler) applySecret(secret corev1.Secret, log logr.Logger) error {
 	keys := []string{secretKeyCaCertificate, secretKeyCertificate, secretKeyCertificateKey}
-	certificateBase := defaultCertificateBase
-	if r.certificateBase != "" {
-		certificateBase = r.certificateBase
-	}
+	data := map[string][]byte{}
 	for _, k := range keys {
 		v, ok := secret.Data[k]
 		if !ok {
-			return fmt.Errorf("could not find key in secret key:%s", k)
+			r.setCertificate(&secret, nil, fmt.Errorf("could not find key in secret key:%s", k))
+			return nil
 		}
-		f := path.Join(certificateBase, k)
-		err := ioutil.WriteFile(f, v, 0640)
-		if err != nil {
+		data[k] = v
+	}
+	cert, err := droptailer.ParseCertificate(data[secretKeyCaCertificate], data[secretKeyCertificate], data[secretKeyCertificateKey])
+	r.setCertificate(&secret, cert, err)
+	if err != nil {
+		return nil
+	}
+
+	// the key is written first and the ca last, a consumer which reads the files before the reload
+	// never trusts a new ca without the matching certificate and key
+	changed := false
+	for _, k := range []string{secretKeyCertificateKey, secretKeyCertificate, secretKeyCaCertificate} {
+		f := r.certificateFile(k)
+		if current, err := ioutil.ReadFile(f); err == nil && bytes.Equal(current, data[k]) {
+			continue
+		}
+		// only the owner may read the key
+		perm := os.FileMode(0640)
+		if k == secretKeyCertificateKey {
+			perm = 0600
+		}
+		if err := helper.WriteFile(f, data[k], perm); err != nil {
 			return fmt.Errorf("could not write secret to certificate base folder:%v", err)
 		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	log.Info("droptailer certificates changed, reloading", "subject", cert.Subject, "notAfter", cert.NotAfter)
+	if r.stream != nil {
+		r.stream.ReloadCertificates()
+		return nil
+	}
+	return droptailer.RestartHostClient()
+}
+
+// setCertificate stores the result of the validation of the secret, a new error is reported at the secret
+func (r *DroptailerReconciler) setCertificate(secret *corev1.Secret, cert *droptailer.Certificate, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err != nil {
+		if r.certificateErr == nil || r.certificateErr.Error() != err.Error() {
+			r.recorder.Event(secret, "Warning", "InvalidCertificate", fmt.Sprintf("certificates are not applied: %v", err))
+		}
+		r.certificateErr = err
+		return
+	}
+	r.certificate = cert
+	r.certificateErr = nil
+}
+
+// certificateFile returns the file a key of the droptailer-client secret is written to
+func (r *DroptailerReconciler) certificateFile(key string) string {
+	certificateBase := defaultCertificateBase
+	if r.certificateBase != "" {
+		certificateBase = r.certificateBase
+	}
+	return path.Join(certificateBase, key)
+}
+
+// configureCertificateBase overrides the directory the certificates are written to by the environment
+func (r *DroptailerReconciler) configureCertificateBase() {
+	if certificateBase := os.Getenv(certificateBaseEnv); certificateBase != "" {
+		r.certificateBase = certificateBase
 	}
-	return nil
 }
 
 // SetupWithManager configure this controller with required defaults
 func (r *DroptailerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	hc := &txeh.HostsConfig{
-		ReadFilePath:  r.HostsFile,
-		WriteFilePath: r.HostsFile,
-	}
+	r.recorder = mgr.GetEventRecorderFor("DroptailerController")
 
-	_, err := os.Stat(r.HostsFile)
-	if os.IsNotExist(err) {
-		empty, err := os.Create(r.HostsFile)
-		if err != nil {
-			return err
+	// the servers are handed to the stream directly, only the droptailer client on the host requires the hosts entry
+	if !r.StreamDrops {
+		hc := &txeh.HostsConfig{
+			ReadFilePath:  r.HostsFile,
+			WriteFilePath: r.HostsFile,
 		}
-		empty.Close()
-	}
 
-	hosts, err := txeh.NewHosts(hc)
-	if err != nil {
-		return fmt.Errorf("unable to create hosts editor:%w", err)
+		_, err := os.Stat(r.HostsFile)
+		if os.IsNotExist(err) {
+			empty, err := os.Create(r.HostsFile)
+			if err != nil {
+				return err
+			}
+			empty.Close()
+		}
+
+		hosts, err := txeh.NewHosts(hc)
+		if err != nil {
+			return fmt.Errorf("unable to create hosts editor:%w", err)
+		}
+		r.hosts = hosts
 	}
 
-	r.hosts = hosts
-	certificateBase := os.Getenv("DROPTAILER_CLIENT_CERTIFICATE_BASE")
+	r.configureCertificateBase()
 
-	if certificateBase == "" {
-		r.certificateBase = certificateBase
+	if r.StreamDrops {
+		config := droptailer.Config{
+			Group:       r.DropLogGroup,
+			CA:          r.certificateFile(secretKeyCaCertificate),
+			Certificate: r.certificateFile(secretKeyCertificate),
+			Key:         r.certificateFile(secretKeyCertificateKey),
+		}
+		if r.Drops != nil {
+			config.Observer = r.Drops
+		}
+		r.stream = droptailer.NewClient(config, r.Log.WithName("stream"))
+		if err := mgr.Add(manager.RunnableFunc(r.stream.Run)); err != nil {
+			return fmt.Errorf("unable to stream dropped packets: %w", err)
+		}
 	}
 
-	genericPredicate := predicate.Funcs{
+	namespacePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return e.Meta.GetNamespace() == namespace
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.MetaNew.GetNamespace() == namespace
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return e.Meta.GetNamespace() == namespace
+		},
 		GenericFunc: func(e event.GenericEvent) bool {
 			return e.Meta.GetNamespace() == namespace
 		},
@@ -191,7 +443,10 @@ func (r *DroptailerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Pod{}, builder.WithPredicates(genericPredicate)).
+		Named("droptailer").
+		For(&corev1.Service{}).
+		Watches(&source.Kind{Type: &corev1.Endpoints{}}, triggerDroptailerReconcilation).
 		Watches(&source.Kind{Type: &corev1.Secret{}}, triggerDroptailerReconcilation).
+		WithEventFilter(namespacePredicate).
 		Complete(r)
 }
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigureCertificateBase(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{
+			name: "default",
+			want: "/etc/droptailer-client/ca.crt",
+		},
+		{
+			name: "overridden by the environment",
+			env:  "/tmp/droptailer-client",
+			want: "/tmp/droptailer-client/ca.crt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(certificateBaseEnv, tt.env)
+			defer os.Unsetenv(certificateBaseEnv)
+
+			r := &DroptailerReconciler{}
+			r.configureCertificateBase()
+			if got := r.certificateFile(secretKeyCaCertificate); got != tt.want {
+				t.Errorf("certificateFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
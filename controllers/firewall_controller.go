@@ -20,22 +20,34 @@ import (
 	"context"
 	"crypto/rsa"
 	"fmt"
+	"hash/fnv"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -44,6 +56,7 @@ import (
 
 	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
 	"github.com/metal-stack/firewall-controller/pkg/collector"
+	"github.com/metal-stack/firewall-controller/pkg/flowexport"
 	"github.com/metal-stack/firewall-controller/pkg/network"
 	"github.com/metal-stack/firewall-controller/pkg/nftables"
 	"github.com/metal-stack/firewall-controller/pkg/suricata"
@@ -55,12 +68,52 @@ import (
 // FirewallReconciler reconciles a Firewall object
 type FirewallReconciler struct {
 	client.Client
-	recorder             record.EventRecorder
-	Log                  logr.Logger
-	Scheme               *runtime.Scheme
-	EnableIDS            bool
-	EnableSignatureCheck bool
-	CAPubKey             *rsa.PublicKey
+	recorder                  record.EventRecorder
+	Log                       logr.Logger
+	Scheme                    *runtime.Scheme
+	EnableIDS                 bool
+	EnableSignatureCheck      bool
+	EnableIngressSourceRanges bool
+	CAPubKey                  *rsa.PublicKey
+	MetricsPort               int32
+	CountersFile              string
+	RuleUsageFile             string
+	MonitorInterval           time.Duration
+	ConntrackThreshold        int
+	SNATThreshold             int
+	TopTalkers                int
+	UnusedRulePeriod          time.Duration
+	AnalysisInterval          time.Duration
+	IDSEVEOutput              string
+	IDSRulesStateFile         string
+	AutoBlockStateFile        string
+	IPSQueue                  uint16
+	StreamDrops               bool
+	DropLogGroup              uint16
+	Droptailer                *DroptailerReconciler
+	Drops                     *collector.DropAggregator
+	monitorUpdated            time.Time
+	metrics                   *collector.FirewallMetrics
+	counters                  *collector.CounterAccumulator
+	rates                     *collector.RateCalculator
+	conntrack                 *collector.ConntrackThresholds
+	flows                     *flowexport.Exporter
+	analyzer                  *collector.Analyzer
+	sources                   *nftables.FlowSources
+	alerts                    *suricata.AlertAggregator
+	rules                     *suricata.RuleManager
+	idsConfig                 *suricata.ConfigManager
+	ips                       *suricata.IPS
+	blocker                   *suricata.Blocker
+	// ipsInspected is true if connections are sent to the inline IPS
+	ipsInspected bool
+	// frrChanged is the time frr.conf was last changed, it is reset once all bgp sessions are established
+	frrChanged time.Time
+	bgpWarned  bool
+	// serviceWarnings are the invalid annotations and their error of the services which were warned about last
+	serviceWarnings map[types.UID]string
+	// ingressWarnings are the errors of the Ingresses and Gateways with invalid source ranges which were warned about last
+	ingressWarnings map[types.UID]string
 }
 
 const (
@@ -75,16 +128,55 @@ const (
 	nodeExporterNamedPort     = "nftexporter"
 	nodeExporterPort          = 9630
 	exporterLabelKey          = "app"
+
+	controllerMetricsService   = "firewall-controller"
+	controllerMetricsNamedPort = "metrics"
 )
 
-var done = ctrl.Result{}
+const (
+	// DefaultMonitorInterval is the default minimum interval between two updates of the firewall monitor
+	DefaultMonitorInterval = time.Second * 30
+	// DefaultConntrackThreshold is the default usage of the conntrack table in percent which triggers a warning
+	DefaultConntrackThreshold = 80
+	// DefaultSNATThreshold is the default usage of the ports of a source nat address in percent which triggers a warning
+	DefaultSNATThreshold = 80
+	// bgpConvergencePeriod is the time the bgp sessions are given to come up after frr.conf was changed
+	bgpConvergencePeriod = time.Minute
+	// idsAlertsInMonitor is the number of the most frequent IDS alerts in the firewall monitor
+	idsAlertsInMonitor = 100
+	// maxAlertEvents limits the events for IDS alerts per reconcilation, further alerts are reported later
+	maxAlertEvents = 10
+	// alertEventCooldown is the minimum time between two events for the same IDS alert
+	alertEventCooldown = 10 * time.Minute
+	// maxBlockEvents limits the events for blocked sources per reconcilation
+	maxBlockEvents = 10
+)
+
+var (
+	done = ctrl.Result{}
+	// gatewayListGVKs are the served versions of the Gateway API in order of preference, the first installed one is read
+	gatewayListGVKs = []schema.GroupVersionKind{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "GatewayList"},
+		{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "GatewayList"},
+	}
+)
 
 // Reconcile reconciles a firewall by:
 // - reading ClusterwideNetworkPolicies and Services of type Loadbalancer
 // - rendering nftables rules
-// - updating the firewall object with nftable rule statistics grouped by action
+// - updating the firewall status with a summary and the firewall monitor with nftable rule statistics grouped by action
 // +kubebuilder:rbac:groups=metal-stack.io,resources=firewalls,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=metal-stack.io,resources=firewalls/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=metal-stack.io,resources=clusterwidenetworkpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal-stack.io,resources=clusterwidenetworkpolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=metal-stack.io,resources=firewallmonitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 func (r *FirewallReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("firewall", req.NamespacedName)
@@ -96,6 +188,8 @@ func (r *FirewallReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	if err := r.Get(ctx, req.NamespacedName, &f); err != nil {
 		if apierrors.IsNotFound(err) {
 			defaultFw := nftables.NewDefaultFirewall(nil)
+			defaultFw.SetReloadObserver(r.counters)
+			r.flows.Stop()
 			log.Info("flushing k8s firewall rules")
 			err := defaultFw.Flush()
 			if err == nil {
@@ -134,6 +228,8 @@ func (r *FirewallReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	log.Info("reconciling network settings")
 	changed, err := network.ReconcileNetwork(f, log)
 	if changed && err == nil {
+		r.frrChanged = time.Now()
+		r.bgpWarned = false
 		r.recorder.Event(&f, "Normal", "Network settings", "reconcilation succeeded (frr.conf)")
 	} else if changed && err != nil {
 		r.recorder.Event(&f, "Warning", "Network settings", fmt.Sprintf("reconcilation failed (frr.conf): %v", err))
@@ -143,11 +239,38 @@ func (r *FirewallReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		errors = multierror.Append(errors, err)
 	}
 
+	if r.idsConfig != nil {
+		log.Info("reconciling ids settings")
+		changed, err := r.idsConfig.Reconcile(f)
+		if changed && err == nil {
+			r.recorder.Event(&f, "Normal", "IDS settings", "reconcilation succeeded (suricata)")
+		} else if changed && err != nil {
+			r.recorder.Event(&f, "Warning", "IDS settings", fmt.Sprintf("reconcilation failed (suricata): %v", err))
+		}
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
 	log.Info("reconciling firewall services")
 	if err = r.reconcileFirewallServices(ctx, f, log); err != nil {
 		errors = multierror.Append(errors, err)
 	}
 
+	if r.rules != nil {
+		log.Info("reconciling ids ruleset")
+		if err = r.reconcileIDSRules(ctx, f); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	if r.blocker != nil {
+		log.Info("reconciling auto block")
+		if err = r.reconcileAutoBlock(f); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
 	log.Info("updating status field")
 	if err = r.updateStatus(ctx, f, log); err != nil {
 		errors = multierror.Append(errors, err)
@@ -244,14 +367,148 @@ func (r *FirewallReconciler) reconcileRules(ctx context.Context, f firewallv1.Fi
 		return err
 	}
 
-	nftablesFirewall := nftables.NewFirewall(&clusterNPs, &services, f.Spec, log)
+	r.warnInvalidServices(services.Items)
+
+	var nodes v1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return err
+	}
+
+	var ingressRestrictions []nftables.IngressSourceRestriction
+	if r.EnableIngressSourceRanges {
+		restrictions, err := r.ingressSourceRestrictions(ctx)
+		if err != nil {
+			return err
+		}
+		ingressRestrictions = restrictions
+		r.warnInvalidIngressSources(restrictions)
+	}
+
+	if r.Drops != nil {
+		r.Drops.SetTargets(f.Spec.FirewallNetworks, services.Items)
+	}
+
+	nftablesFirewall := nftables.NewFirewall(&clusterNPs, &services, &nodes, ingressRestrictions, f.Spec, log)
+	nftablesFirewall.SetReloadObserver(r.counters)
+	if r.ips != nil {
+		nftablesFirewall.SetIPSQueue(r.ips.Queue())
+	}
+	if r.StreamDrops {
+		nftablesFirewall.SetDropLogGroup(r.DropLogGroup)
+	}
 	if err := nftablesFirewall.Reconcile(); err != nil {
 		return err
 	}
 
+	if r.ips != nil {
+		r.ipsInspected = nftablesFirewall.IPSInspected() && !f.Spec.DryRun
+		if err := r.ips.Reconcile(r.ipsInspected); err != nil {
+			return fmt.Errorf("unable to reconcile inline ips: %w", err)
+		}
+	}
+
+	flowExport := f.Spec.FlowExport
+	if f.Spec.DryRun {
+		flowExport = nil
+	}
+	r.sources = nftablesFirewall.FlowSources()
+	if err := r.flows.Update(flowExport, r.sources); err != nil {
+		return fmt.Errorf("unable to export flows: %w", err)
+	}
+
 	return nil
 }
 
+// warnInvalidServices records a warning event for the services with invalid firewall annotations,
+// the event is recorded once until the annotations or the error change
+func (r *FirewallReconciler) warnInvalidServices(services []v1.Service) {
+	warnings := map[types.UID]string{}
+	for i := range services {
+		svc := services[i]
+		err := nftables.ValidateServiceAnnotations(svc)
+		if err == nil {
+			continue
+		}
+		warning := fmt.Sprintf("%x %v", annotationsHash(svc.Annotations), err)
+		warnings[svc.UID] = warning
+		if r.serviceWarnings[svc.UID] == warning {
+			continue
+		}
+		r.recorder.Event(&svc, "Warning", "Unapplicable", fmt.Sprintf("firewall annotations of the service are not valid and are ignored: %v", err))
+	}
+	r.serviceWarnings = warnings
+}
+
+// warnInvalidIngressSources records a warning event for the Ingresses and Gateways with invalid source ranges,
+// the event is recorded once until the error changes
+func (r *FirewallReconciler) warnInvalidIngressSources(restrictions []nftables.IngressSourceRestriction) {
+	warnings := map[types.UID]string{}
+	objects := map[types.UID]*corev1.ObjectReference{}
+	for _, restriction := range restrictions {
+		if restriction.Invalid == "" {
+			continue
+		}
+		uid := types.UID(restriction.Source.UID)
+		if w, ok := warnings[uid]; ok && strings.Contains(w, restriction.Invalid) {
+			continue
+		}
+		if w, ok := warnings[uid]; ok {
+			warnings[uid] = w + ", " + restriction.Invalid
+		} else {
+			warnings[uid] = restriction.Invalid
+		}
+		objects[uid] = &corev1.ObjectReference{
+			Kind:      restriction.Source.Kind,
+			Namespace: restriction.Source.Namespace,
+			Name:      restriction.Source.Name,
+			UID:       uid,
+		}
+	}
+	for uid, warning := range warnings {
+		if r.ingressWarnings[uid] == warning {
+			continue
+		}
+		r.recorder.Event(objects[uid], "Warning", "Unapplicable", fmt.Sprintf("source ranges are not valid and are rejected: %s", warning))
+	}
+	r.ingressWarnings = warnings
+}
+
+// annotationsHash returns a hash of the annotations which does not depend on their order
+func annotationsHash(annotations map[string]string) uint64 {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, annotations[k])
+	}
+	return h.Sum64()
+}
+
+// ingressSourceRestrictions reads the source restrictions of Ingresses and Gateways, Gateways are skipped if the Gateway API is not installed
+func (r *FirewallReconciler) ingressSourceRestrictions(ctx context.Context) ([]nftables.IngressSourceRestriction, error) {
+	var ingresses networkingv1beta1.IngressList
+	if err := r.List(ctx, &ingresses); err != nil {
+		return nil, err
+	}
+
+	for _, gvk := range gatewayListGVKs {
+		gateways := &unstructured.UnstructuredList{}
+		gateways.SetGroupVersionKind(gvk)
+		if err := r.List(ctx, gateways); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		return nftables.IngressSourceRestrictions(&ingresses, gateways), nil
+	}
+
+	return nftables.IngressSourceRestrictions(&ingresses, nil), nil
+}
+
 type firewallService struct {
 	name      string
 	port      int32
@@ -273,6 +530,14 @@ func (r *FirewallReconciler) reconcileFirewallServices(ctx context.Context, f fi
 		},
 	}
 
+	if r.MetricsPort > 0 {
+		services = append(services, firewallService{
+			name:      controllerMetricsService,
+			port:      r.MetricsPort,
+			namedPort: controllerMetricsNamedPort,
+		})
+	}
+
 	var errors *multierror.Error
 	for _, s := range services {
 		err := r.reconcileFirewallService(ctx, s, f, log)
@@ -394,61 +659,425 @@ func (r *FirewallReconciler) reconcileFirewallService(ctx context.Context, s fir
 	return nil
 }
 
-// updateStatus updates the status field for this firewall
+// updateStatus updates the status field for this firewall with a summary of the runtime data,
+// the runtime data itself is written to the FirewallMonitor of the firewall
 func (r *FirewallReconciler) updateStatus(ctx context.Context, f firewallv1.Firewall, log logr.Logger) error {
-	if f.Spec.DryRun {
-		f.Status.FirewallStats = firewallv1.FirewallStats{
-			RuleStats:   firewallv1.RuleStatsByAction{},
-			DeviceStats: firewallv1.DeviceStatsByDevice{},
-			IDSStats:    firewallv1.IDSStatsByDevice{},
+	stats, err := r.collectStats(f)
+	if err != nil {
+		return err
+	}
+	if r.EnableIDS { // checks the CLI-flag
+		r.collectIDSStats(&f, &stats)
+	}
+	if r.Droptailer != nil {
+		r.Droptailer.updateDiscoveryCondition(&f)
+		for _, warning := range r.Droptailer.updateCertificateStatus(&f, time.Now()) {
+			r.recorder.Event(&f, "Warning", "DroptailerCertificate", warning)
 		}
-		f.Status.Updated.Time = time.Now()
-		if err := r.Status().Update(ctx, &f); err != nil {
-			return fmt.Errorf("unable to update firewall status, err: %w", err)
+		r.metrics.UpdateDroptailerCertificate(f.Status.DroptailerCertificate)
+	}
+
+	f.Status.Updated.Time = time.Now()
+	if !f.Spec.DryRun {
+		r.rates.Update(&stats, f.Status.Updated.Time)
+		// the analysis is optional, the top talkers are missing if the connections cannot be listed
+		if err := r.analyzer.Analyze(&stats, r.sources, f.Spec.EgressRules, f.Status.Updated.Time); err != nil {
+			log.Error(err, "unable to analyze traffic")
 		}
-		return nil
 	}
+	r.metrics.Update(stats)
 
-	c := collector.NewNFTablesCollector(&r.Log)
-	ruleStats := c.CollectRuleStats()
+	f.Status.Summary = firewallv1.FirewallSummary{
+		Rules:      stats.RuleStats.Count(),
+		Rates:      stats.Rates,
+		LastReload: stats.LastReload,
+	}
+	// the deprecated statistics only contain the fields of the status before the monitor, the runtime data is in the monitor
+	f.Status.FirewallStats = &firewallv1.FirewallStats{
+		RuleStats:   stats.RuleStats,
+		DeviceStats: stats.DeviceStats,
+		IDSStats:    stats.IDSStats,
+	}
+	f.Status.IPS = stats.IPSQueue
+	if stats.Conntrack != nil {
+		conntrackUsage, snatUsage := collector.ConntrackUsage(stats.Conntrack)
+		f.Status.Summary.ConntrackUsage = &conntrackUsage
+		f.Status.Summary.SNATUsage = &snatUsage
+	}
+	for _, warning := range r.conntrack.Check(stats.Conntrack) {
+		r.recorder.Event(&f, "Warning", "Conntrack", warning)
+	}
+	r.updateBGPStatus(&f, &stats, log)
+	if r.alerts != nil {
+		r.publishAlerts(ctx, &f, &stats, log)
+	}
+	if r.rules != nil {
+		r.updateIDSRulesStatus(&f)
+	}
+	if r.blocker != nil {
+		f.Status.AutoBlock = r.blocker.Status()
+		stats.AutoBlocked = r.blocker.Blocked()
+	}
+	if r.Drops != nil {
+		r.publishDrops(ctx, &f, log)
+	}
+	r.updateMonitor(ctx, &f, stats, log)
 
-	f.Status.FirewallStats = firewallv1.FirewallStats{
-		RuleStats: ruleStats,
+	if err := r.Status().Update(ctx, &f); err != nil {
+		return fmt.Errorf("unable to update firewall status, err: %w", err)
 	}
+
+	if !f.Spec.DryRun {
+		r.updatePolicyStatus(ctx, f, stats.RuleStats, log)
+	}
+	return nil
+}
+
+// collectStats collects the rule, device and link statistics, a firewall in dry run mode has no statistics
+func (r *FirewallReconciler) collectStats(f firewallv1.Firewall) (firewallv1.FirewallStats, error) {
+	stats := firewallv1.FirewallStats{
+		RuleStats:   firewallv1.RuleStatsByAction{},
+		DeviceStats: firewallv1.DeviceStatsByDevice{},
+		IDSStats:    firewallv1.IDSStatsByDevice{},
+	}
+	if f.Spec.DryRun {
+		return stats, nil
+	}
+
+	c := collector.NewNFTablesCollector(&r.Log)
+	stats.RuleStats = c.CollectRuleStats()
 	deviceStats, err := c.CollectDeviceStats()
 	if err != nil {
-		return err
+		return stats, err
 	}
-	f.Status.FirewallStats.DeviceStats = deviceStats
+	stats.DeviceStats = deviceStats
+	r.counters.Accumulate(&stats)
 
-	idsStats := firewallv1.IDSStatsByDevice{}
-	if r.EnableIDS { // checks the CLI-flag
-		s := suricata.New()
-		ss, err := s.InterfaceStats()
+	// conntrack statistics are optional, they are not available if connection tracking is not loaded yet
+	conntrack, err := collector.CollectConntrackStats(f.Spec.EgressRules)
+	if err != nil {
+		r.Log.Error(err, "unable to collect conntrack statistics")
+	}
+	stats.Conntrack = conntrack
+
+	links, err := collector.CollectLinkStats(f.Spec.FirewallNetworks)
+	if err != nil {
+		r.Log.Error(err, "unable to collect link statistics")
+	}
+	stats.Links = links
+
+	if r.ipsInspected {
+		queue, err := collector.CollectIPSQueueStats(r.ips.Queue())
 		if err != nil {
-			return err
+			r.Log.Error(err, "unable to collect ips queue statistics")
+		}
+		stats.IPSQueue = queue
+	}
+	return stats, nil
+}
+
+// collectIDSStats collects the statistics and the state of suricata.
+// An unreachable suricata is reported with the IDSHealthy condition instead of failing the status update.
+func (r *FirewallReconciler) collectIDSStats(f *firewallv1.Firewall, stats *firewallv1.FirewallStats) {
+	s := suricata.New()
+	engine, err := s.EngineStats()
+	if err != nil {
+		f.Status.IDS = &firewallv1.IDSStatus{}
+		r.metrics.UpdateIDS(f.Status.IDS)
+		f.Status.SetCondition(firewallv1.FirewallIDSHealthy, firewallv1.ConditionFalse, "Unreachable", err.Error())
+		return
+	}
+	f.Status.IDS = &firewallv1.IDSStatus{
+		Running:        true,
+		Version:        engine.Version,
+		Uptime:         metav1.Duration{Duration: engine.Uptime},
+		KernelPackets:  engine.Counters["capture.kernel_packets"],
+		KernelDrops:    engine.Counters["capture.kernel_drops"],
+		DecoderInvalid: engine.Counters["decoder.invalid"],
+		MemcapHits:     engine.MemcapHits(),
+	}
+	stats.IDSCounters = engine.Counters
+	r.metrics.UpdateIDS(f.Status.IDS)
+
+	ss, err := s.InterfaceStats()
+	if err != nil {
+		f.Status.SetCondition(firewallv1.FirewallIDSHealthy, firewallv1.ConditionFalse, "QueryFailed", fmt.Sprintf("unable to query interface statistics: %v", err))
+		return
+	}
+	for iface, stat := range *ss {
+		stats.IDSStats[iface] = firewallv1.InterfaceStat{
+			Drop:             stat.Drop,
+			InvalidChecksums: stat.InvalidChecksums,
+			Packets:          stat.Pkts,
+		}
+	}
+	f.Status.SetCondition(firewallv1.FirewallIDSHealthy, firewallv1.ConditionTrue, "Running", fmt.Sprintf("suricata %s is running", engine.Version))
+}
+
+// updateMonitor writes the runtime data to the FirewallMonitor owned by the firewall, at most once per monitor interval.
+// The outcome is reported by the MonitorUpdated condition of the firewall, a failure does not fail the reconcilation.
+func (r *FirewallReconciler) updateMonitor(ctx context.Context, f *firewallv1.Firewall, stats firewallv1.FirewallStats, log logr.Logger) {
+	if !r.monitorUpdated.IsZero() && f.Status.Updated.Time.Sub(r.monitorUpdated) < r.MonitorInterval {
+		return
+	}
+
+	mon := &firewallv1.FirewallMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      f.Name,
+			Namespace: f.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, mon, func() error {
+		mon.Stats = stats
+		mon.Updated = f.Status.Updated
+		return controllerutil.SetControllerReference(f, mon, r.Scheme)
+	})
+	if err != nil {
+		log.Error(err, "unable to update firewall monitor")
+		f.Status.SetCondition(firewallv1.FirewallMonitorUpdated, firewallv1.ConditionFalse, "UpdateFailed", err.Error())
+		return
+	}
+
+	r.monitorUpdated = f.Status.Updated.Time
+	f.Status.SetCondition(firewallv1.FirewallMonitorUpdated, firewallv1.ConditionTrue, "Updated", fmt.Sprintf("runtime data written to firewallmonitor %s", mon.Name))
+}
+
+// updateBGPStatus counts the bgp sessions of FRR in the firewall status and writes the sessions to the statistics of the firewall monitor,
+// sessions which are down are reported by the BGPEstablished condition.
+// After frr.conf was changed the sessions are given some time to come up, a warning is emitted if they are still down afterwards.
+func (r *FirewallReconciler) updateBGPStatus(f *firewallv1.Firewall, stats *firewallv1.FirewallStats, log logr.Logger) {
+	neighbors, err := network.BGPNeighbors()
+	r.metrics.UpdateBGP(neighbors)
+	stats.BGPNeighbors = neighbors
+	if err != nil {
+		f.Status.BGP = nil
+		log.Error(err, "unable to query bgp status")
+		f.Status.SetCondition(firewallv1.FirewallBGPEstablished, firewallv1.ConditionUnknown, "QueryFailed", err.Error())
+		return
+	}
+	status := network.SummarizeBGP(neighbors)
+	f.Status.BGP = status
+
+	down := network.DownBGPNeighbors(neighbors)
+	if len(down) == 0 {
+		r.frrChanged = time.Time{}
+		f.Status.SetCondition(firewallv1.FirewallBGPEstablished, firewallv1.ConditionTrue, "Established", fmt.Sprintf("%d of %d sessions established", status.Established, status.Total))
+		return
+	}
+
+	peers := []string{}
+	for _, n := range down {
+		peers = append(peers, fmt.Sprintf("%s/%s/%s (%s)", n.VRF, n.AddressFamily, n.Peer, n.State))
+	}
+	message := fmt.Sprintf("%d of %d sessions down: %s", len(down), status.Total, strings.Join(peers, ", "))
+
+	switch {
+	case r.frrChanged.IsZero():
+		f.Status.SetCondition(firewallv1.FirewallBGPEstablished, firewallv1.ConditionFalse, "SessionDown", message)
+	case time.Since(r.frrChanged) < bgpConvergencePeriod:
+		f.Status.SetCondition(firewallv1.FirewallBGPEstablished, firewallv1.ConditionUnknown, "Converging", message)
+	default:
+		f.Status.SetCondition(firewallv1.FirewallBGPEstablished, firewallv1.ConditionFalse, "SessionDownAfterConfigChange", message)
+		if !r.bgpWarned {
+			r.recorder.Event(f, "Warning", "BGP", fmt.Sprintf("sessions down after frr.conf change: %s", message))
+			r.bgpWarned = true
+		}
+	}
+}
+
+// publishAlerts counts the IDS alerts in the firewall status, writes the most frequent alerts to the statistics of the firewall monitor
+// and reports new alerts as events on the attacked service or the firewall.
+// The events are rate limited, so an alert storm does not flood the API server.
+func (r *FirewallReconciler) publishAlerts(ctx context.Context, f *firewallv1.Firewall, stats *firewallv1.FirewallStats, log logr.Logger) {
+	now := time.Now()
+	f.Status.IDSAlerts = r.alerts.Summary()
+	stats.IDSAlerts = r.alerts.Top(idsAlertsInMonitor, now)
+
+	alerts, suppressed := r.alerts.Pending(maxAlertEvents, alertEventCooldown, now)
+	if len(alerts) == 0 && suppressed == 0 {
+		return
+	}
+	services, err := r.servicesByIP(ctx)
+	if err != nil {
+		log.Error(err, "unable to list services for ids alerts")
+	}
+	for _, a := range alerts {
+		var obj runtime.Object = f
+		if svc, ok := services[a.Destination]; ok {
+			obj = svc
+		}
+		r.recorder.Eventf(obj, "Warning", "IDSAlert", "%s (sid %d, severity %d) from %s to %s, %d times", a.Signature, a.SignatureID, a.Severity, a.Source, a.Destination, a.Count)
+	}
+	if suppressed > 0 {
+		r.recorder.Eventf(f, "Warning", "IDSAlert", "%d further alerts are reported later to limit the events", suppressed)
+	}
+}
+
+// publishDrops sets the summary of the dropped packets and warns at the services whose traffic to the load balancer ip is dropped at a significant rate
+func (r *FirewallReconciler) publishDrops(ctx context.Context, f *firewallv1.Firewall, log logr.Logger) {
+	now := time.Now()
+	f.Status.Drops = r.Drops.Summary(now)
+
+	for _, d := range r.Drops.Check(now) {
+		var svc corev1.Service
+		if err := r.Get(ctx, types.NamespacedName{Namespace: d.Namespace, Name: d.Name}, &svc); err != nil {
+			log.Error(err, "unable to get service for dropped packets", "service", d.Namespace+"/"+d.Name)
+			continue
+		}
+		r.recorder.Eventf(&svc, "Warning", "TrafficDropped", "%.1f packets per second to the load balancer ip were dropped within the last %s, mostly from %s, loadBalancerSourceRanges may be missing",
+			d.Rate, f.Status.Drops.Window.Duration, strings.Join(d.Sources, ", "))
+	}
+}
+
+// reconcileIDSRules applies the ruleset of the firewall spec extended by the referenced ConfigMaps to suricata.
+// ConfigMaps are not watched, changes are picked up with the reconcile interval.
+func (r *FirewallReconciler) reconcileIDSRules(ctx context.Context, f firewallv1.Firewall) error {
+	if f.Spec.IDS == nil {
+		return r.rules.Reconcile(nil)
+	}
+	ruleset := f.Spec.IDS.DeepCopy()
+	ruleset.ConfigMaps = nil
+	for _, name := range f.Spec.IDS.ConfigMaps {
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, types.NamespacedName{Namespace: f.Namespace, Name: name}, &cm); err != nil {
+			return fmt.Errorf("unable to get ids ruleset configmap %s: %w", name, err)
+		}
+		if err := suricata.MergeRuleset(ruleset, cm.Data); err != nil {
+			return fmt.Errorf("invalid ids ruleset configmap %s: %w", name, err)
+		}
+	}
+	return r.rules.Reconcile(ruleset)
+}
+
+// updateIDSRulesStatus reports the state of the ruleset, the condition is only set if a ruleset is configured
+func (r *FirewallReconciler) updateIDSRulesStatus(f *firewallv1.Firewall) {
+	f.Status.IDSRules = r.rules.Status()
+	if f.Status.IDSRules == nil {
+		return
+	}
+	if f.Status.IDSRules.Error != "" {
+		f.Status.SetCondition(firewallv1.FirewallIDSRulesLoaded, firewallv1.ConditionFalse, "LoadFailed", f.Status.IDSRules.Error)
+		return
+	}
+	f.Status.SetCondition(firewallv1.FirewallIDSRulesLoaded, firewallv1.ConditionTrue, "Loaded",
+		fmt.Sprintf("%d rules loaded, %d rules failed", f.Status.IDSRules.Loaded, f.Status.IDSRules.Failed))
+}
+
+// reconcileAutoBlock blocks the sources of the IDS alerts with the configured severity in the auto_block set of nftables.
+// The internal prefixes and the prefixes of the private and underlay networks are never blocked.
+func (r *FirewallReconciler) reconcileAutoBlock(f firewallv1.Firewall) error {
+	allowed := append([]string{}, f.Spec.InternalPrefixes...)
+	for _, n := range f.Spec.FirewallNetworks {
+		if n.Networktype != nil && *n.Networktype != mn.External {
+			allowed = append(allowed, n.Prefixes...)
+		}
+	}
+	if err := r.blocker.Configure(f.Spec.AutoBlock, allowed); err != nil {
+		return fmt.Errorf("invalid auto block configuration: %w", err)
+	}
+	if f.Spec.AutoBlock == nil || f.Spec.DryRun {
+		return nil
+	}
+
+	now := time.Now()
+	blocked := r.blocker.Update(r.alerts.Alerts(now), now)
+	for i, b := range blocked {
+		if i == maxBlockEvents {
+			r.recorder.Eventf(&f, "Warning", "AutoBlock", "blocked %d further sources", len(blocked)-maxBlockEvents)
+			break
+		}
+		r.recorder.Eventf(&f, "Warning", "AutoBlock", "blocked %s until %s because of ids alert %d with severity %d: %s",
+			b.IP, b.Expires.Format(time.RFC3339), b.SignatureID, b.Severity, b.Signature)
+	}
+	return nftables.UpdateAutoBlockSet(r.blocker.Timeouts(now))
+}
+
+// servicesByIP maps the load balancer and external ips to their services
+func (r *FirewallReconciler) servicesByIP(ctx context.Context) (map[string]*corev1.Service, error) {
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services); err != nil {
+		return nil, err
+	}
+	byIP := map[string]*corev1.Service{}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		ips := append([]string{svc.Spec.LoadBalancerIP}, svc.Spec.ExternalIPs...)
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			ips = append(ips, ingress.IP)
 		}
-		for iface, stat := range *ss {
-			idsStats[iface] = firewallv1.InterfaceStat{
-				Drop:             stat.Drop,
-				InvalidChecksums: stat.InvalidChecksums,
-				Packets:          stat.Pkts,
+		for _, ip := range ips {
+			if ip != "" {
+				byIP[ip] = svc
 			}
 		}
 	}
-	f.Status.FirewallStats.IDSStats = idsStats
+	return byIP, nil
+}
 
-	f.Status.Updated.Time = time.Now()
+// updatePolicyStatus publishes the statistics of the rules of each ClusterwideNetworkPolicy on its status
+func (r *FirewallReconciler) updatePolicyStatus(ctx context.Context, f firewallv1.Firewall, stats firewallv1.RuleStatsByAction, log logr.Logger) {
+	var clusterNPs firewallv1.ClusterwideNetworkPolicyList
+	if err := r.List(ctx, &clusterNPs, client.InNamespace(f.Namespace)); err != nil {
+		log.Error(err, "unable to list cluster wide network policies for status update")
+		return
+	}
 
-	if err := r.Status().Update(ctx, &f); err != nil {
-		return fmt.Errorf("unable to update firewall status, err: %w", err)
+	for i := range clusterNPs.Items {
+		np := clusterNPs.Items[i]
+		status := nftables.ClusterwideNetworkPolicyStatus(np, stats, f.Status.Updated.Time)
+		if !nftables.PolicyStatusChanged(np.Status, status) {
+			continue
+		}
+		np.Status = status
+		if err := r.Status().Update(ctx, &np); err != nil {
+			log.Error(err, "unable to update cluster wide network policy status", "policy", np.Name)
+		}
 	}
-	return nil
 }
 
 // SetupWithManager configures this controller to watch for the CRDs in a specific namespace
 func (r *FirewallReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.recorder = mgr.GetEventRecorderFor("FirewallController")
+	r.metrics = collector.NewFirewallMetrics()
+	r.counters = collector.NewCounterAccumulator(r.CountersFile, r.Log.WithName("counters"))
+	if err := mgr.Add(manager.RunnableFunc(r.counters.Run)); err != nil {
+		return fmt.Errorf("unable to persist the counters on shutdown: %w", err)
+	}
+	r.rates = collector.NewRateCalculator(collector.DefaultRateSamples)
+	r.conntrack = collector.NewConntrackThresholds(r.ConntrackThreshold, r.SNATThreshold)
+	r.flows = flowexport.NewExporter(r.Log.WithName("flowexport"))
+	if err := mgr.Add(manager.RunnableFunc(r.flows.Run)); err != nil {
+		return fmt.Errorf("unable to stop the flow export on shutdown: %w", err)
+	}
+	r.analyzer = collector.NewAnalyzer(r.TopTalkers, r.UnusedRulePeriod, r.AnalysisInterval, r.RuleUsageFile, r.Log.WithName("analysis"))
+	if err := metrics.Registry.Register(r.metrics); err != nil {
+		return fmt.Errorf("unable to register firewall metrics: %w", err)
+	}
+	if r.Drops != nil {
+		if err := metrics.Registry.Register(r.Drops); err != nil {
+			return fmt.Errorf("unable to register drop metrics: %w", err)
+		}
+	}
+	if r.EnableIDS {
+		r.alerts = suricata.NewAlertAggregator()
+		if err := metrics.Registry.Register(r.alerts); err != nil {
+			return fmt.Errorf("unable to register ids alert metrics: %w", err)
+		}
+		eve := suricata.NewEVEReader(r.IDSEVEOutput, r.alerts, r.Log.WithName("eve"))
+		if err := mgr.Add(manager.RunnableFunc(eve.Run)); err != nil {
+			return fmt.Errorf("unable to read ids alerts: %w", err)
+		}
+		// the eve output of the ips is followed also while the ips is stopped, it is read once the ips is started
+		ipsEVE := suricata.NewIPSEVEReader(r.alerts, r.Log.WithName("ips-eve"))
+		if err := mgr.Add(manager.RunnableFunc(ipsEVE.Run)); err != nil {
+			return fmt.Errorf("unable to read ips alerts: %w", err)
+		}
+		r.rules = suricata.NewRuleManager(r.IDSRulesStateFile, r.Log.WithName("ids-rules"))
+		r.idsConfig = suricata.NewConfigManager(r.Log.WithName("ids-config"))
+		r.ips = suricata.NewIPS(r.IPSQueue, r.Log.WithName("ips"))
+		r.blocker = suricata.NewBlocker(r.AutoBlockStateFile, r.Log.WithName("auto-block"))
+	}
+
 	mapToFirewallReconcilation := handler.ToRequestsFunc(
 		func(a handler.MapObject) []reconcile.Request {
 			return []reconcile.Request{
@@ -461,11 +1090,53 @@ func (r *FirewallReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	triggerFirewallReconcilation := &handler.EnqueueRequestsFromMapFunc{
 		ToRequests: mapToFirewallReconcilation,
 	}
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&firewallv1.Firewall{}).
-		// don't trigger a reconcilation for status updates
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		Watches(&source.Kind{Type: &firewallv1.ClusterwideNetworkPolicy{}}, triggerFirewallReconcilation).
-		Watches(&source.Kind{Type: &corev1.Service{}}, triggerFirewallReconcilation).
-		Complete(r)
+	// don't trigger a reconcilation for status updates
+	generationChanged := builder.WithPredicates(predicate.GenerationChangedPredicate{})
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&firewallv1.Firewall{}, generationChanged).
+		Watches(&source.Kind{Type: &firewallv1.ClusterwideNetworkPolicy{}}, triggerFirewallReconcilation, generationChanged).
+		// the generation of services is not changed by updates of their annotations and load balancer status
+		Watches(&source.Kind{Type: &corev1.Service{}}, triggerFirewallReconcilation, builder.WithPredicates(serviceChanged)).
+		// the generation of nodes is not changed by the kubelet, the node port rules depend on the addresses in their status
+		Watches(&source.Kind{Type: &corev1.Node{}}, triggerFirewallReconcilation, builder.WithPredicates(nodeAddressesChanged))
+
+	// gateways are not watched because the Gateway API may not be installed, they are picked up with the reconcile interval
+	if r.EnableIngressSourceRanges {
+		b = b.Watches(&source.Kind{Type: &networkingv1beta1.Ingress{}}, triggerFirewallReconcilation, generationChanged)
+	}
+
+	return b.Complete(r)
+}
+
+// serviceChanged passes the creation and deletion of services and updates of their spec, annotations and load balancer status
+var serviceChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldService, ok := e.ObjectOld.(*corev1.Service)
+		if !ok {
+			return false
+		}
+		newService, ok := e.ObjectNew.(*corev1.Service)
+		if !ok {
+			return false
+		}
+		return oldService.Generation != newService.Generation ||
+			!reflect.DeepEqual(oldService.Spec, newService.Spec) ||
+			!reflect.DeepEqual(oldService.Annotations, newService.Annotations) ||
+			!reflect.DeepEqual(oldService.Status.LoadBalancer, newService.Status.LoadBalancer)
+	},
+}
+
+// nodeAddressesChanged passes the creation and deletion of nodes and updates of their addresses
+var nodeAddressesChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return !reflect.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses)
+	},
 }
@@ -5,10 +5,12 @@ import (
 	"testing"
 
 	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/nftables"
 	corev1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestConvert(t *testing.T) {
@@ -137,3 +139,36 @@ func TestConvert(t *testing.T) {
 		})
 	}
 }
+
+func TestWarnInvalidServices(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &FirewallReconciler{recorder: recorder}
+	svc := corev1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "svc",
+			UID:         "1",
+			Annotations: map[string]string{nftables.AnnotationDisabled: "no"},
+		},
+	}
+
+	// the warning is recorded once until the annotations change
+	r.warnInvalidServices([]corev1.Service{svc})
+	r.warnInvalidServices([]corev1.Service{svc})
+	if got := len(recorder.Events); got != 1 {
+		t.Errorf("expected 1 event, got %d", got)
+	}
+	svc.Annotations[nftables.AnnotationDisabled] = "maybe"
+	r.warnInvalidServices([]corev1.Service{svc})
+	if got := len(recorder.Events); got != 2 {
+		t.Errorf("expected 2 events after the annotation changed, got %d", got)
+	}
+
+	// a service which was fixed and broken again is warned again
+	svc.Annotations[nftables.AnnotationDisabled] = "true"
+	r.warnInvalidServices([]corev1.Service{svc})
+	svc.Annotations[nftables.AnnotationDisabled] = "maybe"
+	r.warnInvalidServices([]corev1.Service{svc})
+	if got := len(recorder.Events); got != 3 {
+		t.Errorf("expected 3 events, got %d", got)
+	}
+}
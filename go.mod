@@ -15,15 +15,19 @@ require (
 	github.com/hashicorp/go-multierror v1.1.0
 	github.com/imdario/mergo v0.3.11 // indirect
 	github.com/ks2211/go-suricata v0.0.0-20200823200910-986ce1470707
-	github.com/mdlayher/netlink v1.1.1 // indirect
+	github.com/mdlayher/netlink v1.1.1
 	github.com/metal-stack/metal-go v0.14.0
 	github.com/metal-stack/metal-lib v0.7.2
 	github.com/metal-stack/metal-networker v0.6.4
 	github.com/metal-stack/v v1.0.3
+	github.com/prometheus/client_golang v1.9.0
 	github.com/txn2/txeh v1.3.0
 	github.com/vishvananda/netlink v1.1.0
+	golang.org/x/sys v0.0.0-20210403161142-5e06dd20ab57
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e // indirect
 	gomodules.xyz/jsonpatch/v2 v2.1.0 // indirect
+	google.golang.org/grpc v1.36.0
+	google.golang.org/protobuf v1.25.0
 	k8s.io/api v0.18.9
 	k8s.io/apiextensions-apiserver v0.18.9
 	k8s.io/apimachinery v0.18.9
@@ -21,11 +21,17 @@ import (
 	"flag"
 	"fmt"
 	"io/fs"
+	"math"
+	"net"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/metal-stack/firewall-controller/controllers"
 	"github.com/metal-stack/firewall-controller/controllers/crd"
+	"github.com/metal-stack/firewall-controller/pkg/collector"
+	"github.com/metal-stack/firewall-controller/pkg/droptailer"
+	"github.com/metal-stack/firewall-controller/pkg/suricata"
 	"github.com/metal-stack/metal-lib/pkg/sign"
 	"github.com/metal-stack/v"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
@@ -62,6 +68,25 @@ func main() {
 		enableLeaderElection bool
 		enableIDS            bool
 		enableSignatureCheck bool
+		enableIngressSources bool
+		countersFile         string
+		monitorInterval      time.Duration
+		conntrackThreshold   int
+		snatThreshold        int
+		topTalkers           int
+		unusedRulePeriod     time.Duration
+		ruleUsageFile        string
+		analysisInterval     time.Duration
+		idsEVEOutput         string
+		idsRulesStateFile    string
+		autoBlockStateFile   string
+		ipsQueue             uint
+		streamDrops          bool
+		dropLogGroup         uint
+		dropWindow           time.Duration
+		topDrops             int
+		serviceDropRate      float64
+		certificateWarning   time.Duration
 		hostsFile            string
 	)
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
@@ -70,11 +95,48 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&enableIDS, "enable-IDS", true, "Set this to false to exclude IDS.")
 	flag.StringVar(&hostsFile, "hosts-file", "/etc/hosts", "The hosts file to manipulate for the droptailer.")
+	flag.BoolVar(&streamDrops, "stream-drops", false, "Set this to true to stream the dropped packets from NFLOG to the droptailer server instead of logging them to the kernel log.")
+	flag.UintVar(&dropLogGroup, "drop-log-group", droptailer.DefaultGroup, "The NFLOG group the dropped packets are logged to with --stream-drops.")
+	flag.DurationVar(&dropWindow, "drop-window", collector.DefaultDropWindow, "The sliding window the streamed dropped packets are aggregated for.")
+	flag.IntVar(&topDrops, "top-drops", collector.DefaultTopDrops, "The number of aggregates with the most dropped packets reported in the firewall status.")
+	flag.Float64Var(&serviceDropRate, "service-drop-rate", collector.DefaultServiceDropRate, "The rate of packets per second dropped on their way to the load balancer ip of a service which triggers a warning event, 0 disables the warning.")
+	flag.DurationVar(&certificateWarning, "droptailer-certificate-warning", droptailer.DefaultExpiryWarning, "The period ahead of the expiry of the droptailer client certificate or its ca a warning event is emitted.")
 	flag.BoolVar(&enableSignatureCheck, "enable-signature-check", true, "Set this to false to ignore signature checking.")
+	flag.BoolVar(&enableIngressSources, "enable-ingress-source-ranges", false, "Set this to true to restrict ingress controller services to the source ranges of Ingresses and Gateways.")
+	flag.StringVar(&countersFile, "counters-file", collector.DefaultCountersFile, "The file the counters accumulated across ruleset reloads are persisted to.")
+	flag.DurationVar(&monitorInterval, "monitor-interval", controllers.DefaultMonitorInterval, "The minimum interval between two updates of the firewall monitor with the runtime data of the firewall.")
+	flag.IntVar(&conntrackThreshold, "conntrack-threshold", controllers.DefaultConntrackThreshold, "The usage of the conntrack table in percent which triggers a warning event, 0 disables the warning.")
+	flag.IntVar(&snatThreshold, "snat-threshold", controllers.DefaultSNATThreshold, "The usage of the ports of a source nat address in percent which triggers a warning event, 0 disables the warning.")
+	flag.IntVar(&topTalkers, "top-talkers", collector.DefaultTopTalkers, "The number of clients with the most traffic reported per service and external network, 0 disables the report.")
+	flag.StringVar(&ruleUsageFile, "rule-usage-file", collector.DefaultRuleUsageFile, "The file the usage of the rules is persisted to, to track the unused rule period across restarts.")
+	flag.DurationVar(&unusedRulePeriod, "unused-rule-period", collector.DefaultUnusedRulePeriod, "The period without any match after which a rule generated for a kubernetes object is reported as unused.")
+	flag.DurationVar(&analysisInterval, "analysis-interval", collector.DefaultAnalysisInterval, "The interval the open connections are analyzed for the top talkers.")
+	flag.StringVar(&idsEVEOutput, "ids-eve-output", suricata.DefaultEVEOutput, "The EVE JSON output of suricata the IDS alerts are read from, either a file or a unix socket prefixed with unix:// suricata connects to.")
+	flag.UintVar(&ipsQueue, "ips-queue", suricata.DefaultIPSQueue, "The NFQUEUE the connections of services and policies marked for inline inspection are sent to suricata with.")
+	flag.StringVar(&idsRulesStateFile, "ids-rules-state-file", suricata.DefaultRulesStateFile, "The file the state of the IDS ruleset applied by the controller is persisted to.")
+	flag.StringVar(&autoBlockStateFile, "auto-block-state-file", suricata.DefaultAutoBlockStateFile, "The file the sources blocked because of IDS alerts are persisted to, to keep them blocked across restarts.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	metricsPort, err := parseMetricsPort(metricsAddr)
+	if err != nil {
+		setupLog.Error(err, "unable to parse metrics address")
+		os.Exit(1)
+	}
+	if ipsQueue > math.MaxUint16 {
+		setupLog.Error(fmt.Errorf("queue %d is out of range", ipsQueue), "invalid ips queue")
+		os.Exit(1)
+	}
+	if dropLogGroup > math.MaxUint16 {
+		setupLog.Error(fmt.Errorf("group %d is out of range", dropLogGroup), "invalid drop log group")
+		os.Exit(1)
+	}
+	if dropWindow <= 0 {
+		setupLog.Error(fmt.Errorf("window %s is not positive", dropWindow), "invalid drop window")
+		os.Exit(1)
+	}
+
 	restConfig := ctrl.GetConfigOrDie()
 	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:             scheme,
@@ -119,13 +181,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the streamed drops are aggregated for the firewall status
+	var drops *collector.DropAggregator
+	if streamDrops {
+		drops = collector.NewDropAggregator(dropWindow, topDrops, serviceDropRate)
+	}
+
 	// Droptailer Reconciler
-	if err = (&controllers.DroptailerReconciler{
-		Client:    mgr.GetClient(),
-		Log:       ctrl.Log.WithName("controllers").WithName("Droptailer"),
-		Scheme:    mgr.GetScheme(),
-		HostsFile: hostsFile,
-	}).SetupWithManager(mgr); err != nil {
+	droptailerReconciler := &controllers.DroptailerReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("Droptailer"),
+		Scheme:        mgr.GetScheme(),
+		HostsFile:     hostsFile,
+		StreamDrops:   streamDrops,
+		DropLogGroup:  uint16(dropLogGroup),
+		Drops:         drops,
+		ExpiryWarning: certificateWarning,
+	}
+	if err = droptailerReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Droptailer")
 		os.Exit(1)
 	}
@@ -155,12 +228,30 @@ func main() {
 	}
 
 	if err = (&controllers.FirewallReconciler{
-		Client:               mgr.GetClient(),
-		Log:                  ctrl.Log.WithName("controllers").WithName("Firewall"),
-		Scheme:               mgr.GetScheme(),
-		EnableIDS:            enableIDS,
-		EnableSignatureCheck: enableSignatureCheck,
-		CAPubKey:             caPubKey,
+		Client:                    mgr.GetClient(),
+		Log:                       ctrl.Log.WithName("controllers").WithName("Firewall"),
+		Scheme:                    mgr.GetScheme(),
+		EnableIDS:                 enableIDS,
+		EnableSignatureCheck:      enableSignatureCheck,
+		EnableIngressSourceRanges: enableIngressSources,
+		CAPubKey:                  caPubKey,
+		MetricsPort:               metricsPort,
+		CountersFile:              countersFile,
+		RuleUsageFile:             ruleUsageFile,
+		MonitorInterval:           monitorInterval,
+		ConntrackThreshold:        conntrackThreshold,
+		SNATThreshold:             snatThreshold,
+		TopTalkers:                topTalkers,
+		UnusedRulePeriod:          unusedRulePeriod,
+		AnalysisInterval:          analysisInterval,
+		IDSEVEOutput:              idsEVEOutput,
+		IDSRulesStateFile:         idsRulesStateFile,
+		AutoBlockStateFile:        autoBlockStateFile,
+		IPSQueue:                  uint16(ipsQueue),
+		StreamDrops:               streamDrops,
+		DropLogGroup:              uint16(dropLogGroup),
+		Droptailer:                droptailerReconciler,
+		Drops:                     drops,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Firewall")
 		os.Exit(1)
@@ -192,3 +283,19 @@ func readCRDsFromVFS() (map[string][]byte, error) {
 	}
 	return crdMap, nil
 }
+
+// parseMetricsPort returns the port of the metrics address, it is 0 if metrics are disabled
+func parseMetricsPort(metricsAddr string) (int32, error) {
+	if metricsAddr == "0" {
+		return 0, nil
+	}
+	_, port, err := net.SplitHostPort(metricsAddr)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(p), nil
+}
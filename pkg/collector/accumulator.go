@@ -0,0 +1,279 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+)
+
+const (
+	// DefaultCountersFile is the file the accumulated counters are persisted to
+	DefaultCountersFile = "/var/lib/firewall-controller/counters.json"
+	// persistInterval is the interval the counters are persisted in, in addition to reloads, resets and the shutdown of the controller
+	persistInterval = 10 * time.Minute
+)
+
+type (
+	// CounterAccumulator accumulates the rule and device counters across reloads of the ruleset, which reset all counters.
+	// The counters are snapshotted right before a reload and added to the fresh counters afterwards,
+	// resets which were not observed are detected by decreasing counters.
+	// The accumulated values are persisted, so they survive restarts of the controller.
+	// To spare the disk of the firewall they are not persisted with every accumulation, but on reloads and detected resets,
+	// every persistInterval and when the controller stops.
+	CounterAccumulator struct {
+		lock      sync.Mutex
+		log       logr.Logger
+		file      string
+		state     counterState
+		snapshot  *counterValues
+		persisted time.Time
+		collect   func() (counterValues, error)
+		now       func() time.Time
+	}
+
+	// counterState is the persisted state of the accumulator
+	counterState struct {
+		// Offsets are the values accumulated before the last reset of the counters
+		Offsets counterValues `json:"offsets"`
+		// Last are the values seen since the last reset of the counters
+		Last       counterValues `json:"last"`
+		LastReload *metav1.Time  `json:"lastReload,omitempty"`
+	}
+
+	// counterValues holds the rule counters by action and comment and the device counters by device
+	counterValues struct {
+		Rules   map[string]map[string]firewallv1.Counter `json:"rules"`
+		Devices map[string]firewallv1.DeviceStat         `json:"devices"`
+	}
+)
+
+// NewCounterAccumulator creates a new accumulator which persists its state to the given file,
+// a previously persisted state is restored.
+func NewCounterAccumulator(file string, log logr.Logger) *CounterAccumulator {
+	a := &CounterAccumulator{
+		log:   log,
+		file:  file,
+		state: counterState{Offsets: newCounterValues(), Last: newCounterValues()},
+		now:   time.Now,
+	}
+	a.collect = func() (counterValues, error) {
+		c := NewNFTablesCollector(&a.log)
+		devices, err := c.CollectDeviceStats()
+		if err != nil {
+			return counterValues{}, err
+		}
+		return valuesOf(firewallv1.FirewallStats{RuleStats: c.CollectRuleStats(), DeviceStats: devices}), nil
+	}
+
+	if err := a.load(); err != nil {
+		log.Error(err, "unable to restore accumulated counters, starting from scratch", "file", file)
+	}
+	a.persisted = a.now()
+	return a
+}
+
+// Run persists the counters when the controller stops
+func (a *CounterAccumulator) Run(stop <-chan struct{}) error {
+	<-stop
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.persist()
+	return nil
+}
+
+func newCounterValues() counterValues {
+	return counterValues{
+		Rules:   map[string]map[string]firewallv1.Counter{},
+		Devices: map[string]firewallv1.DeviceStat{},
+	}
+}
+
+func valuesOf(stats firewallv1.FirewallStats) counterValues {
+	v := newCounterValues()
+	for action, ruleStats := range stats.RuleStats {
+		v.Rules[action] = map[string]firewallv1.Counter{}
+		for comment, stat := range ruleStats {
+			v.Rules[action][comment] = stat.Counter
+		}
+	}
+	for device, stat := range stats.DeviceStats {
+		v.Devices[device] = firewallv1.DeviceStat{InBytes: stat.InBytes, OutBytes: stat.OutBytes, InPackets: stat.InPackets, OutPackets: stat.OutPackets}
+	}
+	return v
+}
+
+// BeforeReload snapshots the current counters, it implements nftables.ReloadObserver
+func (a *CounterAccumulator) BeforeReload() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	snapshot, err := a.collect()
+	if err != nil {
+		a.log.Error(err, "unable to snapshot counters before reload")
+		a.snapshot = nil
+		return
+	}
+	a.snapshot = &snapshot
+}
+
+// AfterReload adds the snapshot to the accumulated values if the reload succeeded, it implements nftables.ReloadObserver
+func (a *CounterAccumulator) AfterReload(err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	snapshot := a.snapshot
+	a.snapshot = nil
+	if err != nil || snapshot == nil {
+		return
+	}
+
+	a.state.Offsets = addValues(a.state.Offsets, *snapshot)
+	a.state.Last = newCounterValues()
+	now := metav1.Now()
+	a.state.LastReload = &now
+	a.persist()
+}
+
+// Accumulate sets the cumulative values of the given statistics, which contain the current counters
+func (a *CounterAccumulator) Accumulate(stats *firewallv1.FirewallStats) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	current := valuesOf(*stats)
+
+	// a decreasing counter was reset without a snapshot, e.g. by a manual reload or reboot
+	reset := false
+	for action, counters := range current.Rules {
+		for comment, c := range counters {
+			last, ok := a.state.Last.Rules[action][comment]
+			if ok && (c.Bytes < last.Bytes || c.Packets < last.Packets) {
+				offset := a.state.Offsets.Rules[action][comment]
+				a.state.Offsets.Rules[action] = withCounter(a.state.Offsets.Rules[action], comment, addCounter(offset, last))
+				reset = true
+			}
+		}
+	}
+	for device, d := range current.Devices {
+		last, ok := a.state.Last.Devices[device]
+		if ok && (d.InBytes < last.InBytes || d.OutBytes < last.OutBytes || d.InPackets < last.InPackets || d.OutPackets < last.OutPackets) {
+			a.state.Offsets.Devices[device] = addDeviceStat(a.state.Offsets.Devices[device], last)
+			reset = true
+		}
+	}
+
+	// counters of rules and devices which no longer exist are dropped
+	offsets := newCounterValues()
+	for action, ruleStats := range stats.RuleStats {
+		offsets.Rules[action] = map[string]firewallv1.Counter{}
+		for comment, stat := range ruleStats {
+			offset := a.state.Offsets.Rules[action][comment]
+			offsets.Rules[action][comment] = offset
+			stat.Cumulative = addCounter(offset, stat.Counter)
+			ruleStats[comment] = stat
+		}
+	}
+	for device, stat := range stats.DeviceStats {
+		offset := a.state.Offsets.Devices[device]
+		offsets.Devices[device] = offset
+		stat.CumulativeInBytes = offset.InBytes + stat.InBytes
+		stat.CumulativeOutBytes = offset.OutBytes + stat.OutBytes
+		stat.CumulativeInPackets = offset.InPackets + stat.InPackets
+		stat.CumulativeOutPackets = offset.OutPackets + stat.OutPackets
+		stats.DeviceStats[device] = stat
+	}
+
+	a.state.Offsets = offsets
+	a.state.Last = current
+	if a.state.LastReload != nil {
+		t := *a.state.LastReload
+		stats.LastReload = &t
+	}
+	if reset || a.now().Sub(a.persisted) >= persistInterval {
+		a.persist()
+	}
+}
+
+func (a *CounterAccumulator) load() error {
+	if a.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(a.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := counterState{Offsets: newCounterValues(), Last: newCounterValues()}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("unable to parse accumulated counters: %w", err)
+	}
+	if state.Offsets.Rules == nil || state.Offsets.Devices == nil || state.Last.Rules == nil || state.Last.Devices == nil {
+		return fmt.Errorf("accumulated counters are incomplete")
+	}
+	a.state = state
+	return nil
+}
+
+// persist writes the state atomically, errors are only logged because the counters are still valid in memory
+func (a *CounterAccumulator) persist() {
+	if a.file == "" {
+		return
+	}
+	data, err := json.Marshal(a.state)
+	if err != nil {
+		a.log.Error(err, "unable to marshal accumulated counters")
+		return
+	}
+	if err := helper.WriteFile(a.file, data, 0600); err != nil {
+		a.log.Error(err, "unable to write accumulated counters", "file", a.file)
+		return
+	}
+	a.persisted = a.now()
+}
+
+func addValues(a, b counterValues) counterValues {
+	sum := newCounterValues()
+	for _, v := range []counterValues{a, b} {
+		for action, counters := range v.Rules {
+			for comment, c := range counters {
+				sum.Rules[action] = withCounter(sum.Rules[action], comment, addCounter(sum.Rules[action][comment], c))
+			}
+		}
+		for device, d := range v.Devices {
+			sum.Devices[device] = addDeviceStat(sum.Devices[device], d)
+		}
+	}
+	return sum
+}
+
+func withCounter(counters map[string]firewallv1.Counter, comment string, c firewallv1.Counter) map[string]firewallv1.Counter {
+	if counters == nil {
+		counters = map[string]firewallv1.Counter{}
+	}
+	counters[comment] = c
+	return counters
+}
+
+func addCounter(a, b firewallv1.Counter) firewallv1.Counter {
+	return firewallv1.Counter{Bytes: a.Bytes + b.Bytes, Packets: a.Packets + b.Packets}
+}
+
+func addDeviceStat(a, b firewallv1.DeviceStat) firewallv1.DeviceStat {
+	return firewallv1.DeviceStat{
+		InBytes:    a.InBytes + b.InBytes,
+		OutBytes:   a.OutBytes + b.OutBytes,
+		InPackets:  a.InPackets + b.InPackets,
+		OutPackets: a.OutPackets + b.OutPackets,
+	}
+}
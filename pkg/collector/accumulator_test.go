@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func stats(bytes, packets, in, out uint64) firewallv1.FirewallStats {
+	return firewallv1.FirewallStats{
+		RuleStats: firewallv1.RuleStatsByAction{
+			"accept": firewallv1.RuleStats{
+				"accept icmp": firewallv1.RuleStat{
+					Counter: firewallv1.Counter{Bytes: bytes, Packets: packets},
+				},
+			},
+		},
+		DeviceStats: firewallv1.DeviceStatsByDevice{
+			"external": firewallv1.DeviceStat{InBytes: in, OutBytes: out},
+		},
+	}
+}
+
+func cumulative(t *testing.T, s firewallv1.FirewallStats, bytes, packets, in, out uint64) {
+	t.Helper()
+	want := firewallv1.Counter{Bytes: bytes, Packets: packets}
+	if got := s.RuleStats["accept"]["accept icmp"].Cumulative; !cmp.Equal(got, want) {
+		t.Errorf("cumulative rule counter diff: %v", cmp.Diff(got, want))
+	}
+	device := s.DeviceStats["external"]
+	if device.CumulativeInBytes != in || device.CumulativeOutBytes != out {
+		t.Errorf("cumulative device counter = %d/%d, want %d/%d", device.CumulativeInBytes, device.CumulativeOutBytes, in, out)
+	}
+}
+
+func TestCounterAccumulator(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counters.json")
+	a := NewCounterAccumulator(file, logr.Discard())
+
+	s := stats(100, 1, 10, 20)
+	a.Accumulate(&s)
+	cumulative(t, s, 100, 1, 10, 20)
+	if s.LastReload != nil {
+		t.Errorf("expected no reload yet")
+	}
+
+	// reload with a snapshot
+	a.collect = func() (counterValues, error) {
+		return valuesOf(stats(150, 2, 15, 25)), nil
+	}
+	a.BeforeReload()
+	a.AfterReload(nil)
+
+	s = stats(10, 1, 1, 2)
+	a.Accumulate(&s)
+	cumulative(t, s, 160, 3, 16, 27)
+	if s.LastReload == nil {
+		t.Errorf("expected the last reload to be set")
+	}
+
+	// a failed reload does not reset the counters
+	a.collect = func() (counterValues, error) {
+		return valuesOf(stats(20, 2, 2, 3)), nil
+	}
+	a.BeforeReload()
+	a.AfterReload(fmt.Errorf("reload failed"))
+
+	// the accumulations are not persisted until the interval passed
+	persisted, _ := ioutil.ReadFile(file)
+	s = stats(30, 3, 3, 4)
+	a.Accumulate(&s)
+	cumulative(t, s, 180, 5, 18, 29)
+	if current, _ := ioutil.ReadFile(file); string(current) != string(persisted) {
+		t.Errorf("expected the counters not to be persisted with every accumulation")
+	}
+	now := time.Now().Add(persistInterval)
+	a.now = func() time.Time { return now }
+	s = stats(30, 3, 3, 4)
+	a.Accumulate(&s)
+	if current, _ := ioutil.ReadFile(file); string(current) == string(persisted) {
+		t.Errorf("expected the counters to be persisted after the interval")
+	}
+
+	// the counters are persisted when the controller stops
+	s = stats(40, 4, 4, 5)
+	a.Accumulate(&s)
+	cumulative(t, s, 190, 6, 19, 30)
+	stop := make(chan struct{})
+	close(stop)
+	if err := a.Run(stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the state is restored after a restart and a reset without snapshot is detected
+	a = NewCounterAccumulator(file, logr.Discard())
+	s = stats(5, 1, 1, 1)
+	a.Accumulate(&s)
+	cumulative(t, s, 195, 7, 20, 31)
+
+	// counters of removed rules are dropped
+	s = firewallv1.FirewallStats{}
+	a.Accumulate(&s)
+	s = stats(5, 1, 1, 1)
+	a.Accumulate(&s)
+	cumulative(t, s, 5, 1, 1, 1)
+}
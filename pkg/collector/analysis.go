@@ -0,0 +1,288 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+	nft "github.com/metal-stack/firewall-controller/pkg/nftables"
+)
+
+const (
+	// DefaultTopTalkers is the default number of top talkers reported per service and network
+	DefaultTopTalkers = 10
+	// DefaultUnusedRulePeriod is the default period without any match after which a rule is reported as unused
+	DefaultUnusedRulePeriod = 7 * 24 * time.Hour
+	// DefaultAnalysisInterval is the default interval the open connections are analyzed for top talkers
+	DefaultAnalysisInterval = 5 * time.Minute
+	// DefaultRuleUsageFile is the file the usage of the rules is persisted to, next to the accumulated counters
+	DefaultRuleUsageFile = "/var/lib/firewall-controller/rule-usage.json"
+)
+
+type (
+	// Analyzer reports the top talkers of the services and external networks and the rules which did not match any traffic for a period.
+	// The top talkers are determined from the open connections once per interval, as listing them is expensive on a busy firewall.
+	// The usage of the rules is persisted, so the period is not restarted by restarts of the controller.
+	Analyzer struct {
+		lock         sync.Mutex
+		log          logr.Logger
+		file         string
+		topN         int
+		unusedPeriod time.Duration
+		interval     time.Duration
+
+		topTalkers *firewallv1.TopTalkers
+		rules      ruleUsages
+
+		listFlows func() ([]*netlink.ConntrackFlow, error)
+	}
+
+	// ruleUsages are the usages of the rules by action and comment
+	ruleUsages map[string]map[string]ruleUsage
+
+	// ruleUsage tracks when a rule was first seen and last matched traffic
+	ruleUsage struct {
+		FirstSeen time.Time  `json:"firstSeen"`
+		LastHit   *time.Time `json:"lastHit,omitempty"`
+		// Packets is the cumulative packet counter of the rule, which survives reloads and restarts as well
+		Packets uint64 `json:"packets"`
+	}
+)
+
+// NewAnalyzer creates a new analyzer which reports the given number of top talkers and the rules without match for the given period,
+// the usage of the rules is restored from and persisted to the given file
+func NewAnalyzer(topN int, unusedPeriod, interval time.Duration, file string, log logr.Logger) *Analyzer {
+	a := &Analyzer{
+		log:          log,
+		file:         file,
+		topN:         topN,
+		unusedPeriod: unusedPeriod,
+		interval:     interval,
+		rules:        ruleUsages{},
+		listFlows: func() ([]*netlink.ConntrackFlow, error) {
+			return netlink.ConntrackTableList(netlink.ConntrackTable, netlink.FAMILY_V4)
+		},
+	}
+	if err := a.load(); err != nil {
+		log.Error(err, "unable to restore the usage of the rules, starting from scratch", "file", file)
+	}
+	return a
+}
+
+// Analyze sets the top talkers and the unused rules on the given statistics, which must contain the cumulative rule counters.
+// The connections are attributed to the services by the given sources and to the external networks by the addresses of the egress rules.
+func (a *Analyzer) Analyze(stats *firewallv1.FirewallStats, sources *nft.FlowSources, egressRules []firewallv1.EgressRuleSNAT, now time.Time) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var changed bool
+	stats.UnusedRules, changed = a.unusedRules(stats.RuleStats, now)
+	if changed {
+		a.persist()
+	}
+
+	if a.topN > 0 && (a.topTalkers == nil || now.Sub(a.topTalkers.Updated.Time) >= a.interval) {
+		flows, err := a.listFlows()
+		if err != nil {
+			return fmt.Errorf("unable to list conntrack table: %w", err)
+		}
+		a.topTalkers = topTalkers(flows, sources, egressRules, a.topN, now)
+	}
+	if a.topTalkers != nil {
+		stats.TopTalkers = a.topTalkers.DeepCopy()
+	}
+	return nil
+}
+
+// unusedRules updates the usage of the rules generated for kubernetes objects and returns those without match for the period,
+// changed reports whether the usage has to be persisted
+func (a *Analyzer) unusedRules(ruleStats firewallv1.RuleStatsByAction, now time.Time) (unused []firewallv1.UnusedRule, changed bool) {
+	rules := ruleUsages{}
+	for action, stats := range ruleStats {
+		for comment, stat := range stats {
+			if stat.Source == nil {
+				continue
+			}
+			usage, ok := a.rules[action][comment]
+			if !ok {
+				usage = ruleUsage{FirstSeen: now, Packets: stat.Cumulative.Packets}
+				changed = true
+			}
+			if stat.Cumulative.Packets != usage.Packets {
+				hit := now
+				usage.LastHit = &hit
+				usage.Packets = stat.Cumulative.Packets
+				changed = true
+			}
+			if rules[action] == nil {
+				rules[action] = map[string]ruleUsage{}
+			}
+			rules[action][comment] = usage
+
+			since := usage.FirstSeen
+			if usage.LastHit != nil {
+				since = *usage.LastHit
+			}
+			if now.Sub(since) < a.unusedPeriod {
+				continue
+			}
+			rule := firewallv1.UnusedRule{
+				Action:  action,
+				Comment: comment,
+				Source:  stat.Source.DeepCopy(),
+				Since:   metav1.NewTime(since),
+			}
+			if usage.LastHit != nil {
+				lastHit := metav1.NewTime(*usage.LastHit)
+				rule.LastHit = &lastHit
+			}
+			unused = append(unused, rule)
+		}
+	}
+	// rules which no longer exist are forgotten
+	for action, usages := range a.rules {
+		for comment := range usages {
+			if _, ok := rules[action][comment]; !ok {
+				changed = true
+			}
+		}
+	}
+	a.rules = rules
+
+	sort.Slice(unused, func(i, j int) bool {
+		if unused[i].Action != unused[j].Action {
+			return unused[i].Action < unused[j].Action
+		}
+		return unused[i].Comment < unused[j].Comment
+	})
+	return unused, changed
+}
+
+func (a *Analyzer) load() error {
+	if a.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(a.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rules := ruleUsages{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("unable to parse the usage of the rules: %w", err)
+	}
+	a.rules = rules
+	return nil
+}
+
+// persist writes the usage atomically, errors are only logged because the usage is still valid in memory
+func (a *Analyzer) persist() {
+	if a.file == "" {
+		return
+	}
+	data, err := json.Marshal(a.rules)
+	if err != nil {
+		a.log.Error(err, "unable to marshal the usage of the rules")
+		return
+	}
+	if err := helper.WriteFile(a.file, data, 0600); err != nil {
+		a.log.Error(err, "unable to write the usage of the rules", "file", a.file)
+	}
+}
+
+// topTalkers sums up the open connections by client for the services and the external networks and returns the top n of each
+func topTalkers(flows []*netlink.ConntrackFlow, sources *nft.FlowSources, egressRules []firewallv1.EgressRuleSNAT, n int, now time.Time) *firewallv1.TopTalkers {
+	networks := map[string]string{}
+	for _, rule := range egressRules {
+		for _, ip := range rule.IPs {
+			networks[ip] = rule.NetworkID
+		}
+	}
+
+	services := map[string]map[string]*firewallv1.Talker{}
+	external := map[string]map[string]*firewallv1.Talker{}
+	for _, flow := range flows {
+		client := flow.Forward.SrcIP.String()
+		bytes := flow.Forward.Bytes + flow.Reverse.Bytes
+
+		if src := sources.Match(protocolName(flow.Forward.Protocol), flow.Forward.SrcIP, flow.Forward.DstIP, flow.Forward.DstPort); src != nil && src.Kind == nft.KindService {
+			addTalker(services, src.Namespace+"/"+src.Name, client, bytes)
+		}
+		// the reply of a translated connection is addressed to the source nat address
+		if network, ok := networks[flow.Reverse.DstIP.String()]; ok && !flow.Forward.SrcIP.Equal(flow.Reverse.DstIP) {
+			addTalker(external, network, client, bytes)
+		}
+	}
+
+	return &firewallv1.TopTalkers{
+		Updated:  metav1.NewTime(now),
+		Services: topN(services, n),
+		Networks: topN(external, n),
+	}
+}
+
+func addTalker(talkers map[string]map[string]*firewallv1.Talker, target, ip string, bytes uint64) {
+	if talkers[target] == nil {
+		talkers[target] = map[string]*firewallv1.Talker{}
+	}
+	t, ok := talkers[target][ip]
+	if !ok {
+		t = &firewallv1.Talker{IP: ip}
+		talkers[target][ip] = t
+	}
+	t.Connections++
+	t.Bytes += bytes
+}
+
+// topN orders the talkers of every target by bytes and connections and keeps the first n
+func topN(talkers map[string]map[string]*firewallv1.Talker, n int) map[string][]firewallv1.Talker {
+	if len(talkers) == 0 {
+		return nil
+	}
+	result := map[string][]firewallv1.Talker{}
+	for target, byIP := range talkers {
+		list := []firewallv1.Talker{}
+		for _, t := range byIP {
+			list = append(list, *t)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Bytes != list[j].Bytes {
+				return list[i].Bytes > list[j].Bytes
+			}
+			if list[i].Connections != list[j].Connections {
+				return list[i].Connections > list[j].Connections
+			}
+			return list[i].IP < list[j].IP
+		})
+		if len(list) > n {
+			list = list[:n]
+		}
+		result[target] = list
+	}
+	return result
+}
+
+func protocolName(protocol uint8) string {
+	switch protocol {
+	case syscall.IPPROTO_TCP:
+		return "tcp"
+	case syscall.IPPROTO_UDP:
+		return "udp"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	nft "github.com/metal-stack/firewall-controller/pkg/nftables"
+)
+
+func TestTopTalkers(t *testing.T) {
+	svcs := &corev1.ServiceList{
+		Items: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "svc", UID: "1"},
+				Spec: corev1.ServiceSpec{
+					Type:        corev1.ServiceTypeClusterIP,
+					ExternalIPs: []string{"185.0.0.1"},
+					Ports:       []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 443}},
+				},
+			},
+		},
+	}
+	sources := nft.NewFirewall(&firewallv1.ClusterwideNetworkPolicyList{}, svcs, &corev1.NodeList{}, nil, firewallv1.FirewallSpec{}, logr.Discard()).FlowSources()
+	egressRules := []firewallv1.EgressRuleSNAT{
+		{NetworkID: "internet", IPs: []string{"185.1.2.3"}},
+	}
+
+	withBytes := func(f *netlink.ConntrackFlow, forward, reverse uint64) *netlink.ConntrackFlow {
+		f.Forward.Bytes = forward
+		f.Reverse.Bytes = reverse
+		return f
+	}
+	flows := []*netlink.ConntrackFlow{
+		// connections to the service
+		withBytes(flow("1.1.1.1", "185.0.0.1", 443, "185.0.0.1", "1.1.1.1", 40000), 100, 1000),
+		withBytes(flow("1.1.1.1", "185.0.0.1", 443, "185.0.0.1", "1.1.1.1", 40001), 100, 1000),
+		withBytes(flow("2.2.2.2", "185.0.0.1", 443, "185.0.0.1", "2.2.2.2", 40000), 100, 100),
+		withBytes(flow("3.3.3.3", "185.0.0.1", 443, "185.0.0.1", "3.3.3.3", 40000), 100, 100),
+		// the service port is not exposed
+		withBytes(flow("4.4.4.4", "185.0.0.1", 80, "185.0.0.1", "4.4.4.4", 40000), 10000, 10000),
+		// translated connections to the internet
+		withBytes(flow("10.0.0.1", "8.8.8.8", 53, "8.8.8.8", "185.1.2.3", 40000), 50, 50),
+		withBytes(flow("10.0.0.2", "1.1.1.1", 443, "1.1.1.1", "185.1.2.3", 40001), 500, 5000),
+		// a connection of the firewall itself is not translated
+		withBytes(flow("185.1.2.3", "1.1.1.1", 443, "1.1.1.1", "185.1.2.3", 50000), 10000, 10000),
+	}
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := topTalkers(flows, sources, egressRules, 2, now)
+	want := &firewallv1.TopTalkers{
+		Updated: metav1.NewTime(now),
+		Services: map[string][]firewallv1.Talker{
+			"test/svc": {
+				{IP: "1.1.1.1", Connections: 2, Bytes: 2200},
+				{IP: "2.2.2.2", Connections: 1, Bytes: 200},
+			},
+		},
+		Networks: map[string][]firewallv1.Talker{
+			"internet": {
+				{IP: "10.0.0.2", Connections: 1, Bytes: 5500},
+				{IP: "10.0.0.1", Connections: 1, Bytes: 100},
+			},
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("topTalkers() diff: %v", cmp.Diff(got, want))
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	source := &firewallv1.RuleSource{Kind: nft.KindService, Namespace: "test", Name: "svc", UID: "1", Rule: "nodeport", Protocol: "tcp"}
+	ruleStats := func(packets uint64) firewallv1.RuleStatsByAction {
+		return firewallv1.RuleStatsByAction{
+			"accept": firewallv1.RuleStats{
+				"accept established connections": firewallv1.RuleStat{},
+				"k8s:svc/test/svc/1/nodeport/tcp": firewallv1.RuleStat{
+					Source:     source,
+					Cumulative: firewallv1.Counter{Packets: packets},
+				},
+			},
+		}
+	}
+
+	listed := 0
+	listFlows := func() ([]*netlink.ConntrackFlow, error) {
+		listed++
+		return nil, nil
+	}
+	file := filepath.Join(t.TempDir(), "rule-usage.json")
+	a := NewAnalyzer(10, time.Hour, 5*time.Minute, file, logr.Discard())
+	a.listFlows = listFlows
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastHit := metav1.NewTime(start.Add(time.Hour + 30*time.Minute))
+	tests := []struct {
+		name    string
+		after   time.Duration
+		packets uint64
+		want    []firewallv1.UnusedRule
+		listed  int
+		restart bool
+	}{
+		{
+			name:   "rule seen the first time",
+			listed: 1,
+		},
+		{
+			name:   "top talkers are cached within the interval",
+			after:  time.Minute,
+			listed: 1,
+		},
+		{
+			name:   "rule without match for the period",
+			after:  time.Hour,
+			want:   []firewallv1.UnusedRule{{Action: "accept", Comment: "k8s:svc/test/svc/1/nodeport/tcp", Source: source, Since: metav1.NewTime(start)}},
+			listed: 2,
+		},
+		{
+			name:    "rule matched traffic",
+			after:   time.Hour + 30*time.Minute,
+			packets: 1,
+			listed:  3,
+		},
+		{
+			name:    "rule without match since the last hit",
+			after:   2*time.Hour + 30*time.Minute,
+			packets: 1,
+			want:    []firewallv1.UnusedRule{{Action: "accept", Comment: "k8s:svc/test/svc/1/nodeport/tcp", Source: source, LastHit: &lastHit, Since: lastHit}},
+			listed:  4,
+		},
+		{
+			name:    "usage is restored after a restart",
+			after:   2*time.Hour + 31*time.Minute,
+			packets: 1,
+			want:    []firewallv1.UnusedRule{{Action: "accept", Comment: "k8s:svc/test/svc/1/nodeport/tcp", Source: source, LastHit: &lastHit, Since: lastHit}},
+			listed:  5,
+			restart: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.restart {
+				a = NewAnalyzer(10, time.Hour, 5*time.Minute, file, logr.Discard())
+				a.listFlows = listFlows
+			}
+			stats := &firewallv1.FirewallStats{RuleStats: ruleStats(tt.packets)}
+			if err := a.Analyze(stats, nil, nil, start.Add(tt.after)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(stats.UnusedRules, tt.want) {
+				t.Errorf("UnusedRules diff: %v", cmp.Diff(stats.UnusedRules, tt.want))
+			}
+			if stats.TopTalkers == nil {
+				t.Errorf("expected top talkers")
+			}
+			if listed != tt.listed {
+				t.Errorf("expected the connections to be listed %d times, got %d", tt.listed, listed)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// SNATPorts is the number of ports of a source nat address available for the connections to a single destination
+const SNATPorts = 65535 - 1024 + 1
+
+const (
+	conntrackMaxFile = "/proc/sys/net/netfilter/nf_conntrack_max"
+
+	// the following constants are taken from linux/netfilter/nfnetlink.h and linux/netfilter/nfnetlink_conntrack.h
+	nfnlSubsysCtnetlink      = 1
+	ipctnlMsgCtGetStatsCPU   = 4
+	ipctnlMsgCtGetStats      = 5
+	ctaStatsInsertFailed     = 9
+	ctaStatsDrop             = 10
+	ctaStatsEarlyDrop        = 11
+	ctaStatsGlobalEntries    = 1
+	ctaStatsGlobalMaxEntries = 2
+	// nlaTypeMask strips the nested and byte order flags from an attribute type, see linux/netlink.h
+	nlaTypeMask = 0x3fff
+)
+
+// CollectConntrackStats collects the statistics of the conntrack table via netlink,
+// together with the usage of the source nat addresses of the given egress rules.
+func CollectConntrackStats(egressRules []firewallv1.EgressRuleSNAT) (*firewallv1.ConntrackStats, error) {
+	stats := &firewallv1.ConntrackStats{}
+
+	global, err := conntrackRequest(ipctnlMsgCtGetStats, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get conntrack statistics: %w", err)
+	}
+	perCPU, err := conntrackRequest(ipctnlMsgCtGetStatsCPU, syscall.NLM_F_DUMP)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get conntrack statistics per cpu: %w", err)
+	}
+	if err := parseConntrackStats(stats, global, perCPU); err != nil {
+		return nil, err
+	}
+
+	// older kernels do not report the size of the table
+	if stats.Max == 0 {
+		max, err := readConntrackMax()
+		if err != nil {
+			return nil, err
+		}
+		stats.Max = max
+	}
+
+	flows, err := netlink.ConntrackTableList(netlink.ConntrackTable, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list conntrack table: %w", err)
+	}
+	stats.SNAT = snatUsage(flows, egressRules)
+
+	return stats, nil
+}
+
+// conntrackRequest sends a request of the given type to the conntrack subsystem of netfilter and returns the payload of the responses
+func conntrackRequest(msgType, flags int) ([][]byte, error) {
+	req := nl.NewNetlinkRequest((nfnlSubsysCtnetlink<<8)|msgType, flags)
+	req.AddData(&nl.Nfgenmsg{
+		NfgenFamily: syscall.AF_UNSPEC,
+		Version:     nl.NFNETLINK_V0,
+	})
+	return req.Execute(syscall.NETLINK_NETFILTER, 0)
+}
+
+// parseConntrackStats parses the global statistics and sums up the statistics per cpu
+func parseConntrackStats(stats *firewallv1.ConntrackStats, global, perCPU [][]byte) error {
+	for _, msg := range global {
+		attrs, err := parseStatsAttributes(msg)
+		if err != nil {
+			return err
+		}
+		stats.Entries = attrs[ctaStatsGlobalEntries]
+		stats.Max = attrs[ctaStatsGlobalMaxEntries]
+	}
+	for _, msg := range perCPU {
+		attrs, err := parseStatsAttributes(msg)
+		if err != nil {
+			return err
+		}
+		stats.InsertFailed += attrs[ctaStatsInsertFailed]
+		stats.Drop += attrs[ctaStatsDrop]
+		stats.EarlyDrop += attrs[ctaStatsEarlyDrop]
+	}
+	return nil
+}
+
+// parseStatsAttributes parses the attributes of a conntrack statistics message, all of them are 32 bit values in network byte order
+func parseStatsAttributes(msg []byte) (map[uint16]uint64, error) {
+	if len(msg) < nl.SizeofNfgenmsg {
+		return nil, fmt.Errorf("conntrack statistics message is too short")
+	}
+	attrs, err := nl.ParseRouteAttr(msg[nl.SizeofNfgenmsg:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse conntrack statistics: %w", err)
+	}
+	values := map[uint16]uint64{}
+	for _, a := range attrs {
+		if len(a.Value) < 4 {
+			continue
+		}
+		values[a.Attr.Type&nlaTypeMask] = uint64(binary.BigEndian.Uint32(a.Value))
+	}
+	return values, nil
+}
+
+func readConntrackMax() (uint64, error) {
+	data, err := ioutil.ReadFile(conntrackMaxFile)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read size of conntrack table: %w", err)
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// snatUsage counts the connections translated to the source nat addresses of the egress rules.
+// The reply of a translated connection is addressed to the source nat address, while the original connection is not.
+// As a source nat address may reuse its ports for different destinations, the ports are counted per destination.
+func snatUsage(flows []*netlink.ConntrackFlow, egressRules []firewallv1.EgressRuleSNAT) map[string]firewallv1.SNATStat {
+	usage := map[string]firewallv1.SNATStat{}
+	for _, rule := range egressRules {
+		for _, ip := range rule.IPs {
+			if net.ParseIP(ip) == nil {
+				continue
+			}
+			usage[ip] = firewallv1.SNATStat{NetworkID: rule.NetworkID}
+		}
+	}
+	if len(usage) == 0 {
+		return nil
+	}
+
+	type destination struct {
+		snatIP   string
+		protocol uint8
+		ip       string
+		port     uint16
+	}
+	ports := map[destination]uint64{}
+	for _, flow := range flows {
+		ip := flow.Reverse.DstIP.String()
+		stat, ok := usage[ip]
+		if !ok || flow.Forward.SrcIP.Equal(flow.Reverse.DstIP) {
+			continue
+		}
+		d := destination{
+			snatIP:   ip,
+			protocol: flow.Reverse.Protocol,
+			ip:       flow.Reverse.SrcIP.String(),
+			port:     flow.Reverse.SrcPort,
+		}
+		ports[d]++
+		stat.Connections++
+		if ports[d] > stat.Ports {
+			stat.Ports = ports[d]
+		}
+		usage[ip] = stat
+	}
+	return usage
+}
+
+// ConntrackUsage returns the usage of the conntrack table and the highest usage of a source nat address in percent
+func ConntrackUsage(stats *firewallv1.ConntrackStats) (int, int) {
+	if stats == nil {
+		return 0, 0
+	}
+	table := 0
+	if stats.Max > 0 {
+		table = int(stats.Entries * 100 / stats.Max)
+	}
+	snat := 0
+	for _, s := range stats.SNAT {
+		if u := int(s.Ports * 100 / SNATPorts); u > snat {
+			snat = u
+		}
+	}
+	return table, snat
+}
+
+// ConntrackThresholds detects the usage of the conntrack table and of the source nat addresses crossing a threshold in percent
+type ConntrackThresholds struct {
+	lock          sync.Mutex
+	table         int
+	snat          int
+	tableExceeded bool
+	snatExceeded  map[string]bool
+}
+
+// NewConntrackThresholds creates new thresholds for the usage of the conntrack table and of the source nat addresses in percent,
+// a threshold of zero disables the check
+func NewConntrackThresholds(table, snat int) *ConntrackThresholds {
+	return &ConntrackThresholds{
+		table:        table,
+		snat:         snat,
+		snatExceeded: map[string]bool{},
+	}
+}
+
+// Check returns a warning for every usage which crossed its threshold since the previous check,
+// the usage has to drop below the threshold again before it is reported anew.
+func (t *ConntrackThresholds) Check(stats *firewallv1.ConntrackStats) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if stats == nil {
+		return nil
+	}
+	warnings := []string{}
+
+	table, _ := ConntrackUsage(stats)
+	exceeded := t.table > 0 && table >= t.table
+	if exceeded && !t.tableExceeded {
+		warnings = append(warnings, fmt.Sprintf("conntrack table usage at %d%% (%d of %d entries) crossed the threshold of %d%%", table, stats.Entries, stats.Max, t.table))
+	}
+	t.tableExceeded = exceeded
+
+	ips := []string{}
+	for ip := range stats.SNAT {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	snatExceeded := map[string]bool{}
+	for _, ip := range ips {
+		s := stats.SNAT[ip]
+		usage := int(s.Ports * 100 / SNATPorts)
+		if t.snat <= 0 || usage < t.snat {
+			continue
+		}
+		snatExceeded[ip] = true
+		if !t.snatExceeded[ip] {
+			warnings = append(warnings, fmt.Sprintf("snat port usage of %s (networkid: %s) at %d%% crossed the threshold of %d%%", ip, s.NetworkID, usage, t.snat))
+		}
+	}
+	t.snatExceeded = snatExceeded
+
+	return warnings
+}
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func statsMessage(values map[int]uint32) []byte {
+	msg := make([]byte, nl.SizeofNfgenmsg)
+	for attrType, value := range values {
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, value)
+		msg = append(msg, nl.NewRtAttr(attrType, v).Serialize()...)
+	}
+	return msg
+}
+
+func TestParseConntrackStats(t *testing.T) {
+	global := [][]byte{
+		statsMessage(map[int]uint32{ctaStatsGlobalEntries: 1200, ctaStatsGlobalMaxEntries: 262144}),
+	}
+	perCPU := [][]byte{
+		statsMessage(map[int]uint32{ctaStatsInsertFailed: 1, ctaStatsDrop: 2, ctaStatsEarlyDrop: 3, 2: 4711}),
+		statsMessage(map[int]uint32{ctaStatsInsertFailed: 10, ctaStatsDrop: 20, ctaStatsEarlyDrop: 30}),
+	}
+
+	got := &firewallv1.ConntrackStats{}
+	if err := parseConntrackStats(got, global, perCPU); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &firewallv1.ConntrackStats{
+		Entries:      1200,
+		Max:          262144,
+		InsertFailed: 11,
+		Drop:         22,
+		EarlyDrop:    33,
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("parseConntrackStats() diff: %v", cmp.Diff(got, want))
+	}
+
+	if err := parseConntrackStats(got, [][]byte{{0}}, nil); err == nil {
+		t.Errorf("expected an error for a truncated message")
+	}
+}
+
+func flow(src, dst string, dport uint16, replySrc, replyDst string, sport uint16) *netlink.ConntrackFlow {
+	f := &netlink.ConntrackFlow{}
+	f.Forward.Protocol = 6
+	f.Forward.SrcIP = net.ParseIP(src)
+	f.Forward.DstIP = net.ParseIP(dst)
+	f.Forward.SrcPort = sport
+	f.Forward.DstPort = dport
+	f.Reverse.Protocol = 6
+	f.Reverse.SrcIP = net.ParseIP(replySrc)
+	f.Reverse.DstIP = net.ParseIP(replyDst)
+	f.Reverse.SrcPort = dport
+	f.Reverse.DstPort = sport
+	return f
+}
+
+func TestSNATUsage(t *testing.T) {
+	egressRules := []firewallv1.EgressRuleSNAT{
+		{NetworkID: "internet", IPs: []string{"185.1.2.3", "185.1.2.4"}},
+		{NetworkID: "mpls", IPs: []string{"100.1.2.3", "invalid"}},
+	}
+	flows := []*netlink.ConntrackFlow{
+		// translated connections
+		flow("10.0.0.1", "1.1.1.1", 443, "1.1.1.1", "185.1.2.3", 40000),
+		flow("10.0.0.2", "1.1.1.1", 443, "1.1.1.1", "185.1.2.3", 40001),
+		flow("10.0.0.1", "1.1.1.1", 80, "1.1.1.1", "185.1.2.3", 40002),
+		flow("10.0.0.1", "8.8.8.8", 53, "8.8.8.8", "100.1.2.3", 40000),
+		// a connection of the firewall itself is not translated
+		flow("185.1.2.4", "1.1.1.1", 443, "1.1.1.1", "185.1.2.4", 50000),
+		// an unrelated connection
+		flow("10.0.0.1", "10.0.0.2", 22, "10.0.0.2", "10.0.0.1", 50000),
+	}
+
+	want := map[string]firewallv1.SNATStat{
+		"185.1.2.3": {NetworkID: "internet", Connections: 3, Ports: 2},
+		"185.1.2.4": {NetworkID: "internet"},
+		"100.1.2.3": {NetworkID: "mpls", Connections: 1, Ports: 1},
+	}
+	got := snatUsage(flows, egressRules)
+	if !cmp.Equal(got, want) {
+		t.Errorf("snatUsage() diff: %v", cmp.Diff(got, want))
+	}
+
+	if got := snatUsage(flows, nil); got != nil {
+		t.Errorf("expected no usage without egress rules, got %v", got)
+	}
+}
+
+func TestConntrackThresholds(t *testing.T) {
+	th := NewConntrackThresholds(80, 50)
+	stats := func(entries, ports uint64) *firewallv1.ConntrackStats {
+		return &firewallv1.ConntrackStats{
+			Entries: entries,
+			Max:     1000,
+			SNAT: map[string]firewallv1.SNATStat{
+				"185.1.2.3": {NetworkID: "internet", Ports: ports},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		stats   *firewallv1.ConntrackStats
+		want    []string
+		table   int
+		snatUse int
+	}{
+		{
+			name:  "below thresholds",
+			stats: stats(500, 100),
+			want:  []string{},
+			table: 50,
+		},
+		{
+			name:  "table crosses threshold",
+			stats: stats(850, 100),
+			want: []string{
+				"conntrack table usage at 85% (850 of 1000 entries) crossed the threshold of 80%",
+			},
+			table: 85,
+		},
+		{
+			name:    "already reported, snat crosses threshold",
+			stats:   stats(900, 40000),
+			want:    []string{"snat port usage of 185.1.2.3 (networkid: internet) at 62% crossed the threshold of 50%"},
+			table:   90,
+			snatUse: 62,
+		},
+		{
+			name:  "usage drops",
+			stats: stats(100, 100),
+			want:  []string{},
+			table: 10,
+		},
+		{
+			name:  "table crosses threshold again",
+			stats: stats(800, 100),
+			want: []string{
+				"conntrack table usage at 80% (800 of 1000 entries) crossed the threshold of 80%",
+			},
+			table: 80,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := th.Check(tt.stats)
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("Check() diff: %v", cmp.Diff(got, tt.want))
+			}
+			table, snat := ConntrackUsage(tt.stats)
+			if table != tt.table || snat != tt.snatUse {
+				t.Errorf("ConntrackUsage() = %d, %d, want %d, %d", table, snat, tt.table, tt.snatUse)
+			}
+		})
+	}
+
+	if got := NewConntrackThresholds(0, 0).Check(stats(1000, SNATPorts)); len(got) != 0 {
+		t.Errorf("expected disabled thresholds to report nothing, got %v", got)
+	}
+}
@@ -0,0 +1,391 @@
+package collector
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/droptailer"
+)
+
+const (
+	// DefaultDropWindow is the default period the dropped packets are aggregated for
+	DefaultDropWindow = 5 * time.Minute
+	// DefaultTopDrops is the default number of aggregates with the most dropped packets which are reported
+	DefaultTopDrops = 10
+	// DefaultServiceDropRate is the default rate of packets per second dropped on their way to a service which triggers a warning
+	DefaultServiceDropRate = 1.0
+
+	// dropBuckets is the number of buckets the window slides by
+	dropBuckets = 10
+	// maxDropAggregates limits the aggregates of a bucket, e.g. during a port scan, further drops are counted as otherDrops
+	maxDropAggregates = 10000
+	// otherDrops is the source network, destination and protocol of the drops above maxDropAggregates
+	otherDrops = "other"
+	// serviceDropSources is the number of source networks reported for a service with dropped packets
+	serviceDropSources = 3
+)
+
+var (
+	serviceDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "service", "dropped_packets_total"),
+		"Packets to the load balancer ip of a service dropped by the firewall rules.",
+		[]string{"service"}, nil,
+	)
+	topDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "top_drop", "packets"),
+		"Packets dropped within the window for the aggregates with the most dropped packets.",
+		[]string{"source_network", "destination", "service", "protocol", "port"}, nil,
+	)
+)
+
+type (
+	// DropAggregator aggregates the packets dropped by the firewall rules by source network, destination, protocol and port over a sliding window.
+	// It implements droptailer.DropObserver to receive the drops and prometheus.Collector to expose them.
+	DropAggregator struct {
+		lock        sync.Mutex
+		window      time.Duration
+		bucket      time.Duration
+		topN        int
+		serviceRate float64
+
+		buckets  []*dropBucket
+		networks []dropNetwork
+		services map[serviceAddress]string
+		// serviceTotals counts the dropped packets of the services since the start
+		serviceTotals map[string]uint64
+		// warned contains the services whose drop rate is above the threshold since the last check
+		warned map[string]bool
+	}
+
+	dropKey struct {
+		sourceNetwork string
+		destination   string
+		service       string
+		protocol      string
+		port          uint16
+	}
+
+	dropBucket struct {
+		start  time.Time
+		counts map[dropKey]uint64
+	}
+
+	dropNetwork struct {
+		id       string
+		prefixes []*net.IPNet
+	}
+
+	serviceAddress struct {
+		ip       string
+		protocol string
+		port     uint16
+	}
+
+	// ServiceDrops is a service the packets to its load balancer ip are dropped at a significant rate
+	ServiceDrops struct {
+		// Namespace and Name of the service
+		Namespace string
+		Name      string
+		// Rate is the number of packets per second dropped within the window
+		Rate float64
+		// Sources are the source networks with the most dropped packets
+		Sources []string
+	}
+)
+
+// NewDropAggregator creates a new aggregator for the given window which reports the top n aggregates.
+// A service is reported once the packets dropped on their way to it exceed the given rate per second, zero disables the check.
+func NewDropAggregator(window time.Duration, topN int, serviceRate float64) *DropAggregator {
+	bucket := window / dropBuckets
+	if bucket < time.Second {
+		bucket = time.Second
+	}
+	return &DropAggregator{
+		window:        window,
+		bucket:        bucket,
+		topN:          topN,
+		serviceRate:   serviceRate,
+		services:      map[serviceAddress]string{},
+		serviceTotals: map[string]uint64{},
+		warned:        map[string]bool{},
+	}
+}
+
+// SetTargets sets the firewall networks the sources of the drops are attributed to and the services whose load balancer ips are attributed to them
+func (a *DropAggregator) SetTargets(firewallNetworks []firewallv1.FirewallNetwork, services []corev1.Service) {
+	networks := []dropNetwork{}
+	for _, n := range firewallNetworks {
+		if n.Networkid == nil {
+			continue
+		}
+		network := dropNetwork{id: *n.Networkid}
+		for _, prefix := range n.Prefixes {
+			_, ipnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				continue
+			}
+			network.prefixes = append(network.prefixes, ipnet)
+		}
+		networks = append(networks, network)
+	}
+
+	addresses := map[serviceAddress]string{}
+	for _, svc := range services {
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		ips := []string{svc.Spec.LoadBalancerIP}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			ips = append(ips, ingress.IP)
+		}
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				continue
+			}
+			for _, p := range svc.Spec.Ports {
+				protocol := string(p.Protocol)
+				if protocol == "" {
+					protocol = string(corev1.ProtocolTCP)
+				}
+				addresses[serviceAddress{ip: ip, protocol: protocol, port: uint16(p.Port)}] = svc.Namespace + "/" + svc.Name
+			}
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.networks = networks
+	a.services = addresses
+}
+
+// ObserveDrop implements droptailer.DropObserver
+func (a *DropAggregator) ObserveDrop(d droptailer.Drop) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key := dropKey{
+		sourceNetwork: a.sourceNetwork(d.Source),
+		destination:   d.Destination.String(),
+		protocol:      d.Protocol,
+		port:          d.DestinationPort,
+	}
+	key.service = a.services[serviceAddress{ip: key.destination, protocol: key.protocol, port: key.port}]
+	if key.service != "" {
+		a.serviceTotals[key.service]++
+	}
+
+	start := d.Timestamp.Truncate(a.bucket)
+	if len(a.buckets) == 0 || start.After(a.buckets[len(a.buckets)-1].start) {
+		a.buckets = append(a.buckets, &dropBucket{start: start, counts: map[dropKey]uint64{}})
+		a.prune(d.Timestamp)
+	}
+	// drops with an older timestamp are counted in the current bucket
+	b := a.buckets[len(a.buckets)-1]
+	if _, ok := b.counts[key]; !ok && len(b.counts) >= maxDropAggregates {
+		key = dropKey{sourceNetwork: otherDrops, destination: otherDrops, service: key.service, protocol: otherDrops}
+	}
+	b.counts[key]++
+}
+
+// Summary returns the n aggregates with the most dropped packets within the window and the packets dropped per service
+func (a *DropAggregator) Summary(now time.Time) *firewallv1.DropSummary {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.prune(now)
+	summary := &firewallv1.DropSummary{
+		Updated: metav1.NewTime(now),
+		Window:  metav1.Duration{Duration: a.window},
+	}
+	counts := a.counts()
+	for key, packets := range counts {
+		if key.service == "" {
+			continue
+		}
+		if summary.Services == nil {
+			summary.Services = map[string]uint64{}
+		}
+		summary.Services[key.service] += packets
+	}
+	summary.Drops = topDrops(counts, a.topN)
+	return summary
+}
+
+// Check returns the services whose packets were dropped above the rate within the window since the previous check,
+// the rate has to drop below the threshold again before a service is reported anew.
+func (a *DropAggregator) Check(now time.Time) []ServiceDrops {
+	if a.serviceRate <= 0 {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.prune(now)
+	packets := map[string]uint64{}
+	sources := map[string]map[string]uint64{}
+	for key, count := range a.counts() {
+		if key.service == "" {
+			continue
+		}
+		packets[key.service] += count
+		if sources[key.service] == nil {
+			sources[key.service] = map[string]uint64{}
+		}
+		sources[key.service][key.sourceNetwork] += count
+	}
+
+	result := []ServiceDrops{}
+	warned := map[string]bool{}
+	for service, count := range packets {
+		rate := float64(count) / a.window.Seconds()
+		if rate < a.serviceRate {
+			continue
+		}
+		warned[service] = true
+		if a.warned[service] {
+			continue
+		}
+		parts := strings.SplitN(service, "/", 2)
+		result = append(result, ServiceDrops{
+			Namespace: parts[0],
+			Name:      parts[1],
+			Rate:      rate,
+			Sources:   topSources(sources[service], serviceDropSources),
+		})
+	}
+	a.warned = warned
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Describe implements prometheus.Collector
+func (a *DropAggregator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serviceDropsDesc
+	ch <- topDropsDesc
+}
+
+// Collect implements prometheus.Collector
+func (a *DropAggregator) Collect(ch chan<- prometheus.Metric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for service, count := range a.serviceTotals {
+		ch <- prometheus.MustNewConstMetric(serviceDropsDesc, prometheus.CounterValue, float64(count), service)
+	}
+	a.prune(time.Now())
+	for _, d := range topDrops(a.counts(), a.topN) {
+		ch <- prometheus.MustNewConstMetric(topDropsDesc, prometheus.GaugeValue, float64(d.Packets), d.SourceNetwork, d.Destination, d.Service, d.Protocol, strconv.Itoa(int(d.Port)))
+	}
+}
+
+// sourceNetwork returns the id of the firewall network with the longest prefix containing the ip, otherwise the /24 network of the ip
+func (a *DropAggregator) sourceNetwork(ip net.IP) string {
+	network := ""
+	bits := -1
+	for _, n := range a.networks {
+		for _, prefix := range n.prefixes {
+			ones, _ := prefix.Mask.Size()
+			if ones > bits && prefix.Contains(ip) {
+				network = n.id
+				bits = ones
+			}
+		}
+	}
+	if network != "" {
+		return network
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%s/24", ip4.Mask(net.CIDRMask(24, 32)))
+	}
+	return ip.String()
+}
+
+// prune drops the buckets which ended before the window
+func (a *DropAggregator) prune(now time.Time) {
+	from := now.Add(-a.window)
+	for len(a.buckets) > 0 && !a.buckets[0].start.Add(a.bucket).After(from) {
+		a.buckets = a.buckets[1:]
+	}
+}
+
+// counts sums up the dropped packets of the buckets within the window
+func (a *DropAggregator) counts() map[dropKey]uint64 {
+	counts := map[dropKey]uint64{}
+	for _, b := range a.buckets {
+		for key, count := range b.counts {
+			counts[key] += count
+		}
+	}
+	return counts
+}
+
+// topDrops orders the aggregates by packets and keeps the first n
+func topDrops(counts map[dropKey]uint64, n int) []firewallv1.DropAggregate {
+	drops := []firewallv1.DropAggregate{}
+	for key, packets := range counts {
+		drops = append(drops, firewallv1.DropAggregate{
+			SourceNetwork: key.sourceNetwork,
+			Destination:   key.destination,
+			Service:       key.service,
+			Protocol:      key.protocol,
+			Port:          key.port,
+			Packets:       packets,
+		})
+	}
+	sort.Slice(drops, func(i, j int) bool {
+		if drops[i].Packets != drops[j].Packets {
+			return drops[i].Packets > drops[j].Packets
+		}
+		if drops[i].SourceNetwork != drops[j].SourceNetwork {
+			return drops[i].SourceNetwork < drops[j].SourceNetwork
+		}
+		if drops[i].Destination != drops[j].Destination {
+			return drops[i].Destination < drops[j].Destination
+		}
+		if drops[i].Protocol != drops[j].Protocol {
+			return drops[i].Protocol < drops[j].Protocol
+		}
+		return drops[i].Port < drops[j].Port
+	})
+	if len(drops) > n {
+		drops = drops[:n]
+	}
+	if len(drops) == 0 {
+		return nil
+	}
+	return drops
+}
+
+// topSources returns the n source networks with the most packets
+func topSources(packets map[string]uint64, n int) []string {
+	sources := []string{}
+	for source := range packets {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if packets[sources[i]] != packets[sources[j]] {
+			return packets[sources[i]] > packets[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+	if len(sources) > n {
+		sources = sources[:n]
+	}
+	return sources
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/droptailer"
+)
+
+func TestDropAggregator(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	a := NewDropAggregator(time.Minute, 3, 1)
+
+	internal := "internal"
+	a.SetTargets(
+		[]firewallv1.FirewallNetwork{
+			{Networkid: &internal, Prefixes: []string{"10.0.0.0/22"}},
+		},
+		[]corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+				Spec: corev1.ServiceSpec{
+					Type:  corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{{Port: 443}},
+				},
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "185.1.2.3"}}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.244.0.1", Ports: []corev1.ServicePort{{Port: 80}}},
+			},
+		},
+	)
+	drop := func(offset time.Duration, src, dst, proto string, port uint16) droptailer.Drop {
+		return droptailer.Drop{
+			Timestamp:       start.Add(offset),
+			Source:          net.ParseIP(src),
+			Destination:     net.ParseIP(dst),
+			Protocol:        proto,
+			DestinationPort: port,
+		}
+	}
+
+	a.ObserveDrop(drop(0, "10.0.1.5", "1.1.1.1", "UDP", 53))
+	for i := 0; i < 90; i++ {
+		a.ObserveDrop(drop(30*time.Second, "8.8.4.4", "185.1.2.3", "TCP", 443))
+	}
+	a.ObserveDrop(drop(30*time.Second, "8.8.8.8", "185.1.2.3", "TCP", 443))
+	a.ObserveDrop(drop(40*time.Second, "9.9.9.9", "185.1.2.3", "TCP", 22))
+	a.ObserveDrop(drop(40*time.Second, "9.9.9.9", "10.244.0.1", "TCP", 80))
+
+	tests := []struct {
+		name        string
+		now         time.Duration
+		wantSummary *firewallv1.DropSummary
+		wantCheck   []ServiceDrops
+	}{
+		{
+			name: "drops within the window",
+			now:  50 * time.Second,
+			wantSummary: &firewallv1.DropSummary{
+				Updated: metav1.NewTime(start.Add(50 * time.Second)),
+				Window:  metav1.Duration{Duration: time.Minute},
+				Drops: []firewallv1.DropAggregate{
+					{SourceNetwork: "8.8.4.0/24", Destination: "185.1.2.3", Service: "default/web", Protocol: "TCP", Port: 443, Packets: 90},
+					{SourceNetwork: "8.8.8.0/24", Destination: "185.1.2.3", Service: "default/web", Protocol: "TCP", Port: 443, Packets: 1},
+					{SourceNetwork: "9.9.9.0/24", Destination: "10.244.0.1", Protocol: "TCP", Port: 80, Packets: 1},
+				},
+				Services: map[string]uint64{"default/web": 91},
+			},
+			wantCheck: []ServiceDrops{
+				{Namespace: "default", Name: "web", Rate: 91.0 / 60, Sources: []string{"8.8.4.0/24", "8.8.8.0/24"}},
+			},
+		},
+		{
+			name: "already reported, first drop left the window",
+			now:  70 * time.Second,
+			wantSummary: &firewallv1.DropSummary{
+				Updated: metav1.NewTime(start.Add(70 * time.Second)),
+				Window:  metav1.Duration{Duration: time.Minute},
+				Drops: []firewallv1.DropAggregate{
+					{SourceNetwork: "8.8.4.0/24", Destination: "185.1.2.3", Service: "default/web", Protocol: "TCP", Port: 443, Packets: 90},
+					{SourceNetwork: "8.8.8.0/24", Destination: "185.1.2.3", Service: "default/web", Protocol: "TCP", Port: 443, Packets: 1},
+					{SourceNetwork: "9.9.9.0/24", Destination: "10.244.0.1", Protocol: "TCP", Port: 80, Packets: 1},
+				},
+				Services: map[string]uint64{"default/web": 91},
+			},
+			wantCheck: []ServiceDrops{},
+		},
+		{
+			name: "all drops left the window",
+			now:  2 * time.Minute,
+			wantSummary: &firewallv1.DropSummary{
+				Updated: metav1.NewTime(start.Add(2 * time.Minute)),
+				Window:  metav1.Duration{Duration: time.Minute},
+			},
+			wantCheck: []ServiceDrops{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start.Add(tt.now)
+			got := a.Summary(now)
+			if !cmp.Equal(got, tt.wantSummary) {
+				t.Errorf("Summary() diff: %v", cmp.Diff(got, tt.wantSummary))
+			}
+			gotCheck := a.Check(now)
+			if !cmp.Equal(gotCheck, tt.wantCheck) {
+				t.Errorf("Check() diff: %v", cmp.Diff(gotCheck, tt.wantCheck))
+			}
+		})
+	}
+}
+
+func TestDropAggregatorSourceNetwork(t *testing.T) {
+	internal, pod := "internal", "pod"
+	a := NewDropAggregator(time.Minute, 10, 0)
+	a.SetTargets([]firewallv1.FirewallNetwork{
+		{Networkid: &internal, Prefixes: []string{"10.0.0.0/8"}},
+		{Networkid: &pod, Prefixes: []string{"10.244.0.0/16"}},
+	}, nil)
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.1.5", want: "internal"},
+		{ip: "10.244.3.4", want: "pod"},
+		{ip: "185.1.2.3", want: "185.1.2.0/24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got := a.sourceNetwork(net.ParseIP(tt.ip))
+			if got != tt.want {
+				t.Errorf("sourceNetwork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
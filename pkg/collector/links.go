@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// networkInterfaces are the interfaces created for every firewall network with a vrf
+var networkInterfaces = []string{"vrf%d", "vlan%d", "vni%d"}
+
+// CollectLinkStats collects the statistics of the interfaces of the given firewall networks via netlink
+func CollectLinkStats(networks []firewallv1.FirewallNetwork) (firewallv1.LinkStatsByNetwork, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list links: %w", err)
+	}
+	return linkStats(networks, links), nil
+}
+
+// linkStats groups the statistics of the given links by network, a link belongs to a network
+// if it is one of the interfaces created for the vrf of the network or if it is enslaved to that vrf.
+func linkStats(networks []firewallv1.FirewallNetwork, links []netlink.Link) firewallv1.LinkStatsByNetwork {
+	byName := map[string]netlink.Link{}
+	for _, l := range links {
+		byName[l.Attrs().Name] = l
+	}
+
+	stats := firewallv1.LinkStatsByNetwork{}
+	for _, n := range networks {
+		if n.Networkid == nil || n.Vrf == nil || *n.Vrf == 0 {
+			continue
+		}
+
+		names := map[string]bool{}
+		for _, format := range networkInterfaces {
+			names[fmt.Sprintf(format, *n.Vrf)] = true
+		}
+		if vrf, ok := byName[fmt.Sprintf("vrf%d", *n.Vrf)]; ok {
+			for _, l := range links {
+				if l.Attrs().MasterIndex == vrf.Attrs().Index {
+					names[l.Attrs().Name] = true
+				}
+			}
+		}
+
+		ifaces := firewallv1.LinkStatsByInterface{}
+		for name := range names {
+			l, ok := byName[name]
+			if !ok || l.Attrs().Statistics == nil {
+				continue
+			}
+			s := l.Attrs().Statistics
+			ifaces[name] = firewallv1.LinkStat{
+				InBytes:    s.RxBytes,
+				OutBytes:   s.TxBytes,
+				InPackets:  s.RxPackets,
+				OutPackets: s.TxPackets,
+				InErrors:   s.RxErrors,
+				OutErrors:  s.TxErrors,
+				InDropped:  s.RxDropped,
+				OutDropped: s.TxDropped,
+			}
+		}
+		if len(ifaces) > 0 {
+			stats[*n.Networkid] = ifaces
+		}
+	}
+
+	if len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestLinkStats(t *testing.T) {
+	str := func(s string) *string { return &s }
+	vrf := func(v int64) *int64 { return &v }
+	link := func(name string, index, master int, rx uint64) netlink.Link {
+		return &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			Index:       index,
+			MasterIndex: master,
+			Statistics:  &netlink.LinkStatistics{RxBytes: rx, TxBytes: 2 * rx, RxPackets: 1, TxPackets: 2, RxErrors: 3, TxErrors: 4, RxDropped: 5, TxDropped: 6},
+		}}
+	}
+	stat := func(rx uint64) firewallv1.LinkStat {
+		return firewallv1.LinkStat{InBytes: rx, OutBytes: 2 * rx, InPackets: 1, OutPackets: 2, InErrors: 3, OutErrors: 4, InDropped: 5, OutDropped: 6}
+	}
+
+	networks := []firewallv1.FirewallNetwork{
+		{Networkid: str("private"), Vrf: vrf(3981)},
+		{Networkid: str("internet"), Vrf: vrf(104009)},
+		// the underlay has no vrf
+		{Networkid: str("underlay"), Vrf: vrf(0)},
+		// no interfaces exist for this network
+		{Networkid: str("mpls"), Vrf: vrf(104010)},
+	}
+	links := []netlink.Link{
+		link("lo", 1, 0, 1),
+		link("lan0", 2, 0, 2),
+		link("vrf3981", 10, 0, 100),
+		link("vlan3981", 11, 10, 200),
+		link("vni3981", 12, 13, 300),
+		link("bridge", 13, 0, 400),
+		link("vrf104009", 20, 0, 500),
+		link("vlan104009", 21, 20, 600),
+		// a macvlan enslaved to the vrf
+		link("macvlan0", 22, 20, 700),
+		&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "vni104009", Index: 23}},
+	}
+
+	got := linkStats(networks, links)
+	want := firewallv1.LinkStatsByNetwork{
+		"private": {
+			"vrf3981":  stat(100),
+			"vlan3981": stat(200),
+			"vni3981":  stat(300),
+		},
+		"internet": {
+			"vrf104009":  stat(500),
+			"vlan104009": stat(600),
+			"macvlan0":   stat(700),
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("linkStats() diff: %v", cmp.Diff(got, want))
+	}
+
+	if got := linkStats(nil, links); got != nil {
+		t.Errorf("expected no statistics without networks, got %v", got)
+	}
+}
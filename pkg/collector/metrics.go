@@ -0,0 +1,374 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	nft "github.com/metal-stack/firewall-controller/pkg/nftables"
+)
+
+const metricsNamespace = "firewall"
+
+var (
+	ruleBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "rule", "bytes_total"),
+		"Bytes matched by a nftables rule.",
+		[]string{"comment", "action", "kind", "policy"}, nil,
+	)
+	rulePacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "rule", "packets_total"),
+		"Packets matched by a nftables rule.",
+		[]string{"comment", "action", "kind", "policy"}, nil,
+	)
+	deviceBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "device", "bytes_total"),
+		"Bytes accounted for a device by direction.",
+		[]string{"device", "direction"}, nil,
+	)
+	linkBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "link", "bytes_total"),
+		"Bytes of an interface of a firewall network by direction.",
+		[]string{"networkid", "interface", "direction"}, nil,
+	)
+	linkPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "link", "packets_total"),
+		"Packets of an interface of a firewall network by direction.",
+		[]string{"networkid", "interface", "direction"}, nil,
+	)
+	linkErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "link", "errors_total"),
+		"Errors of an interface of a firewall network by direction.",
+		[]string{"networkid", "interface", "direction"}, nil,
+	)
+	linkDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "link", "drops_total"),
+		"Packets dropped by an interface of a firewall network by direction.",
+		[]string{"networkid", "interface", "direction"}, nil,
+	)
+	ipsQueueWaitingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ips", "queue_waiting_packets"),
+		"Packets waiting in the queue of the inline IPS for the verdict of suricata.",
+		[]string{"queue"}, nil,
+	)
+	ipsQueueDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ips", "queue_drops_total"),
+		"Packets dropped by the queue of the inline IPS, either because the queue was full or the packet could not be passed to suricata.",
+		[]string{"queue", "reason"}, nil,
+	)
+	ipsQueueListeningDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ips", "queue_listening"),
+		"Whether suricata listens on the queue of the inline IPS (1) or the packets bypass the inspection (0).",
+		[]string{"queue"}, nil,
+	)
+	idsPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "packets_total"),
+		"Packets scanned by the IDS on an interface.",
+		[]string{"device"}, nil,
+	)
+	idsDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "drops_total"),
+		"Packets dropped by the IDS on an interface.",
+		[]string{"device"}, nil,
+	)
+	idsInvalidChecksumsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "invalid_checksums_total"),
+		"Packets with invalid checksums seen by the IDS on an interface.",
+		[]string{"device"}, nil,
+	)
+	idsCounterDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "engine_counter"),
+		"Counter of the suricata engine like in its stats.log, e.g. capture.kernel_drops.",
+		[]string{"counter"}, nil,
+	)
+	idsUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "up"),
+		"Whether suricata answers on its command socket (1) or not (0).",
+		nil, nil,
+	)
+	idsUptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "ids", "uptime_seconds"),
+		"Seconds suricata is running.",
+		[]string{"version"}, nil,
+	)
+	conntrackEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "conntrack", "entries"),
+		"Connections in the conntrack table.",
+		nil, nil,
+	)
+	conntrackMaxDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "conntrack", "max_entries"),
+		"Size of the conntrack table.",
+		nil, nil,
+	)
+	conntrackInsertFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "conntrack", "insert_failed_total"),
+		"Connections which could not be inserted into the conntrack table.",
+		nil, nil,
+	)
+	conntrackDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "conntrack", "drops_total"),
+		"Packets dropped because their connection could not be tracked.",
+		nil, nil,
+	)
+	conntrackEarlyDropsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "conntrack", "early_drops_total"),
+		"Connections evicted from a full conntrack table.",
+		nil, nil,
+	)
+	snatConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "snat", "connections"),
+		"Connections translated to a source nat address.",
+		[]string{"ip", "networkid"}, nil,
+	)
+	snatPortsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "snat", "ports"),
+		"Highest number of ports of a source nat address in use for a single destination.",
+		[]string{"ip", "networkid"}, nil,
+	)
+	bgpEstablishedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "bgp", "session_established"),
+		"Whether a BGP session is established (1) or not (0).",
+		[]string{"vrf", "address_family", "peer"}, nil,
+	)
+	bgpUptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "bgp", "session_uptime_seconds"),
+		"Seconds a BGP session is in its current state.",
+		[]string{"vrf", "address_family", "peer"}, nil,
+	)
+	bgpPrefixesReceivedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "bgp", "prefixes_received"),
+		"Prefixes received from a BGP neighbor.",
+		[]string{"vrf", "address_family", "peer"}, nil,
+	)
+	bgpPrefixesAdvertisedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "bgp", "prefixes_advertised"),
+		"Prefixes advertised to a BGP neighbor.",
+		[]string{"vrf", "address_family", "peer"}, nil,
+	)
+	talkerBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "top_talker", "bytes"),
+		"Traffic of the open connections of the clients with the most traffic to a service or an external network.",
+		[]string{"kind", "target", "ip"}, nil,
+	)
+	talkerConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "top_talker", "connections"),
+		"Open connections of the clients with the most traffic to a service or an external network.",
+		[]string{"kind", "target", "ip"}, nil,
+	)
+	certificateExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "droptailer", "certificate_expiry_timestamp_seconds"),
+		"Time the client certificate for the droptailer servers or its ca expires.",
+		[]string{"certificate", "subject"}, nil,
+	)
+	ruleUnusedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "rule", "unused_seconds"),
+		"Seconds since a rule generated for a kubernetes object last matched traffic, only reported for unused rules.",
+		[]string{"comment", "action", "kind", "policy"}, nil,
+	)
+)
+
+// FirewallMetrics exposes the firewall statistics gathered during the last status update as prometheus metrics,
+// the counters are accumulated across reloads of the ruleset
+type FirewallMetrics struct {
+	lock  sync.RWMutex
+	stats firewallv1.FirewallStats
+	bgp   []firewallv1.BGPNeighbor
+	ids   *firewallv1.IDSStatus
+	cert  *firewallv1.CertificateStatus
+}
+
+// NewFirewallMetrics creates new firewall metrics, which must be registered at a prometheus registry
+func NewFirewallMetrics() *FirewallMetrics {
+	return &FirewallMetrics{}
+}
+
+// Update replaces the exposed statistics
+func (m *FirewallMetrics) Update(stats firewallv1.FirewallStats) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stats = *stats.DeepCopy()
+}
+
+// UpdateBGP replaces the exposed state of the BGP sessions, nil removes the BGP metrics
+func (m *FirewallMetrics) UpdateBGP(neighbors []firewallv1.BGPNeighbor) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bgp = nil
+	for i := range neighbors {
+		m.bgp = append(m.bgp, *neighbors[i].DeepCopy())
+	}
+}
+
+// UpdateIDS replaces the exposed state of suricata, nil removes the IDS state metrics
+func (m *FirewallMetrics) UpdateIDS(status *firewallv1.IDSStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.ids = status.DeepCopy()
+}
+
+// UpdateDroptailerCertificate replaces the exposed validity of the droptailer client certificate, nil removes the certificate metrics
+func (m *FirewallMetrics) UpdateDroptailerCertificate(status *firewallv1.CertificateStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.cert = status.DeepCopy()
+}
+
+// Describe implements prometheus.Collector
+func (m *FirewallMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ruleBytesDesc
+	ch <- rulePacketsDesc
+	ch <- deviceBytesDesc
+	ch <- linkBytesDesc
+	ch <- linkPacketsDesc
+	ch <- linkErrorsDesc
+	ch <- linkDropsDesc
+	ch <- ipsQueueWaitingDesc
+	ch <- ipsQueueDropsDesc
+	ch <- ipsQueueListeningDesc
+	ch <- idsPacketsDesc
+	ch <- idsDropsDesc
+	ch <- idsInvalidChecksumsDesc
+	ch <- idsCounterDesc
+	ch <- idsUpDesc
+	ch <- idsUptimeDesc
+	ch <- conntrackEntriesDesc
+	ch <- conntrackMaxDesc
+	ch <- conntrackInsertFailedDesc
+	ch <- conntrackDropsDesc
+	ch <- conntrackEarlyDropsDesc
+	ch <- snatConnectionsDesc
+	ch <- snatPortsDesc
+	ch <- bgpEstablishedDesc
+	ch <- bgpUptimeDesc
+	ch <- bgpPrefixesReceivedDesc
+	ch <- bgpPrefixesAdvertisedDesc
+	ch <- talkerBytesDesc
+	ch <- talkerConnectionsDesc
+	ch <- ruleUnusedDesc
+	ch <- certificateExpiryDesc
+}
+
+// Collect implements prometheus.Collector
+func (m *FirewallMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for action, ruleStats := range m.stats.RuleStats {
+		for comment, stat := range ruleStats {
+			kind, policy := policyFromSource(stat.Source)
+			ch <- prometheus.MustNewConstMetric(ruleBytesDesc, prometheus.CounterValue, float64(stat.Cumulative.Bytes), comment, action, kind, policy)
+			ch <- prometheus.MustNewConstMetric(rulePacketsDesc, prometheus.CounterValue, float64(stat.Cumulative.Packets), comment, action, kind, policy)
+		}
+	}
+
+	for device, stat := range m.stats.DeviceStats {
+		ch <- prometheus.MustNewConstMetric(deviceBytesDesc, prometheus.CounterValue, float64(stat.CumulativeInBytes), device, "in")
+		ch <- prometheus.MustNewConstMetric(deviceBytesDesc, prometheus.CounterValue, float64(stat.CumulativeOutBytes), device, "out")
+	}
+
+	for network, links := range m.stats.Links {
+		for iface, stat := range links {
+			ch <- prometheus.MustNewConstMetric(linkBytesDesc, prometheus.CounterValue, float64(stat.InBytes), network, iface, "in")
+			ch <- prometheus.MustNewConstMetric(linkBytesDesc, prometheus.CounterValue, float64(stat.OutBytes), network, iface, "out")
+			ch <- prometheus.MustNewConstMetric(linkPacketsDesc, prometheus.CounterValue, float64(stat.InPackets), network, iface, "in")
+			ch <- prometheus.MustNewConstMetric(linkPacketsDesc, prometheus.CounterValue, float64(stat.OutPackets), network, iface, "out")
+			ch <- prometheus.MustNewConstMetric(linkErrorsDesc, prometheus.CounterValue, float64(stat.InErrors), network, iface, "in")
+			ch <- prometheus.MustNewConstMetric(linkErrorsDesc, prometheus.CounterValue, float64(stat.OutErrors), network, iface, "out")
+			ch <- prometheus.MustNewConstMetric(linkDropsDesc, prometheus.CounterValue, float64(stat.InDropped), network, iface, "in")
+			ch <- prometheus.MustNewConstMetric(linkDropsDesc, prometheus.CounterValue, float64(stat.OutDropped), network, iface, "out")
+		}
+	}
+
+	for device, stat := range m.stats.IDSStats {
+		ch <- prometheus.MustNewConstMetric(idsPacketsDesc, prometheus.CounterValue, float64(stat.Packets), device)
+		ch <- prometheus.MustNewConstMetric(idsDropsDesc, prometheus.CounterValue, float64(stat.Drop), device)
+		ch <- prometheus.MustNewConstMetric(idsInvalidChecksumsDesc, prometheus.CounterValue, float64(stat.InvalidChecksums), device)
+	}
+
+	for name, value := range m.stats.IDSCounters {
+		ch <- prometheus.MustNewConstMetric(idsCounterDesc, prometheus.UntypedValue, float64(value), name)
+	}
+	if m.ids != nil {
+		up := 0.0
+		if m.ids.Running {
+			up = 1
+			ch <- prometheus.MustNewConstMetric(idsUptimeDesc, prometheus.GaugeValue, m.ids.Uptime.Seconds(), m.ids.Version)
+		}
+		ch <- prometheus.MustNewConstMetric(idsUpDesc, prometheus.GaugeValue, up)
+	}
+
+	if q := m.stats.IPSQueue; q != nil {
+		queue := fmt.Sprint(q.Queue)
+		listening := 0.0
+		if q.Listening {
+			listening = 1
+		}
+		ch <- prometheus.MustNewConstMetric(ipsQueueListeningDesc, prometheus.GaugeValue, listening, queue)
+		ch <- prometheus.MustNewConstMetric(ipsQueueWaitingDesc, prometheus.GaugeValue, float64(q.Waiting), queue)
+		ch <- prometheus.MustNewConstMetric(ipsQueueDropsDesc, prometheus.CounterValue, float64(q.QueueDropped), queue, "queue_full")
+		ch <- prometheus.MustNewConstMetric(ipsQueueDropsDesc, prometheus.CounterValue, float64(q.UserDropped), queue, "user")
+	}
+
+	if ct := m.stats.Conntrack; ct != nil {
+		ch <- prometheus.MustNewConstMetric(conntrackEntriesDesc, prometheus.GaugeValue, float64(ct.Entries))
+		ch <- prometheus.MustNewConstMetric(conntrackMaxDesc, prometheus.GaugeValue, float64(ct.Max))
+		ch <- prometheus.MustNewConstMetric(conntrackInsertFailedDesc, prometheus.CounterValue, float64(ct.InsertFailed))
+		ch <- prometheus.MustNewConstMetric(conntrackDropsDesc, prometheus.CounterValue, float64(ct.Drop))
+		ch <- prometheus.MustNewConstMetric(conntrackEarlyDropsDesc, prometheus.CounterValue, float64(ct.EarlyDrop))
+		for ip, stat := range ct.SNAT {
+			ch <- prometheus.MustNewConstMetric(snatConnectionsDesc, prometheus.GaugeValue, float64(stat.Connections), ip, stat.NetworkID)
+			ch <- prometheus.MustNewConstMetric(snatPortsDesc, prometheus.GaugeValue, float64(stat.Ports), ip, stat.NetworkID)
+		}
+	}
+
+	for _, n := range m.bgp {
+		established := 0.0
+		if n.State == firewallv1.BGPStateEstablished {
+			established = 1
+		}
+		ch <- prometheus.MustNewConstMetric(bgpEstablishedDesc, prometheus.GaugeValue, established, n.VRF, n.AddressFamily, n.Peer)
+		ch <- prometheus.MustNewConstMetric(bgpUptimeDesc, prometheus.GaugeValue, n.Uptime.Seconds(), n.VRF, n.AddressFamily, n.Peer)
+		ch <- prometheus.MustNewConstMetric(bgpPrefixesReceivedDesc, prometheus.GaugeValue, float64(n.PrefixesReceived), n.VRF, n.AddressFamily, n.Peer)
+		ch <- prometheus.MustNewConstMetric(bgpPrefixesAdvertisedDesc, prometheus.GaugeValue, float64(n.PrefixesAdvertised), n.VRF, n.AddressFamily, n.Peer)
+	}
+
+	if tt := m.stats.TopTalkers; tt != nil {
+		for kind, talkers := range map[string]map[string][]firewallv1.Talker{"service": tt.Services, "network": tt.Networks} {
+			for target, list := range talkers {
+				for _, t := range list {
+					ch <- prometheus.MustNewConstMetric(talkerBytesDesc, prometheus.GaugeValue, float64(t.Bytes), kind, target, t.IP)
+					ch <- prometheus.MustNewConstMetric(talkerConnectionsDesc, prometheus.GaugeValue, float64(t.Connections), kind, target, t.IP)
+				}
+			}
+		}
+	}
+
+	if m.cert != nil {
+		ch <- prometheus.MustNewConstMetric(certificateExpiryDesc, prometheus.GaugeValue, float64(m.cert.NotAfter.Unix()), "client", m.cert.Subject)
+		if m.cert.CANotAfter != nil {
+			ch <- prometheus.MustNewConstMetric(certificateExpiryDesc, prometheus.GaugeValue, float64(m.cert.CANotAfter.Unix()), "ca", m.cert.Subject)
+		}
+	}
+
+	for _, rule := range m.stats.UnusedRules {
+		kind, policy := policyFromSource(rule.Source)
+		unused := time.Since(rule.Since.Time).Seconds()
+		ch <- prometheus.MustNewConstMetric(ruleUnusedDesc, prometheus.GaugeValue, unused, rule.Comment, rule.Action, kind, policy)
+	}
+}
+
+// policyFromSource returns the kind and name of the k8s entity a rule was generated for, e.g. the network policy name or namespace/name of a service,
+// for static rules both are empty.
+func policyFromSource(src *firewallv1.RuleSource) (string, string) {
+	if src == nil {
+		return "", ""
+	}
+	if src.Namespace == "" || src.Kind == nft.KindClusterwideNetworkPolicy {
+		return src.Kind, src.Name
+	}
+	return src.Kind, src.Namespace + "/" + src.Name
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestPolicyFromSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *firewallv1.RuleSource
+		kind   string
+		policy string
+	}{
+		{
+			name: "network policy",
+			source: &firewallv1.RuleSource{
+				Kind:      "ClusterwideNetworkPolicy",
+				Namespace: "firewall",
+				Name:      "allow-dns",
+				Rule:      "egress-0",
+				Protocol:  "udp",
+			},
+			kind:   "ClusterwideNetworkPolicy",
+			policy: "allow-dns",
+		},
+		{
+			name: "service",
+			source: &firewallv1.RuleSource{
+				Kind:      "Service",
+				Namespace: "kube-system",
+				Name:      "vpn-shoot",
+				Rule:      "nodeport",
+				Protocol:  "tcp",
+			},
+			kind:   "Service",
+			policy: "kube-system/vpn-shoot",
+		},
+		{
+			name: "static rule",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, policy := policyFromSource(tt.source)
+			if kind != tt.kind || policy != tt.policy {
+				t.Errorf("policyFromSource() = %v, %v, want %v, %v", kind, policy, tt.kind, tt.policy)
+			}
+		})
+	}
+}
+
+func TestFirewallMetrics(t *testing.T) {
+	m := NewFirewallMetrics()
+	if got := testutil.CollectAndCount(m); got != 0 {
+		t.Errorf("expected no metrics before the first update, got %d", got)
+	}
+
+	m.Update(firewallv1.FirewallStats{
+		RuleStats: firewallv1.RuleStatsByAction{
+			"accept": firewallv1.RuleStats{
+				"accept established connections": firewallv1.RuleStat{
+					Counter:    firewallv1.Counter{Bytes: 100, Packets: 1},
+					Cumulative: firewallv1.Counter{Bytes: 200, Packets: 2},
+				},
+			},
+		},
+		DeviceStats: firewallv1.DeviceStatsByDevice{
+			"external": firewallv1.DeviceStat{InBytes: 10, OutBytes: 20, CumulativeInBytes: 30, CumulativeOutBytes: 40},
+		},
+		Links: firewallv1.LinkStatsByNetwork{
+			"internet": {"vlan104009": firewallv1.LinkStat{InBytes: 10, OutBytes: 20}},
+		},
+		IDSStats: firewallv1.IDSStatsByDevice{
+			"vrf104009": firewallv1.InterfaceStat{Drop: 1, InvalidChecksums: 2, Packets: 3},
+		},
+		Conntrack: &firewallv1.ConntrackStats{
+			Entries: 10,
+			Max:     100,
+			SNAT: map[string]firewallv1.SNATStat{
+				"185.1.2.3": {NetworkID: "internet", Connections: 5, Ports: 2},
+			},
+		},
+		IDSCounters: map[string]uint64{"capture.kernel_drops": 1},
+		IPSQueue:    &firewallv1.IPSQueueStats{Queue: 0, Listening: true, Waiting: 1},
+		TopTalkers: &firewallv1.TopTalkers{
+			Services: map[string][]firewallv1.Talker{
+				"test/svc": {{IP: "1.1.1.1", Connections: 2, Bytes: 300}},
+			},
+			Networks: map[string][]firewallv1.Talker{
+				"internet": {{IP: "10.0.0.1", Connections: 1, Bytes: 100}},
+			},
+		},
+		UnusedRules: []firewallv1.UnusedRule{
+			{Action: "accept", Comment: "k8s:svc/test/svc/1/nodeport/tcp", Source: &firewallv1.RuleSource{Kind: "Service", Namespace: "test", Name: "svc"}},
+		},
+	})
+
+	// 2 rule metrics, 2 device metrics, 8 link metrics, 4 ids metrics, 4 ips queue metrics, 5 conntrack metrics, 2 snat metrics, 4 top talker metrics and 1 unused rule metric
+	if got := testutil.CollectAndCount(m); got != 32 {
+		t.Errorf("expected 32 metrics, got %d", got)
+	}
+
+	m.UpdateBGP([]firewallv1.BGPNeighbor{{VRF: "default", AddressFamily: "ipv4Unicast", Peer: "lan0", State: firewallv1.BGPStateEstablished}})
+	if got := testutil.CollectAndCount(m); got != 36 {
+		t.Errorf("expected 36 metrics with bgp sessions, got %d", got)
+	}
+	m.UpdateBGP(nil)
+	if got := testutil.CollectAndCount(m); got != 32 {
+		t.Errorf("expected 32 metrics without bgp sessions, got %d", got)
+	}
+
+	m.UpdateIDS(&firewallv1.IDSStatus{Running: true, Version: "6.0.1 RELEASE"})
+	if got := testutil.CollectAndCount(m); got != 34 {
+		t.Errorf("expected 34 metrics with a running ids, got %d", got)
+	}
+	m.UpdateIDS(&firewallv1.IDSStatus{})
+	if got := testutil.CollectAndCount(m); got != 33 {
+		t.Errorf("expected 33 metrics with an unreachable ids, got %d", got)
+	}
+
+	caNotAfter := metav1.Now()
+	m.UpdateDroptailerCertificate(&firewallv1.CertificateStatus{Subject: "droptailer-client", NotAfter: metav1.Now(), CANotAfter: &caNotAfter})
+	if got := testutil.CollectAndCount(m); got != 35 {
+		t.Errorf("expected 35 metrics with a droptailer certificate, got %d", got)
+	}
+}
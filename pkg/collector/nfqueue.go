@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// nfqueueFile lists the queues of nfnetlink_queue which have a listener
+const nfqueueFile = "/proc/net/netfilter/nfnetlink_queue"
+
+// CollectIPSQueueStats collects the statistics of the NFQUEUE of the inline IPS.
+// A queue without a listener is not listed by the kernel, its packets bypass the inspection.
+func CollectIPSQueueStats(queue uint16) (*firewallv1.IPSQueueStats, error) {
+	f, err := os.Open(nfqueueFile)
+	if os.IsNotExist(err) {
+		// the module is loaded with the first listener
+		return &firewallv1.IPSQueueStats{Queue: queue}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read nfqueue statistics: %w", err)
+	}
+	defer f.Close()
+	return parseIPSQueueStats(f, queue)
+}
+
+// parseIPSQueueStats parses the statistics of a queue, every line of the file has the fields
+// queue number, port id of the listener, waiting packets, copy mode, copy range, packets dropped by the kernel,
+// packets which could not be sent to the listener, last packet id and 1
+func parseIPSQueueStats(r io.Reader, queue uint16) (*firewallv1.IPSQueueStats, error) {
+	stats := &firewallv1.IPSQueueStats{Queue: queue}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		if fields[0] != strconv.Itoa(int(queue)) {
+			continue
+		}
+		values := []*uint64{&stats.Waiting, &stats.QueueDropped, &stats.UserDropped}
+		for i, f := range []string{fields[2], fields[5], fields[6]} {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nfqueue statistics %q: %w", scanner.Text(), err)
+			}
+			*values[i] = v
+		}
+		stats.Listening = fields[1] != "0"
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read nfqueue statistics: %w", err)
+	}
+	return stats, nil
+}
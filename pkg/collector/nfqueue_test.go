@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestParseIPSQueueStats(t *testing.T) {
+	proc := `    0  31937     2 2 65531     0     0     4711  1
+    3  31938    12 2 65531    17     5   104009  1
+`
+	tests := []struct {
+		name    string
+		queue   uint16
+		want    *firewallv1.IPSQueueStats
+		wantErr bool
+	}{
+		{
+			name:  "queue with listener",
+			queue: 3,
+			want: &firewallv1.IPSQueueStats{
+				Queue:        3,
+				Listening:    true,
+				Waiting:      12,
+				QueueDropped: 17,
+				UserDropped:  5,
+			},
+		},
+		{
+			name:  "queue without listener",
+			queue: 1,
+			want: &firewallv1.IPSQueueStats{
+				Queue: 1,
+			},
+		},
+		{
+			name:    "malformed statistics",
+			queue:   0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := proc
+			if tt.wantErr {
+				input = "    0  31937     x 2 65531     0     0     4711  1\n"
+			}
+			got, err := parseIPSQueueStats(strings.NewReader(input), tt.queue)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseIPSQueueStats() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("parseIPSQueueStats() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
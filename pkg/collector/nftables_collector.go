@@ -3,6 +3,7 @@ package collector
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 
@@ -11,6 +12,7 @@ import (
 
 	"github.com/google/nftables/expr"
 	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	nft "github.com/metal-stack/firewall-controller/pkg/nftables"
 )
 
 type (
@@ -28,6 +30,9 @@ var (
 	tableName = "firewall"
 )
 
+// userDataTypeComment is the type of the comment attribute in the userdata of a rule
+const userDataTypeComment = 0
+
 // NewNFTablesCollector create a new Collector for nftables counters
 func NewNFTablesCollector(logger *logr.Logger) nfCollector {
 	var log logr.Logger
@@ -57,11 +62,14 @@ func (n nfCollector) CollectDeviceStats() (firewallv1.DeviceStatsByDevice, error
 			switch direction {
 			case "in":
 				deviceStat.InBytes = counter.Bytes
+				deviceStat.InPackets = counter.Packets
 			case "out":
 				deviceStat.OutBytes = counter.Bytes
+				deviceStat.OutPackets = counter.Packets
 			}
 
 		}
+		deviceStat.TotalBytes = deviceStat.InBytes + deviceStat.OutBytes
 		n.logger.Info("collectdevicestats", "stats", deviceStat)
 		deviceStatsByDevice[device] = deviceStat
 	}
@@ -111,15 +119,16 @@ func (n nfCollector) CollectRuleStats() firewallv1.RuleStatsByAction {
 			}
 
 			stats := statsByAction[ri.action]
-			stat, ok := stats[ri.comment]
-			if !ok {
-				stat = firewallv1.RuleStat{
-					Counter: firewallv1.Counter{},
-				}
+			key := ri.comment
+			if existing, ok := stats[key]; ok && ri.source != nil && !reflect.DeepEqual(existing.Source, ri.source) {
+				// rules of different objects can only collide with custom comments
+				key = fmt.Sprintf("%s (%s/%s)", key, ri.source.Namespace, ri.source.Name)
 			}
 
-			stat.Counter = ri.counter
-			stats[ri.comment] = stat
+			stats[key] = firewallv1.RuleStat{
+				Counter: ri.counter,
+				Source:  ri.source,
+			}
 			statsByAction[ri.action] = stats
 		}
 	}
@@ -129,17 +138,18 @@ func (n nfCollector) CollectRuleStats() firewallv1.RuleStatsByAction {
 
 type ruleInfo struct {
 	comment string
+	source  *firewallv1.RuleSource
 	counter firewallv1.Counter
 	action  string
 }
 
-// extractRuleInfo extracts the rule comment, action and counter from a nftables rule object
+// extractRuleInfo extracts the rule comment, source, action and counter from a nftables rule object
 func extractRuleInfo(r *nftables.Rule) *ruleInfo {
-	if len(r.UserData) < 3 {
+	comment := ruleComment(r.UserData)
+	if comment == "" {
 		return nil
 	}
-
-	comment := string(bytes.Trim(r.UserData[2:], "\x00"))
+	comment, source := nft.ParseRuleComment(comment)
 	var counter *expr.Counter
 	var verdict *expr.Verdict
 
@@ -163,6 +173,7 @@ func extractRuleInfo(r *nftables.Rule) *ruleInfo {
 
 	return &ruleInfo{
 		comment: comment,
+		source:  source,
 		counter: firewallv1.Counter{
 			Bytes:   counter.Bytes,
 			Packets: counter.Packets,
@@ -171,6 +182,21 @@ func extractRuleInfo(r *nftables.Rule) *ruleInfo {
 	}
 }
 
+// ruleComment reads the comment from the userdata of a rule, which is encoded as type-length-value attributes
+func ruleComment(userData []byte) string {
+	for len(userData) >= 2 {
+		typ, length := userData[0], int(userData[1])
+		if len(userData) < 2+length {
+			return ""
+		}
+		if typ == userDataTypeComment {
+			return string(bytes.Trim(userData[2:2+length], "\x00"))
+		}
+		userData = userData[2+length:]
+	}
+	return ""
+}
+
 // getAction translates a nftables verdict
 func getAction(v *expr.Verdict) string {
 	if v == nil {
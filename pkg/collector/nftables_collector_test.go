@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func userData(comment string) []byte {
+	return append([]byte{userDataTypeComment, byte(len(comment) + 1)}, append([]byte(comment), 0)...)
+}
+
+func TestExtractRuleInfo(t *testing.T) {
+	counter := &expr.Counter{Bytes: 100, Packets: 1}
+	accept := &expr.Verdict{Kind: expr.VerdictAccept}
+
+	tests := []struct {
+		name string
+		rule *nftables.Rule
+		want *ruleInfo
+	}{
+		{
+			name: "static rule",
+			rule: &nftables.Rule{
+				UserData: userData("accept established connections"),
+				Exprs:    []expr.Any{counter, accept},
+			},
+			want: &ruleInfo{
+				comment: "accept established connections",
+				counter: firewallv1.Counter{Bytes: 100, Packets: 1},
+				action:  "accept",
+			},
+		},
+		{
+			name: "rule generated for a service",
+			rule: &nftables.Rule{
+				UserData: userData("k8s:svc/kube-system/vpn-shoot/6f1e2ac6/nodeport/udp"),
+				Exprs:    []expr.Any{counter, accept},
+			},
+			want: &ruleInfo{
+				comment: "accept traffic for k8s service kube-system/vpn-shoot nodeport udp",
+				source: &firewallv1.RuleSource{
+					Kind:      "Service",
+					Namespace: "kube-system",
+					Name:      "vpn-shoot",
+					UID:       "6f1e2ac6",
+					Rule:      "nodeport",
+					Protocol:  "udp",
+				},
+				counter: firewallv1.Counter{Bytes: 100, Packets: 1},
+				action:  "accept",
+			},
+		},
+		{
+			name: "rule with another userdata attribute before the comment",
+			rule: &nftables.Rule{
+				UserData: append([]byte{1, 2, 0, 0}, userData("drop ping floods")...),
+				Exprs:    []expr.Any{counter, &expr.Verdict{Kind: expr.VerdictDrop}},
+			},
+			want: &ruleInfo{
+				comment: "drop ping floods",
+				counter: firewallv1.Counter{Bytes: 100, Packets: 1},
+				action:  "drop",
+			},
+		},
+		{
+			name: "rule without comment",
+			rule: &nftables.Rule{
+				Exprs: []expr.Any{counter, accept},
+			},
+		},
+		{
+			name: "rule without counter",
+			rule: &nftables.Rule{
+				UserData: userData("accept icmp"),
+				Exprs:    []expr.Any{accept},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractRuleInfo(tt.rule)
+			if !cmp.Equal(got, tt.want, cmp.AllowUnexported(ruleInfo{})) {
+				t.Errorf("extractRuleInfo() diff: %v", cmp.Diff(got, tt.want, cmp.AllowUnexported(ruleInfo{})))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// DefaultRateSamples is the number of samples kept in the rolling window of traffic rates
+const DefaultRateSamples = 6
+
+type (
+	// RateCalculator computes the traffic rates between consecutive status updates and keeps a rolling window of them
+	RateCalculator struct {
+		lock     sync.Mutex
+		size     int
+		previous *rateCounters
+		samples  []firewallv1.TrafficSample
+	}
+
+	// rateCounters are the cumulative counters the rates are computed from, they are not reset by reloads of the ruleset
+	rateCounters struct {
+		time    time.Time
+		devices firewallv1.DeviceStatsByDevice
+		drop    firewallv1.Counter
+	}
+)
+
+// NewRateCalculator creates a new rate calculator which keeps the given number of samples
+func NewRateCalculator(size int) *RateCalculator {
+	if size < 1 {
+		size = 1
+	}
+	return &RateCalculator{size: size}
+}
+
+// Update computes the rates since the previous update and sets them together with the rolling window on the given statistics,
+// no rates are set on the first update. The cumulative values of the statistics must be set by the CounterAccumulator before.
+func (c *RateCalculator) Update(stats *firewallv1.FirewallStats, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	current := &rateCounters{
+		time:    now,
+		devices: firewallv1.DeviceStatsByDevice{},
+	}
+	for device, stat := range stats.DeviceStats {
+		current.devices[device] = stat
+	}
+	for _, stat := range stats.RuleStats["drop"] {
+		current.drop.Bytes += stat.Cumulative.Bytes
+		current.drop.Packets += stat.Cumulative.Packets
+	}
+
+	previous := c.previous
+	c.previous = current
+	if previous != nil {
+		seconds := now.Sub(previous.time).Seconds()
+		if seconds > 0 {
+			c.samples = append(c.samples, sample(previous, current, seconds))
+			if len(c.samples) > c.size {
+				c.samples = c.samples[len(c.samples)-c.size:]
+			}
+		}
+	}
+
+	if len(c.samples) == 0 {
+		return
+	}
+	stats.Samples = make([]firewallv1.TrafficSample, 0, len(c.samples))
+	for _, s := range c.samples {
+		stats.Samples = append(stats.Samples, *s.DeepCopy())
+	}
+	stats.Rates = c.samples[len(c.samples)-1].DeepCopy()
+}
+
+func sample(previous, current *rateCounters, seconds float64) firewallv1.TrafficSample {
+	s := firewallv1.TrafficSample{
+		Time:    metav1.NewTime(current.time),
+		Devices: map[string]firewallv1.DeviceRate{},
+		Drop:    rate(previous.drop.Bytes, current.drop.Bytes, previous.drop.Packets, current.drop.Packets, seconds),
+	}
+	for device, cur := range current.devices {
+		prev, ok := previous.devices[device]
+		if !ok {
+			continue
+		}
+		s.Devices[device] = firewallv1.DeviceRate{
+			In:  rate(prev.CumulativeInBytes, cur.CumulativeInBytes, prev.CumulativeInPackets, cur.CumulativeInPackets, seconds),
+			Out: rate(prev.CumulativeOutBytes, cur.CumulativeOutBytes, prev.CumulativeOutPackets, cur.CumulativeOutPackets, seconds),
+		}
+	}
+	return s
+}
+
+func rate(previousBytes, currentBytes, previousPackets, currentPackets uint64, seconds float64) firewallv1.Rate {
+	return firewallv1.Rate{
+		BytesPerSecond:   uint64(float64(delta(previousBytes, currentBytes)) / seconds),
+		PacketsPerSecond: uint64(float64(delta(previousPackets, currentPackets)) / seconds),
+	}
+}
+
+// delta returns the increase of a counter, a counter which was reset in between, e.g. a rule which was removed and added again, increased by its current value
+func delta(previous, current uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// rateStats returns statistics with the given cumulative values, the since-reload byte counters are lowered by reset to simulate a reload
+func rateStats(deviceBytes, devicePackets, dropBytes, dropPackets, reset uint64) firewallv1.FirewallStats {
+	return firewallv1.FirewallStats{
+		RuleStats: firewallv1.RuleStatsByAction{
+			"drop": firewallv1.RuleStats{
+				"drop ping floods": firewallv1.RuleStat{
+					Counter:    firewallv1.Counter{Bytes: dropBytes - reset, Packets: dropPackets},
+					Cumulative: firewallv1.Counter{Bytes: dropBytes, Packets: dropPackets},
+				},
+			},
+		},
+		DeviceStats: firewallv1.DeviceStatsByDevice{
+			"external": firewallv1.DeviceStat{
+				InBytes:              deviceBytes - reset,
+				OutBytes:             2*deviceBytes - reset,
+				InPackets:            devicePackets,
+				OutPackets:           2 * devicePackets,
+				CumulativeInBytes:    deviceBytes,
+				CumulativeOutBytes:   2 * deviceBytes,
+				CumulativeInPackets:  devicePackets,
+				CumulativeOutPackets: 2 * devicePackets,
+			},
+		},
+	}
+}
+
+func TestRateCalculator(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewRateCalculator(2)
+
+	s := rateStats(1000, 10, 100, 1, 0)
+	c.Update(&s, start)
+	if s.Rates != nil || s.Samples != nil {
+		t.Errorf("expected no rates on the first update")
+	}
+
+	s = rateStats(2000, 20, 200, 2, 0)
+	c.Update(&s, start.Add(10*time.Second))
+	first := firewallv1.TrafficSample{
+		Time: metav1.NewTime(start.Add(10 * time.Second)),
+		Devices: map[string]firewallv1.DeviceRate{
+			"external": {
+				In:  firewallv1.Rate{BytesPerSecond: 100, PacketsPerSecond: 1},
+				Out: firewallv1.Rate{BytesPerSecond: 200, PacketsPerSecond: 2},
+			},
+		},
+		Drop: firewallv1.Rate{BytesPerSecond: 10, PacketsPerSecond: 0},
+	}
+	if !cmp.Equal(s.Rates, &first) {
+		t.Errorf("rates diff: %v", cmp.Diff(s.Rates, &first))
+	}
+
+	// the counters were reset by a reload, the rates are computed from the cumulative values
+	s = rateStats(2500, 25, 200, 2, 200)
+	c.Update(&s, start.Add(15*time.Second))
+	second := firewallv1.TrafficSample{
+		Time: metav1.NewTime(start.Add(15 * time.Second)),
+		Devices: map[string]firewallv1.DeviceRate{
+			"external": {
+				In:  firewallv1.Rate{BytesPerSecond: 100, PacketsPerSecond: 1},
+				Out: firewallv1.Rate{BytesPerSecond: 200, PacketsPerSecond: 2},
+			},
+		},
+		Drop: firewallv1.Rate{},
+	}
+	if !cmp.Equal(s.Rates, &second) {
+		t.Errorf("rates diff: %v", cmp.Diff(s.Rates, &second))
+	}
+
+	s = rateStats(3500, 35, 200, 2, 200)
+	c.Update(&s, start.Add(25*time.Second))
+	if len(s.Samples) != 2 {
+		t.Fatalf("expected a window of 2 samples, got %d", len(s.Samples))
+	}
+	if !cmp.Equal(s.Samples[0], second) {
+		t.Errorf("oldest sample diff: %v", cmp.Diff(s.Samples[0], second))
+	}
+}
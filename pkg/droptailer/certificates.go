@@ -0,0 +1,92 @@
+package droptailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultExpiryWarning is the default period ahead of the expiry of the client certificate or its ca a warning is emitted
+	DefaultExpiryWarning = 14 * 24 * time.Hour
+
+	// hostClientService is the systemd service of the droptailer client on the host, which reads the certificates only at startup
+	hostClientService = "droptailer.service"
+)
+
+// Certificate describes the client certificate for the droptailer servers
+type Certificate struct {
+	// Subject is the common name of the certificate
+	Subject   string
+	NotBefore time.Time
+	NotAfter  time.Time
+	// CANotAfter is the expiry of the ca which signed the certificate
+	CANotAfter time.Time
+}
+
+// ParseCertificate validates that the certificate matches the key and is signed by the ca for client authentication.
+// The validity period is not checked, the expiry is reported by the returned certificate.
+func ParseCertificate(ca, cert, key []byte) (*Certificate, error) {
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate or key: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client certificate: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range pair.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse intermediate certificate: %w", err)
+		}
+		intermediates.AddCert(c)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("ca certificate contains no certificate")
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		// an expired certificate is still reported with its expiry
+		CurrentTime: leaf.NotBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client certificate is not signed by the ca: %w", err)
+	}
+
+	c := &Certificate{
+		Subject:   leaf.Subject.CommonName,
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+	}
+	for _, issuer := range chains[0][1:] {
+		if c.CANotAfter.IsZero() || issuer.NotAfter.Before(c.CANotAfter) {
+			c.CANotAfter = issuer.NotAfter
+		}
+	}
+	return c, nil
+}
+
+// Expiry returns the time the certificate or its ca expires, whichever comes first
+func (c *Certificate) Expiry() time.Time {
+	if !c.CANotAfter.IsZero() && c.CANotAfter.Before(c.NotAfter) {
+		return c.CANotAfter
+	}
+	return c.NotAfter
+}
+
+// RestartHostClient restarts the droptailer client on the host to load new certificates, it is not started if it is not running
+func RestartHostClient() error {
+	if out, err := exec.Command("/bin/systemctl", "try-restart", hostClientService).CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to restart %s: %w: %s", hostClientService, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package droptailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCertificate(t *testing.T) {
+	notBefore := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue := func(cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, notAfter time.Time, usage ...x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			ExtKeyUsage:           usage,
+			BasicConstraintsValid: true,
+			IsCA:                  parent == nil,
+		}
+		if parent == nil {
+			template.KeyUsage = x509.KeyUsageCertSign
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	ca, caKey, caPEM, _ := issue("ca", nil, nil, notBefore.AddDate(2, 0, 0))
+	_, _, otherCAPEM, _ := issue("other-ca", nil, nil, notBefore.AddDate(2, 0, 0))
+	_, _, certPEM, keyPEM := issue("droptailer-client", ca, caKey, notBefore.AddDate(0, 1, 0), x509.ExtKeyUsageClientAuth)
+	_, _, _, otherKeyPEM := issue("droptailer-client", ca, caKey, notBefore.AddDate(0, 1, 0), x509.ExtKeyUsageClientAuth)
+	_, _, serverPEM, serverKeyPEM := issue("droptailer", ca, caKey, notBefore.AddDate(0, 1, 0), x509.ExtKeyUsageServerAuth)
+
+	tests := []struct {
+		name    string
+		ca      []byte
+		cert    []byte
+		key     []byte
+		want    *Certificate
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			ca:   caPEM,
+			cert: certPEM,
+			key:  keyPEM,
+			want: &Certificate{
+				Subject:    "droptailer-client",
+				NotBefore:  notBefore,
+				NotAfter:   notBefore.AddDate(0, 1, 0),
+				CANotAfter: notBefore.AddDate(2, 0, 0),
+			},
+		},
+		{
+			name:    "key does not match",
+			ca:      caPEM,
+			cert:    certPEM,
+			key:     otherKeyPEM,
+			wantErr: true,
+		},
+		{
+			name:    "signed by another ca",
+			ca:      otherCAPEM,
+			cert:    certPEM,
+			key:     keyPEM,
+			wantErr: true,
+		},
+		{
+			name:    "no client certificate",
+			ca:      caPEM,
+			cert:    serverPEM,
+			key:     serverKeyPEM,
+			wantErr: true,
+		},
+		{
+			name:    "no ca",
+			ca:      []byte("garbage"),
+			cert:    certPEM,
+			key:     keyPEM,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCertificate(tt.ca, tt.cert, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("ParseCertificate() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package droptailer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// DefaultGroup is the default NFLOG group the dropped packets are logged to
+	DefaultGroup = 100
+
+	// bufferSize limits the drops which are kept while the server is not reachable, further drops are discarded
+	bufferSize = 1000
+	// retryInterval is the interval a failed connection to the server or to NFLOG is retried
+	retryInterval = 5 * time.Second
+	// pushTimeout limits the push of a single drop
+	pushTimeout = 10 * time.Second
+	// serverName is the name in the certificate of the droptailer server, the servers are connected by their ip
+	serverName = "droptailer"
+)
+
+// Config contains the NFLOG group the drops are read from and the certificates for the servers
+type Config struct {
+	Group uint16
+	// CA, Certificate and Key are the files of the certificates for the mutual tls with the server
+	CA          string
+	Certificate string
+	Key         string
+	// Observer is notified of every drop read from NFLOG, it is optional
+	Observer DropObserver
+}
+
+// DropObserver is notified of the dropped packets, regardless whether they reach a server
+type DropObserver interface {
+	// ObserveDrop is called for every drop, it must not block the reading from NFLOG
+	ObserveDrop(d Drop)
+}
+
+// Client streams the packets dropped by nftables from NFLOG to one of the droptailer servers
+type Client struct {
+	log    logr.Logger
+	config Config
+	drops  chan Drop
+	// discarded counts the drops which were discarded because the buffer was full
+	discarded uint64
+
+	lock    sync.Mutex
+	servers []string
+	// connected is the server the drops are streamed to, failed the server which failed last
+	connected string
+	failed    string
+	// changed is signaled if the connected server was removed or the certificates were replaced
+	changed chan struct{}
+}
+
+// NewClient creates a new client for the given configuration, the drops are buffered until servers are set
+func NewClient(config Config, log logr.Logger) *Client {
+	return &Client{
+		log:     log,
+		config:  config,
+		drops:   make(chan Drop, bufferSize),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// SetServers sets the addresses of the droptailer servers, the client fails over to the next server if a server fails.
+// The connection to a server which was removed is closed.
+func (c *Client) SetServers(servers []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.servers = append([]string{}, servers...)
+	if c.connected != "" && !contains(servers, c.connected) {
+		select {
+		case c.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ReloadCertificates closes the connection to the server, the next connection uses the current certificates
+func (c *Client) ReloadCertificates() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.connected != "" {
+		select {
+		case c.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Server returns the server the drops are streamed to, it is empty if the client is not connected
+func (c *Client) Server() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connected
+}
+
+// Run reads the drops from NFLOG and pushes them to the server until stop is closed
+func (c *Client) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	go c.read(ctx)
+	c.push(ctx)
+	return nil
+}
+
+// read receives the drops from NFLOG, the group is bound again after an error
+func (c *Client) read(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := openNFLOG(c.config.Group)
+		if err != nil {
+			c.log.Error(err, "unable to read dropped packets")
+			sleep(ctx, retryInterval)
+			continue
+		}
+		go func() {
+			<-ctx.Done()
+			n.close()
+		}()
+		c.log.Info("reading dropped packets", "group", c.config.Group)
+
+		for {
+			drops, err := n.read()
+			if err != nil {
+				if ctx.Err() == nil {
+					c.log.Error(err, "unable to read dropped packets")
+				}
+				n.close()
+				break
+			}
+			for _, d := range drops {
+				if c.config.Observer != nil {
+					c.config.Observer.ObserveDrop(d)
+				}
+				select {
+				case c.drops <- d:
+				default:
+					atomic.AddUint64(&c.discarded, 1)
+				}
+			}
+		}
+	}
+}
+
+// push sends the buffered drops to a server, after an error the next server is connected
+func (c *Client) push(ctx context.Context) {
+	for ctx.Err() == nil {
+		servers := c.candidates()
+		if len(servers) == 0 {
+			sleep(ctx, retryInterval)
+			continue
+		}
+
+		var (
+			conn   *grpc.ClientConn
+			server string
+			err    error
+		)
+		for _, server = range servers {
+			conn, err = c.dial(ctx, server)
+			if err == nil {
+				break
+			}
+			c.log.Error(err, "unable to connect to droptailer server", "server", server)
+			c.setFailed(server)
+		}
+		if conn == nil {
+			sleep(ctx, retryInterval)
+			continue
+		}
+		c.log.Info("streaming dropped packets", "server", server)
+		c.setConnected(server)
+
+		err = c.stream(ctx, conn)
+		c.setConnected("")
+		conn.Close()
+		if err != nil {
+			c.log.Error(err, "unable to push dropped packets", "server", server)
+			c.setFailed(server)
+		}
+	}
+}
+
+// candidates returns the servers in the order they are tried, the server which failed last is tried last
+func (c *Client) candidates() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, s := range c.servers {
+		if s == c.failed {
+			return append(append([]string{}, c.servers[i+1:]...), c.servers[:i+1]...)
+		}
+	}
+	return append([]string{}, c.servers...)
+}
+
+func (c *Client) setConnected(server string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = server
+	// only a removal of the new server closes its connection
+	select {
+	case <-c.changed:
+	default:
+	}
+	if server != "" && !contains(c.servers, server) {
+		c.changed <- struct{}{}
+	}
+}
+
+func (c *Client) setFailed(server string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failed = server
+}
+
+// stream pushes the drops until pushing fails, a drop which could not be pushed is lost
+func (c *Client) stream(ctx context.Context, conn *grpc.ClientConn) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.changed:
+			return nil
+		case d := <-c.drops:
+			if discarded := atomic.SwapUint64(&c.discarded, 0); discarded > 0 {
+				c.log.Info("discarded dropped packets, the buffer was full", "count", discarded)
+			}
+			pctx, cancel := context.WithTimeout(ctx, pushTimeout)
+			err := conn.Invoke(pctx, pushMethod, &d, &void{}, grpc.ForceCodec(codec{}))
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dial connects to a server with mutual tls, the certificates are read for every connection as they are replaced by the droptailer controller
+func (c *Client) dial(ctx context.Context, server string) (*grpc.ClientConn, error) {
+	ca, err := ioutil.ReadFile(c.config.CA)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ca certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("unable to parse ca certificate %s", c.config.CA)
+	}
+	cert, err := tls.LoadX509KeyPair(c.config.Certificate, c.config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	dctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	return grpc.DialContext(dctx, server, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,43 @@
+package droptailer
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClientFailover(t *testing.T) {
+	c := NewClient(Config{}, logr.Discard())
+	c.SetServers([]string{"10.0.1.5:50051", "10.0.1.6:50051", "10.0.1.7:50051"})
+
+	want := []string{"10.0.1.5:50051", "10.0.1.6:50051", "10.0.1.7:50051"}
+	if got := c.candidates(); !cmp.Equal(got, want) {
+		t.Errorf("candidates() diff: %v", cmp.Diff(got, want))
+	}
+
+	// the server which failed last is tried last
+	c.setFailed("10.0.1.6:50051")
+	want = []string{"10.0.1.7:50051", "10.0.1.5:50051", "10.0.1.6:50051"}
+	if got := c.candidates(); !cmp.Equal(got, want) {
+		t.Errorf("candidates() diff: %v", cmp.Diff(got, want))
+	}
+
+	// the connection to a removed server is closed
+	c.setConnected("10.0.1.7:50051")
+	c.SetServers([]string{"10.0.1.7:50051", "10.0.1.8:50051"})
+	select {
+	case <-c.changed:
+		t.Errorf("expected the connection to be kept")
+	default:
+	}
+	c.SetServers([]string{"10.0.1.8:50051"})
+	select {
+	case <-c.changed:
+	default:
+		t.Errorf("expected the connection to be closed")
+	}
+	if got := c.Server(); got != "10.0.1.7:50051" {
+		t.Errorf("expected the client to be connected until the connection is closed, got %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package droptailer
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// pushMethod is the rpc of the droptailer server which receives the drops:
+//
+//	service DropSink { rpc Push(Drop) returns (Void) {} }
+//	message Drop { google.protobuf.Timestamp timestamp = 1; map<string, string> fields = 2; }
+const pushMethod = "/droptailer.DropSink/Push"
+
+// codec encodes the messages of the droptailer protocol, which consists of only two messages,
+// in the protobuf wire format. It replaces the generated code of the droptailer api, which is not published as go module.
+// It is forced on the push calls only and not registered, the proto codec of grpc is left untouched.
+type codec struct{}
+
+// void is the empty response of the droptailer server
+type void struct{}
+
+func (codec) Name() string {
+	return "droptailer"
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	d, ok := v.(*Drop)
+	if !ok {
+		return nil, fmt.Errorf("unable to marshal %T", v)
+	}
+	return marshalDrop(d)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	if _, ok := v.(*void); !ok {
+		return fmt.Errorf("unable to unmarshal %T", v)
+	}
+	return nil
+}
+
+// marshalDrop encodes a drop as message Drop of the droptailer api, the fields are sorted to get a stable encoding
+func marshalDrop(d *Drop) ([]byte, error) {
+	timestamp, err := proto.Marshal(timestamppb.New(d.Timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp: %w", err)
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, timestamp)
+
+	fields := d.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, fields[k])
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
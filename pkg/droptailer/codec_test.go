@@ -0,0 +1,71 @@
+package droptailer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMarshalDrop(t *testing.T) {
+	d := &Drop{
+		Timestamp:       time.Date(2021, 1, 1, 10, 0, 0, 500, time.UTC),
+		Rule:            "nftables-firewall-dropped",
+		InInterface:     "vrf104009",
+		Source:          net.IP{1, 2, 3, 4},
+		Destination:     net.IP{10, 0, 0, 1},
+		Protocol:        "TCP",
+		SourcePort:      4711,
+		DestinationPort: 443,
+		Length:          60,
+		TTL:             64,
+	}
+
+	var timestamp []byte
+	fields := map[string]string{}
+	b, err := marshalDrop(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			t.Fatalf("unexpected field %d of type %d", num, typ)
+		}
+		b = b[n:]
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("unable to consume field %d", num)
+		}
+		b = b[n:]
+		switch num {
+		case 1:
+			timestamp = v
+		case 2:
+			_, _, n := protowire.ConsumeTag(v)
+			key, m := protowire.ConsumeString(v[n:])
+			_, _, o := protowire.ConsumeTag(v[n+m:])
+			value, _ := protowire.ConsumeString(v[n+m+o:])
+			fields[key] = value
+		}
+	}
+
+	wantTimestamp, err := proto.Marshal(timestamppb.New(d.Timestamp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(timestamp, wantTimestamp) {
+		t.Errorf("timestamp diff: %v", cmp.Diff(timestamp, wantTimestamp))
+	}
+	wantFields := map[string]string{
+		"RULE": "nftables-firewall-dropped", "IN": "vrf104009", "OUT": "", "SRC": "1.2.3.4", "DST": "10.0.0.1",
+		"PROTO": "TCP", "SPT": "4711", "DPT": "443", "LEN": "60", "TTL": "64",
+	}
+	if !cmp.Equal(fields, wantFields) {
+		t.Errorf("fields diff: %v", cmp.Diff(fields, wantFields))
+	}
+}
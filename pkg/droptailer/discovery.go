@@ -0,0 +1,55 @@
+package droptailer
+
+import (
+	"net"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ServiceLabel and ServiceLabelValue select the services of the droptailer servers
+	ServiceLabel      = "app"
+	ServiceLabelValue = "droptailer"
+
+	// serverPortName is the name of the port of the droptailer server if a service has several ports
+	serverPortName = "grpc"
+)
+
+// Servers returns the addresses of the ready endpoints of the droptailer services.
+// The addresses are sorted, all clients fail over in the same order.
+func Servers(endpoints []corev1.Endpoints) []string {
+	seen := map[string]bool{}
+	servers := []string{}
+	for _, e := range endpoints {
+		for _, subset := range e.Subsets {
+			port, ok := serverPort(subset.Ports)
+			if !ok {
+				continue
+			}
+			for _, a := range subset.Addresses {
+				server := net.JoinHostPort(a.IP, strconv.Itoa(int(port)))
+				if !seen[server] {
+					seen[server] = true
+					servers = append(servers, server)
+				}
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// serverPort returns the port named grpc or the only port
+func serverPort(ports []corev1.EndpointPort) (int32, bool) {
+	for _, p := range ports {
+		if p.Name == serverPortName && p.Protocol != corev1.ProtocolUDP {
+			return p.Port, true
+		}
+	}
+	if len(ports) == 1 && ports[0].Protocol != corev1.ProtocolUDP {
+		return ports[0].Port, true
+	}
+	return 0, false
+}
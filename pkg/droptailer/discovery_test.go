@@ -0,0 +1,69 @@
+package droptailer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestServers(t *testing.T) {
+	addresses := func(ips ...string) []corev1.EndpointAddress {
+		a := []corev1.EndpointAddress{}
+		for _, ip := range ips {
+			a = append(a, corev1.EndpointAddress{IP: ip})
+		}
+		return a
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []corev1.Endpoints
+		want      []string
+	}{
+		{
+			name: "no endpoints",
+			want: []string{},
+		},
+		{
+			name: "only ready addresses of the single port",
+			endpoints: []corev1.Endpoints{{Subsets: []corev1.EndpointSubset{{
+				Addresses:         addresses("10.0.1.7", "10.0.1.5"),
+				NotReadyAddresses: addresses("10.0.1.6"),
+				Ports:             []corev1.EndpointPort{{Port: 50051, Protocol: corev1.ProtocolTCP}},
+			}}}},
+			want: []string{"10.0.1.5:50051", "10.0.1.7:50051"},
+		},
+		{
+			name: "named port of several services",
+			endpoints: []corev1.Endpoints{
+				{Subsets: []corev1.EndpointSubset{{
+					Addresses: addresses("10.0.1.5"),
+					Ports:     []corev1.EndpointPort{{Name: "metrics", Port: 2112}, {Name: "grpc", Port: 50051}},
+				}}},
+				{Subsets: []corev1.EndpointSubset{{
+					Addresses: addresses("10.0.1.5", "10.0.2.5"),
+					Ports:     []corev1.EndpointPort{{Name: "grpc", Port: 50051}},
+				}}},
+			},
+			want: []string{"10.0.1.5:50051", "10.0.2.5:50051"},
+		},
+		{
+			name: "ambiguous ports",
+			endpoints: []corev1.Endpoints{{Subsets: []corev1.EndpointSubset{{
+				Addresses: addresses("10.0.1.5"),
+				Ports:     []corev1.EndpointPort{{Name: "metrics", Port: 2112}, {Name: "server", Port: 50051}},
+			}}}},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := Servers(tt.endpoints)
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("Servers() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package droptailer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drop is a packet which was dropped by nftables
+type Drop struct {
+	Timestamp time.Time
+	// Rule is the prefix of the log statement of the rule which dropped the packet,
+	// e.g. "nftables-firewall-dropped" for the forward policy or "nftables-firewall-dropped-ratelimit" for the rate limits
+	Rule            string
+	InInterface     string
+	OutInterface    string
+	Source          net.IP
+	Destination     net.IP
+	Protocol        string
+	SourcePort      uint16
+	DestinationPort uint16
+	Length          uint16
+	TTL             uint8
+}
+
+// Fields returns the drop with the keys of the kernel log, which the droptailer client parsed from the journal before
+func (d *Drop) Fields() map[string]string {
+	fields := map[string]string{
+		"RULE":  d.Rule,
+		"IN":    d.InInterface,
+		"OUT":   d.OutInterface,
+		"SRC":   d.Source.String(),
+		"DST":   d.Destination.String(),
+		"PROTO": d.Protocol,
+		"LEN":   strconv.Itoa(int(d.Length)),
+		"TTL":   strconv.Itoa(int(d.TTL)),
+	}
+	if d.Protocol == "TCP" || d.Protocol == "UDP" {
+		fields["SPT"] = strconv.Itoa(int(d.SourcePort))
+		fields["DPT"] = strconv.Itoa(int(d.DestinationPort))
+	}
+	return fields
+}
+
+// decodeIPv4 decodes the addresses, protocol and ports of an IPv4 packet, the payload may be truncated after the transport header
+func decodeIPv4(payload []byte, d *Drop) error {
+	if len(payload) < 20 || payload[0]>>4 != 4 {
+		return fmt.Errorf("payload is no ipv4 packet")
+	}
+	ihl := int(payload[0]&0x0f) * 4
+	if ihl < 20 || len(payload) < ihl {
+		return fmt.Errorf("ipv4 header length %d is invalid", ihl)
+	}
+	d.Length = binary.BigEndian.Uint16(payload[2:4])
+	d.TTL = payload[8]
+	d.Source = net.IP(append([]byte{}, payload[12:16]...))
+	d.Destination = net.IP(append([]byte{}, payload[16:20]...))
+
+	transport := payload[ihl:]
+	// ports are only available in the first fragment
+	fragmentOffset := binary.BigEndian.Uint16(payload[6:8]) & 0x1fff
+	switch proto := payload[9]; proto {
+	case 1:
+		d.Protocol = "ICMP"
+	case 6, 17:
+		d.Protocol = "TCP"
+		if proto == 17 {
+			d.Protocol = "UDP"
+		}
+		if fragmentOffset == 0 && len(transport) >= 4 {
+			d.SourcePort = binary.BigEndian.Uint16(transport[0:2])
+			d.DestinationPort = binary.BigEndian.Uint16(transport[2:4])
+		}
+	default:
+		d.Protocol = strconv.Itoa(int(proto))
+	}
+	return nil
+}
+
+// ruleName strips the separator of the log prefix, e.g. "nftables-firewall-dropped: "
+func ruleName(prefix string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(prefix), ":"))
+}
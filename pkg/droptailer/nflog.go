@@ -0,0 +1,168 @@
+package droptailer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// the netlink messages and attributes of nfnetlink_log, see linux/netfilter/nfnetlink_log.h
+const (
+	nfnlSubsysULOG = 4
+
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+
+	nfulaCfgCmd  = 1
+	nfulaCfgMode = 2
+
+	nfulnlCfgCmdBind = 1
+
+	nfulnlCopyPacket = 2
+	// copyRange is sufficient for the ip header with options and the ports
+	copyRange = 128
+
+	nfulaTimestamp     = 3
+	nfulaIfindexIndev  = 4
+	nfulaIfindexOutdev = 5
+	nfulaPayload       = 9
+	nfulaPrefix        = 10
+)
+
+// nflog receives the packets logged by nftables to a NFLOG group
+type nflog struct {
+	conn  *netlink.Conn
+	group uint16
+
+	lock       sync.Mutex
+	interfaces map[uint32]string
+}
+
+// openNFLOG binds to the given NFLOG group, only one process can bind to a group
+func openNFLOG(group uint16) (*nflog, error) {
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open netfilter netlink socket: %w", err)
+	}
+	n := &nflog{conn: conn, group: group, interfaces: map[uint32]string{}}
+
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(nfulaCfgCmd, []byte{nfulnlCfgCmdBind})
+	if err := n.configure(ae); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to bind to nflog group %d: %w", group, err)
+	}
+	ae = netlink.NewAttributeEncoder()
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode, copyRange)
+	mode[4] = nfulnlCopyPacket
+	ae.Bytes(nfulaCfgMode, mode)
+	if err := n.configure(ae); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to configure nflog group %d: %w", group, err)
+	}
+	return n, nil
+}
+
+func (n *nflog) configure(ae *netlink.AttributeEncoder) error {
+	attrs, err := ae.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(nfnlSubsysULOG<<8 | nfulnlMsgConfig),
+			Flags: netlink.Request | netlink.Acknowledge,
+		},
+		Data: append(nfgenmsg(n.group), attrs...),
+	})
+	return err
+}
+
+// read blocks until packets were logged, packets which cannot be decoded are skipped
+func (n *nflog) read() ([]Drop, error) {
+	msgs, err := n.conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	drops := []Drop{}
+	for _, m := range msgs {
+		if m.Header.Type != netlink.HeaderType(nfnlSubsysULOG<<8|nfulnlMsgPacket) || len(m.Data) < 4 {
+			continue
+		}
+		d, err := decodePacket(m.Data[4:], time.Now(), n.interfaceName)
+		if err != nil {
+			continue
+		}
+		drops = append(drops, *d)
+	}
+	return drops, nil
+}
+
+func (n *nflog) close() error {
+	return n.conn.Close()
+}
+
+// interfaceName resolves the index of an interface, the names are cached as the vrf and vlan interfaces are stable
+func (n *nflog) interfaceName(index uint32) string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if name, ok := n.interfaces[index]; ok {
+		return name
+	}
+	iface, err := net.InterfaceByIndex(int(index))
+	if err != nil {
+		return fmt.Sprintf("if%d", index)
+	}
+	n.interfaces[index] = iface.Name
+	return iface.Name
+}
+
+// decodePacket decodes the attributes of a packet logged to NFLOG, the packet is received without timestamp in the forward hook
+func decodePacket(b []byte, now time.Time, interfaceName func(uint32) string) (*Drop, error) {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return nil, err
+	}
+	ad.ByteOrder = binary.BigEndian
+
+	d := &Drop{Timestamp: now}
+	var payload []byte
+	for ad.Next() {
+		switch ad.Type() {
+		case nfulaTimestamp:
+			ts := ad.Bytes()
+			if len(ts) == 16 {
+				d.Timestamp = time.Unix(int64(binary.BigEndian.Uint64(ts[:8])), int64(binary.BigEndian.Uint64(ts[8:]))*1000)
+			}
+		case nfulaIfindexIndev:
+			d.InInterface = interfaceName(ad.Uint32())
+		case nfulaIfindexOutdev:
+			d.OutInterface = interfaceName(ad.Uint32())
+		case nfulaPayload:
+			payload = ad.Bytes()
+		case nfulaPrefix:
+			d.Rule = ruleName(ad.String())
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+	if err := decodeIPv4(payload, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// nfgenmsg is the header of nfnetlink messages, the resource id is the group
+func nfgenmsg(group uint16) []byte {
+	b := []byte{unix.AF_UNSPEC, 0 /* NFNETLINK_V0 */, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], group)
+	return b
+}
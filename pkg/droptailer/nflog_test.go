@@ -0,0 +1,104 @@
+package droptailer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+)
+
+func TestDecodePacket(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	interfaceName := func(index uint32) string {
+		return fmt.Sprintf("vrf%d", index)
+	}
+	ipv4 := func(proto byte, fragment uint16, transport ...byte) []byte {
+		b := []byte{0x45, 0, 0, 60, 0, 1, 0, 0, 64, proto, 0, 0, 1, 2, 3, 4, 10, 0, 0, 1}
+		binary.BigEndian.PutUint16(b[6:8], fragment)
+		return append(b, transport...)
+	}
+	packet := func(payload []byte, withTimestamp bool) []byte {
+		ae := netlink.NewAttributeEncoder()
+		ae.ByteOrder = binary.BigEndian
+		ae.Bytes(1, []byte{0x08, 0x00, 2, 0})
+		if withTimestamp {
+			ts := make([]byte, 16)
+			binary.BigEndian.PutUint64(ts[:8], uint64(now.Add(-time.Second).Unix()))
+			binary.BigEndian.PutUint64(ts[8:], 500)
+			ae.Bytes(nfulaTimestamp, ts)
+		}
+		ae.Uint32(nfulaIfindexIndev, 104009)
+		ae.Uint32(nfulaIfindexOutdev, 42)
+		ae.Bytes(nfulaPayload, payload)
+		ae.String(nfulaPrefix, "nftables-firewall-dropped: ")
+		b, err := ae.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	drop := func(ts time.Time, proto string, sport, dport uint16) *Drop {
+		return &Drop{
+			Timestamp:       ts,
+			Rule:            "nftables-firewall-dropped",
+			InInterface:     "vrf104009",
+			OutInterface:    "vrf42",
+			Source:          net.IP{1, 2, 3, 4},
+			Destination:     net.IP{10, 0, 0, 1},
+			Protocol:        proto,
+			SourcePort:      sport,
+			DestinationPort: dport,
+			Length:          60,
+			TTL:             64,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *Drop
+		wantErr bool
+	}{
+		{
+			name: "tcp",
+			data: packet(ipv4(6, 0, 0x12, 0x67, 0x01, 0xbb), false),
+			want: drop(now, "TCP", 4711, 443),
+		},
+		{
+			name: "udp with timestamp",
+			data: packet(ipv4(17, 0, 0x00, 0x35, 0x00, 0x35), true),
+			want: drop(now.Add(-time.Second).Add(500*time.Microsecond), "UDP", 53, 53),
+		},
+		{
+			name: "fragment without ports",
+			data: packet(ipv4(17, 100, 0x00, 0x35, 0x00, 0x35), false),
+			want: drop(now, "UDP", 0, 0),
+		},
+		{
+			name: "icmp",
+			data: packet(ipv4(1, 0, 8, 0), false),
+			want: drop(now, "ICMP", 0, 0),
+		},
+		{
+			name:    "truncated",
+			data:    packet(ipv4(6, 0)[:10], false),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePacket(tt.data, now, interfaceName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodePacket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("decodePacket() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
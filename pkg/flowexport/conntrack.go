@@ -0,0 +1,278 @@
+package flowexport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// the following constants are taken from linux/netfilter/nfnetlink.h, linux/netfilter/nfnetlink_conntrack.h and linux/netlink.h
+const (
+	nfnlgrpConntrackDestroy = 3
+	nfnlSubsysCtnetlink     = 1
+	ipctnlMsgCtDelete       = 2
+
+	ctaTupleOrig     = 1
+	ctaTupleReply    = 2
+	ctaCountersOrig  = 9
+	ctaCountersReply = 10
+	ctaTimestamp     = 20
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+	ctaIPV4Src    = 1
+	ctaIPV4Dst    = 2
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	ctaCountersPackets = 1
+	ctaCountersBytes   = 2
+
+	ctaTimestampStart = 1
+	ctaTimestampStop  = 2
+
+	nlaTypeMask = 0x3fff
+
+	receiveBufferSize = 4 * 1024 * 1024
+	// receiveTimeout limits the time receive blocks, so the reader can be stopped
+	receiveTimeout = time.Second
+)
+
+// conntrackSysctls enable the accounting and the timestamps of connections, which are required for meaningful flows.
+// They apply to all connections of the firewall, so their previous values are restored when the export stops.
+var conntrackSysctls = []string{
+	"/proc/sys/net/netfilter/nf_conntrack_acct",
+	"/proc/sys/net/netfilter/nf_conntrack_timestamp",
+}
+
+// Flow is a finished connection
+type Flow struct {
+	Protocol uint8
+	SrcIP    net.IP
+	DstIP    net.IP
+	SrcPort  uint16
+	DstPort  uint16
+	// PostNATSrcIP and PostNATSrcPort are the source after source nat, they are equal to the source without source nat
+	PostNATSrcIP   net.IP
+	PostNATSrcPort uint16
+	// Packets and Bytes are counted in the direction of the connection, ReplyPackets and ReplyBytes in the direction of the replies
+	Packets      uint64
+	Bytes        uint64
+	ReplyPackets uint64
+	ReplyBytes   uint64
+	Start        time.Time
+	End          time.Time
+	// Source describes the kubernetes object whose rule accepted the connection
+	Source string
+}
+
+// conntrackEvents reads the destroy events of the connection tracking
+type conntrackEvents struct {
+	fd int
+	// sysctls are the previous values of the sysctls which were enabled for the export
+	sysctls map[string][]byte
+}
+
+func newConntrackEvents() (*conntrackEvents, error) {
+	sysctls, err := enableSysctls(conntrackSysctls)
+	if err != nil {
+		_ = restoreSysctls(sysctls)
+		return nil, err
+	}
+	c, err := subscribeConntrackEvents()
+	if err != nil {
+		_ = restoreSysctls(sysctls)
+		return nil, err
+	}
+	c.sysctls = sysctls
+	return c, nil
+}
+
+// enableSysctls sets the given sysctls to 1 and returns the previous values of those which were changed
+func enableSysctls(files []string) (map[string][]byte, error) {
+	previous := map[string][]byte{}
+	for _, sysctl := range files {
+		current, err := ioutil.ReadFile(sysctl)
+		if err != nil {
+			return previous, fmt.Errorf("unable to read %s: %w", sysctl, err)
+		}
+		if bytes.Equal(bytes.TrimSpace(current), []byte("1")) {
+			continue
+		}
+		if err := ioutil.WriteFile(sysctl, []byte("1"), 0644); err != nil {
+			return previous, fmt.Errorf("unable to enable %s: %w", sysctl, err)
+		}
+		previous[sysctl] = current
+	}
+	return previous, nil
+}
+
+// restoreSysctls restores the previous values of sysctls
+func restoreSysctls(previous map[string][]byte) error {
+	var errors *multierror.Error
+	for sysctl, value := range previous {
+		if err := ioutil.WriteFile(sysctl, value, 0644); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("unable to restore %s: %w", sysctl, err))
+		}
+	}
+	return errors.ErrorOrNil()
+}
+
+func subscribeConntrackEvents() (*conntrackEvents, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open netlink socket: %w", err)
+	}
+	// bursts of finished connections must not overflow the socket
+	_ = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, receiveBufferSize)
+	timeout := syscall.NsecToTimeval(receiveTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("unable to set receive timeout: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1 << (nfnlgrpConntrackDestroy - 1)}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("unable to subscribe to conntrack events: %w", err)
+	}
+	return &conntrackEvents{fd: fd}, nil
+}
+
+// receive blocks until the next destroy events are received or the receive timeout expired
+func (c *conntrackEvents) receive() ([]Flow, error) {
+	buf := make([]byte, syscall.Getpagesize()*4)
+	n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	flows := []Flow{}
+	for _, msg := range msgs {
+		if msg.Header.Type != (nfnlSubsysCtnetlink<<8)|ipctnlMsgCtDelete {
+			continue
+		}
+		flow, ok := parseFlow(msg.Data)
+		if !ok {
+			continue
+		}
+		flows = append(flows, flow)
+	}
+	return flows, nil
+}
+
+// close stops the subscription and restores the sysctls
+func (c *conntrackEvents) close() error {
+	var errors *multierror.Error
+	if err := syscall.Close(c.fd); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+	if err := restoreSysctls(c.sysctls); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+	return errors.ErrorOrNil()
+}
+
+// parseFlow parses a conntrack message, only ipv4 connections are parsed
+func parseFlow(msg []byte) (Flow, bool) {
+	if len(msg) < nl.SizeofNfgenmsg || msg[0] != syscall.AF_INET {
+		return Flow{}, false
+	}
+	attrs := parseAttributes(msg[nl.SizeofNfgenmsg:])
+
+	f := Flow{}
+	orig, ok := attrs[ctaTupleOrig]
+	if !ok {
+		return Flow{}, false
+	}
+	f.Protocol, f.SrcIP, f.DstIP, f.SrcPort, f.DstPort = parseTuple(orig)
+	if f.SrcIP == nil || f.DstIP == nil {
+		return Flow{}, false
+	}
+
+	// the reply of a translated connection is addressed to the translated source
+	f.PostNATSrcIP, f.PostNATSrcPort = f.SrcIP, f.SrcPort
+	if reply, ok := attrs[ctaTupleReply]; ok {
+		_, _, dst, _, dport := parseTuple(reply)
+		if dst != nil {
+			f.PostNATSrcIP, f.PostNATSrcPort = dst, dport
+		}
+	}
+
+	f.Packets, f.Bytes = parseCounters(attrs[ctaCountersOrig])
+	f.ReplyPackets, f.ReplyBytes = parseCounters(attrs[ctaCountersReply])
+
+	ts := parseAttributes(attrs[ctaTimestamp])
+	if start := be64(ts[ctaTimestampStart]); start > 0 {
+		f.Start = time.Unix(0, int64(start))
+	}
+	if stop := be64(ts[ctaTimestampStop]); stop > 0 {
+		f.End = time.Unix(0, int64(stop))
+	}
+	return f, true
+}
+
+func parseTuple(data []byte) (protocol uint8, src, dst net.IP, sport, dport uint16) {
+	tuple := parseAttributes(data)
+	ip := parseAttributes(tuple[ctaTupleIP])
+	if v := ip[ctaIPV4Src]; len(v) == net.IPv4len {
+		src = net.IP(append([]byte{}, v...))
+	}
+	if v := ip[ctaIPV4Dst]; len(v) == net.IPv4len {
+		dst = net.IP(append([]byte{}, v...))
+	}
+	proto := parseAttributes(tuple[ctaTupleProto])
+	if v := proto[ctaProtoNum]; len(v) >= 1 {
+		protocol = v[0]
+	}
+	if v := proto[ctaProtoSrcPort]; len(v) >= 2 {
+		sport = binary.BigEndian.Uint16(v)
+	}
+	if v := proto[ctaProtoDstPort]; len(v) >= 2 {
+		dport = binary.BigEndian.Uint16(v)
+	}
+	return protocol, src, dst, sport, dport
+}
+
+func parseCounters(data []byte) (packets, bytes uint64) {
+	counters := parseAttributes(data)
+	return be64(counters[ctaCountersPackets]), be64(counters[ctaCountersBytes])
+}
+
+// parseAttributes parses netlink attributes by type, malformed attributes are ignored
+func parseAttributes(data []byte) map[uint16][]byte {
+	values := map[uint16][]byte{}
+	if len(data) == 0 {
+		return values
+	}
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return values
+	}
+	for _, a := range attrs {
+		values[a.Attr.Type&nlaTypeMask] = a.Value
+	}
+	return values
+}
+
+func be64(v []byte) uint64 {
+	if len(v) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
@@ -0,0 +1,124 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink/nl"
+)
+
+func be16Bytes(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func tupleAttr(attrType int, src, dst string, sport, dport uint16) *nl.RtAttr {
+	tuple := nl.NewRtAttr(attrType|syscall.NLA_F_NESTED, nil)
+	ip := nl.NewRtAttrChild(tuple, ctaTupleIP|syscall.NLA_F_NESTED, nil)
+	nl.NewRtAttrChild(ip, ctaIPV4Src, net.ParseIP(src).To4())
+	nl.NewRtAttrChild(ip, ctaIPV4Dst, net.ParseIP(dst).To4())
+	proto := nl.NewRtAttrChild(tuple, ctaTupleProto|syscall.NLA_F_NESTED, nil)
+	nl.NewRtAttrChild(proto, ctaProtoNum, []byte{syscall.IPPROTO_TCP})
+	nl.NewRtAttrChild(proto, ctaProtoSrcPort, be16Bytes(sport))
+	nl.NewRtAttrChild(proto, ctaProtoDstPort, be16Bytes(dport))
+	return tuple
+}
+
+func countersAttr(attrType int, packets, bytes uint64) *nl.RtAttr {
+	counters := nl.NewRtAttr(attrType|syscall.NLA_F_NESTED, nil)
+	nl.NewRtAttrChild(counters, ctaCountersPackets, be64Bytes(packets))
+	nl.NewRtAttrChild(counters, ctaCountersBytes, be64Bytes(bytes))
+	return counters
+}
+
+func TestParseFlow(t *testing.T) {
+	start := time.Date(2020, 6, 17, 13, 18, 0, 0, time.UTC)
+	end := start.Add(5 * time.Second)
+
+	timestamp := nl.NewRtAttr(ctaTimestamp|syscall.NLA_F_NESTED, nil)
+	nl.NewRtAttrChild(timestamp, ctaTimestampStart, be64Bytes(uint64(start.UnixNano())))
+	nl.NewRtAttrChild(timestamp, ctaTimestampStop, be64Bytes(uint64(end.UnixNano())))
+
+	msg := []byte{syscall.AF_INET, 0, 0, 0}
+	for _, a := range []*nl.RtAttr{
+		tupleAttr(ctaTupleOrig, "10.0.0.1", "1.1.1.1", 40000, 443),
+		tupleAttr(ctaTupleReply, "1.1.1.1", "185.1.2.3", 443, 1024),
+		countersAttr(ctaCountersOrig, 10, 1000),
+		countersAttr(ctaCountersReply, 20, 20000),
+		timestamp,
+	} {
+		msg = append(msg, a.Serialize()...)
+	}
+
+	got, ok := parseFlow(msg)
+	if !ok {
+		t.Fatal("flow was not parsed")
+	}
+	want := Flow{
+		Protocol:       syscall.IPPROTO_TCP,
+		SrcIP:          net.ParseIP("10.0.0.1").To4(),
+		DstIP:          net.ParseIP("1.1.1.1").To4(),
+		SrcPort:        40000,
+		DstPort:        443,
+		PostNATSrcIP:   net.ParseIP("185.1.2.3").To4(),
+		PostNATSrcPort: 1024,
+		Packets:        10,
+		Bytes:          1000,
+		ReplyPackets:   20,
+		ReplyBytes:     20000,
+		Start:          time.Unix(0, start.UnixNano()),
+		End:            time.Unix(0, end.UnixNano()),
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("parseFlow() diff: %v", cmp.Diff(got, want))
+	}
+
+	if _, ok := parseFlow([]byte{syscall.AF_INET6, 0, 0, 0}); ok {
+		t.Errorf("expected ipv6 flows to be skipped")
+	}
+	if _, ok := parseFlow([]byte{syscall.AF_INET, 0, 0, 0}); ok {
+		t.Errorf("expected flows without tuple to be skipped")
+	}
+}
+
+func TestSysctls(t *testing.T) {
+	dir := t.TempDir()
+	acct := filepath.Join(dir, "nf_conntrack_acct")
+	timestamp := filepath.Join(dir, "nf_conntrack_timestamp")
+	_ = ioutil.WriteFile(acct, []byte("0\n"), 0644)
+	_ = ioutil.WriteFile(timestamp, []byte("1\n"), 0644)
+
+	previous, err := enableSysctls([]string{acct, timestamp})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, sysctl := range []string{acct, timestamp} {
+		if v, _ := ioutil.ReadFile(sysctl); string(v) != "1" && string(v) != "1\n" {
+			t.Errorf("expected %s to be enabled, got %q", sysctl, v)
+		}
+	}
+
+	// only the changed sysctls are restored
+	if err := restoreSysctls(previous); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := ioutil.ReadFile(acct); string(v) != "0\n" {
+		t.Errorf("expected the accounting to be restored, got %q", v)
+	}
+	if v, _ := ioutil.ReadFile(timestamp); string(v) != "1\n" {
+		t.Errorf("expected the timestamps to stay enabled, got %q", v)
+	}
+}
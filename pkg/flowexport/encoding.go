@@ -0,0 +1,218 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+const (
+	ipfixVersion    = 10
+	netflow9Version = 9
+
+	ipfixTemplateSetID    = 2
+	netflow9TemplateSetID = 0
+	templateID            = 256
+
+	// sourceLength is the fixed length of the description of the kubernetes object
+	sourceLength = 64
+)
+
+// field is an information element of a record, the ids of IPFIX and NetFlow v9 are the same for the used elements
+type field struct {
+	id     uint16
+	length uint16
+}
+
+// the fields of a flow record, the time fields differ between IPFIX and NetFlow v9
+var (
+	fieldsBefore = []field{
+		{id: 8, length: 4},   // sourceIPv4Address
+		{id: 12, length: 4},  // destinationIPv4Address
+		{id: 7, length: 2},   // sourceTransportPort
+		{id: 11, length: 2},  // destinationTransportPort
+		{id: 4, length: 1},   // protocolIdentifier
+		{id: 225, length: 4}, // postNATSourceIPv4Address
+		{id: 227, length: 2}, // postNAPTSourceTransportPort
+		{id: 1, length: 8},   // octetDeltaCount
+		{id: 2, length: 8},   // packetDeltaCount
+		{id: 23, length: 8},  // postOctetDeltaCount, the bytes of the replies
+		{id: 24, length: 8},  // postPacketDeltaCount, the packets of the replies
+	}
+	fieldsAfter = []field{
+		{id: 96, length: sourceLength}, // applicationName, the kubernetes object
+	}
+	ipfixTimeFields = []field{
+		{id: 152, length: 8}, // flowStartMilliseconds
+		{id: 153, length: 8}, // flowEndMilliseconds
+	}
+	netflow9TimeFields = []field{
+		{id: 22, length: 4}, // FIRST_SWITCHED, milliseconds since boot
+		{id: 21, length: 4}, // LAST_SWITCHED, milliseconds since boot
+	}
+)
+
+// encoder encodes flows into an export message, the template is part of every message,
+// so collectors can decode the flows right after a restart of either side.
+type encoder interface {
+	encode(flows []Flow, now time.Time) []byte
+	// maxRecords is the number of records which fit into a single datagram
+	maxRecords() int
+}
+
+// maxMessageSize keeps the messages below the usual mtu
+const maxMessageSize = 1400
+
+func templateFields(timeFields []field) []field {
+	fields := append([]field{}, fieldsBefore...)
+	fields = append(fields, timeFields...)
+	return append(fields, fieldsAfter...)
+}
+
+func recordLength(fields []field) int {
+	length := 0
+	for _, f := range fields {
+		length += int(f.length)
+	}
+	return length
+}
+
+func appendTemplateSet(b []byte, setID uint16, fields []field) []byte {
+	b = appendUint16(b, setID)
+	b = appendUint16(b, uint16(4+4+4*len(fields)))
+	b = appendUint16(b, templateID)
+	b = appendUint16(b, uint16(len(fields)))
+	for _, f := range fields {
+		b = appendUint16(b, f.id)
+		b = appendUint16(b, f.length)
+	}
+	return b
+}
+
+func appendDataSet(b []byte, flows []Flow, appendTimes func([]byte, Flow) []byte) []byte {
+	start := len(b)
+	b = appendUint16(b, templateID)
+	b = appendUint16(b, 0)
+	for _, f := range flows {
+		b = append(b, ipv4(f.SrcIP)...)
+		b = append(b, ipv4(f.DstIP)...)
+		b = appendUint16(b, f.SrcPort)
+		b = appendUint16(b, f.DstPort)
+		b = append(b, f.Protocol)
+		b = append(b, ipv4(f.PostNATSrcIP)...)
+		b = appendUint16(b, f.PostNATSrcPort)
+		b = appendUint64(b, f.Bytes)
+		b = appendUint64(b, f.Packets)
+		b = appendUint64(b, f.ReplyBytes)
+		b = appendUint64(b, f.ReplyPackets)
+		b = appendTimes(b, f)
+		source := make([]byte, sourceLength)
+		copy(source, f.Source)
+		b = append(b, source...)
+	}
+	// sets are padded to a multiple of four bytes
+	for (len(b)-start)%4 != 0 {
+		b = append(b, 0)
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+// ipfixEncoder encodes flows as IPFIX messages, see RFC 7011
+type ipfixEncoder struct {
+	domain   uint32
+	sequence uint32
+}
+
+func (e *ipfixEncoder) maxRecords() int {
+	fields := templateFields(ipfixTimeFields)
+	return (maxMessageSize - 16 - (8 + 4*len(fields)) - 4) / recordLength(fields)
+}
+
+func (e *ipfixEncoder) encode(flows []Flow, now time.Time) []byte {
+	b := make([]byte, 0, maxMessageSize)
+	b = appendUint16(b, ipfixVersion)
+	b = appendUint16(b, 0)
+	b = appendUint32(b, uint32(now.Unix()))
+	// the sequence number counts the data records sent before this message
+	b = appendUint32(b, e.sequence)
+	b = appendUint32(b, e.domain)
+
+	b = appendTemplateSet(b, ipfixTemplateSetID, templateFields(ipfixTimeFields))
+	b = appendDataSet(b, flows, func(b []byte, f Flow) []byte {
+		b = appendUint64(b, uint64(millis(f.Start)))
+		return appendUint64(b, uint64(millis(f.End)))
+	})
+
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	e.sequence += uint32(len(flows))
+	return b
+}
+
+// netflow9Encoder encodes flows as NetFlow v9 messages, see RFC 3954
+type netflow9Encoder struct {
+	boot     time.Time
+	sourceID uint32
+	sequence uint32
+}
+
+func (e *netflow9Encoder) maxRecords() int {
+	fields := templateFields(netflow9TimeFields)
+	return (maxMessageSize - 20 - (8 + 4*len(fields)) - 4) / recordLength(fields)
+}
+
+func (e *netflow9Encoder) encode(flows []Flow, now time.Time) []byte {
+	b := make([]byte, 0, maxMessageSize)
+	b = appendUint16(b, netflow9Version)
+	// the count includes the template record
+	b = appendUint16(b, uint16(len(flows)+1))
+	b = appendUint32(b, e.uptime(now))
+	b = appendUint32(b, uint32(now.Unix()))
+	// the sequence number counts the messages sent before this message
+	b = appendUint32(b, e.sequence)
+	b = appendUint32(b, e.sourceID)
+
+	b = appendTemplateSet(b, netflow9TemplateSetID, templateFields(netflow9TimeFields))
+	b = appendDataSet(b, flows, func(b []byte, f Flow) []byte {
+		b = appendUint32(b, e.uptime(f.Start))
+		return appendUint32(b, e.uptime(f.End))
+	})
+
+	e.sequence++
+	return b
+}
+
+// uptime returns the milliseconds since the boot of the exporter, the reference of the NetFlow v9 time fields
+func (e *netflow9Encoder) uptime(t time.Time) uint32 {
+	if t.Before(e.boot) {
+		return 0
+	}
+	return uint32(t.Sub(e.boot) / time.Millisecond)
+}
+
+// ipv4 returns the four bytes of an ipv4 address, zeros for any other address
+func ipv4(ip net.IP) []byte {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return make([]byte, net.IPv4len)
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
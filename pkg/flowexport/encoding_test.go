@@ -0,0 +1,146 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testFlow() Flow {
+	start := time.Date(2020, 6, 17, 13, 18, 0, 0, time.UTC)
+	return Flow{
+		Protocol:       syscall.IPPROTO_TCP,
+		SrcIP:          net.ParseIP("10.0.0.1"),
+		DstIP:          net.ParseIP("1.1.1.1"),
+		SrcPort:        40000,
+		DstPort:        443,
+		PostNATSrcIP:   net.ParseIP("185.1.2.3"),
+		PostNATSrcPort: 1024,
+		Packets:        10,
+		Bytes:          1000,
+		ReplyPackets:   20,
+		ReplyBytes:     20000,
+		Start:          start,
+		End:            start.Add(5 * time.Second),
+		Source:         "Service/kube-system/vpn-shoot/loadbalancer",
+	}
+}
+
+// sets splits a message into its sets by id, the header of the given length is skipped
+func sets(t *testing.T, msg []byte, headerLength int) map[uint16][]byte {
+	sets := map[uint16][]byte{}
+	b := msg[headerLength:]
+	for len(b) > 0 {
+		if len(b) < 4 {
+			t.Fatalf("truncated set header")
+		}
+		id, length := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if length < 4 || length > len(b) {
+			t.Fatalf("invalid set length %d", length)
+		}
+		sets[id] = b[4:length]
+		b = b[length:]
+	}
+	return sets
+}
+
+func TestIPFIXEncoder(t *testing.T) {
+	e := &ipfixEncoder{}
+	now := time.Date(2020, 6, 17, 13, 18, 10, 0, time.UTC)
+	flows := []Flow{testFlow(), testFlow()}
+
+	msg := e.encode(flows, now)
+	if v := binary.BigEndian.Uint16(msg); v != ipfixVersion {
+		t.Errorf("version = %d, want %d", v, ipfixVersion)
+	}
+	if l := int(binary.BigEndian.Uint16(msg[2:])); l != len(msg) {
+		t.Errorf("length = %d, want %d", l, len(msg))
+	}
+	if s := binary.BigEndian.Uint32(msg[8:]); s != 0 {
+		t.Errorf("sequence of the first message = %d, want 0", s)
+	}
+
+	s := sets(t, msg, 16)
+	fields := templateFields(ipfixTimeFields)
+	template := s[ipfixTemplateSetID]
+	if id, count := binary.BigEndian.Uint16(template), int(binary.BigEndian.Uint16(template[2:])); id != templateID || count != len(fields) {
+		t.Errorf("template %d with %d fields, want %d with %d fields", id, count, templateID, len(fields))
+	}
+	data := s[templateID]
+	// the data set is padded to 32 bit
+	if padding := len(data) - 2*recordLength(fields); padding < 0 || padding >= 4 {
+		t.Fatalf("data set with %d bytes for two records of %d bytes", len(data), recordLength(fields))
+	}
+	if src := net.IP(data[0:4]); !src.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("source = %s, want 10.0.0.1", src)
+	}
+	if port := binary.BigEndian.Uint16(data[10:]); port != 443 {
+		t.Errorf("destination port = %d, want 443", port)
+	}
+	if nat := net.IP(data[13:17]); !nat.Equal(net.ParseIP("185.1.2.3")) {
+		t.Errorf("post nat source = %s, want 185.1.2.3", nat)
+	}
+	if bytes := binary.BigEndian.Uint64(data[19:]); bytes != 1000 {
+		t.Errorf("bytes = %d, want 1000", bytes)
+	}
+	if start := binary.BigEndian.Uint64(data[51:]); start != uint64(testFlow().Start.UnixNano()/int64(time.Millisecond)) {
+		t.Errorf("unexpected flow start %d", start)
+	}
+	if source := string(data[67 : 67+len(testFlow().Source)]); source != testFlow().Source {
+		t.Errorf("source = %q, want %q", source, testFlow().Source)
+	}
+
+	msg = e.encode(flows, now)
+	if s := binary.BigEndian.Uint32(msg[8:]); s != 2 {
+		t.Errorf("sequence of the second message = %d, want 2", s)
+	}
+
+	maxFlows := make([]Flow, e.maxRecords())
+	for i := range maxFlows {
+		maxFlows[i] = testFlow()
+	}
+	if l := len(e.encode(maxFlows, now)); l > maxMessageSize {
+		t.Errorf("message with %d records has %d bytes, more than %d", e.maxRecords(), l, maxMessageSize)
+	}
+}
+
+func TestNetFlow9Encoder(t *testing.T) {
+	boot := time.Date(2020, 6, 17, 13, 0, 0, 0, time.UTC)
+	e := &netflow9Encoder{boot: boot}
+	now := time.Date(2020, 6, 17, 13, 18, 10, 0, time.UTC)
+
+	msg := e.encode([]Flow{testFlow()}, now)
+	if v := binary.BigEndian.Uint16(msg); v != netflow9Version {
+		t.Errorf("version = %d, want %d", v, netflow9Version)
+	}
+	if c := binary.BigEndian.Uint16(msg[2:]); c != 2 {
+		t.Errorf("count = %d, want the template and one record", c)
+	}
+	if uptime := binary.BigEndian.Uint32(msg[4:]); uptime != uint32(now.Sub(boot)/time.Millisecond) {
+		t.Errorf("unexpected uptime %d", uptime)
+	}
+
+	s := sets(t, msg, 20)
+	if _, ok := s[netflow9TemplateSetID]; !ok {
+		t.Errorf("template flowset is missing")
+	}
+	data := s[templateID]
+	fields := templateFields(netflow9TimeFields)
+	// the data flowset is padded to 32 bit
+	if len(data) < recordLength(fields) || (len(data)+4)%4 != 0 {
+		t.Fatalf("data flowset with %d bytes", len(data))
+	}
+	if first := binary.BigEndian.Uint32(data[51:]); first != uint32(testFlow().Start.Sub(boot)/time.Millisecond) {
+		t.Errorf("unexpected first switched %d", first)
+	}
+
+	msg = e.encode([]Flow{testFlow()}, now)
+	if s := binary.BigEndian.Uint32(msg[12:]); s != 1 {
+		t.Errorf("sequence of the second message = %d, want 1", s)
+	}
+	if l := len(e.encode(make([]Flow, e.maxRecords()), now)); l > maxMessageSize {
+		t.Errorf("message with %d records has %d bytes, more than %d", e.maxRecords(), l, maxMessageSize)
+	}
+}
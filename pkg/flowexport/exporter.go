@@ -0,0 +1,224 @@
+package flowexport
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/nftables"
+)
+
+const (
+	// flushInterval is the longest time a flow is buffered before it is exported
+	flushInterval = time.Second
+	// maxReceiveBackoff is the longest time the export waits after failed receives, the failures are logged once per wait
+	maxReceiveBackoff = time.Minute
+)
+
+type (
+	// Exporter exports the flows of finished connections to a flow collector.
+	// The flows are read from the destroy events of the connection tracking and attributed to the kubernetes objects
+	// whose rules accepted them.
+	Exporter struct {
+		lock   sync.Mutex
+		log    logr.Logger
+		config *firewallv1.FlowExport
+		stop   chan struct{}
+		done   chan struct{}
+
+		// the sources are guarded by a lock of their own, as they are read by the running export which is stopped under lock
+		sourcesLock sync.RWMutex
+		sources     *nftables.FlowSources
+
+		newReader func() (flowReader, error)
+	}
+
+	// flowReader reads the flows of finished connections, receive must return at least once per second
+	flowReader interface {
+		receive() ([]Flow, error)
+		close() error
+	}
+)
+
+// NewExporter creates a new exporter, which is started by the first update with a configuration
+func NewExporter(log logr.Logger) *Exporter {
+	return &Exporter{
+		log: log,
+		newReader: func() (flowReader, error) {
+			return newConntrackEvents()
+		},
+	}
+}
+
+// Update starts, reconfigures or stops the export according to the given configuration,
+// the flows are attributed to kubernetes objects by the given sources.
+func (e *Exporter) Update(config *firewallv1.FlowExport, sources *nftables.FlowSources) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.sourcesLock.Lock()
+	e.sources = sources
+	e.sourcesLock.Unlock()
+
+	if reflect.DeepEqual(config, e.config) {
+		return nil
+	}
+
+	e.stopExport()
+	if config == nil {
+		e.log.Info("stopped flow export")
+		return nil
+	}
+
+	enc, err := newEncoder(config.Protocol)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp", config.Collector)
+	if err != nil {
+		return fmt.Errorf("unable to connect to flow collector %s: %w", config.Collector, err)
+	}
+	reader, err := e.newReader()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	e.config = config.DeepCopy()
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run(reader, conn, enc, e.stop, e.done)
+
+	e.log.Info("started flow export", "collector", config.Collector, "protocol", config.Protocol)
+	return nil
+}
+
+// Stop stops the export
+func (e *Exporter) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.stopExport()
+}
+
+// Run stops the export when the controller stops, which restores the conntrack sysctls
+func (e *Exporter) Run(stop <-chan struct{}) error {
+	<-stop
+	e.Stop()
+	return nil
+}
+
+func (e *Exporter) stopExport() {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+	}
+	e.config = nil
+	e.stop = nil
+	e.done = nil
+}
+
+func newEncoder(protocol string) (encoder, error) {
+	switch protocol {
+	case "", firewallv1.FlowExportIPFIX:
+		return &ipfixEncoder{}, nil
+	case firewallv1.FlowExportNetFlow9:
+		return &netflow9Encoder{boot: time.Now()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported flow export protocol %q", protocol)
+	}
+}
+
+func (e *Exporter) run(reader flowReader, conn net.Conn, enc encoder, stop, done chan struct{}) {
+	defer close(done)
+	defer conn.Close()
+	defer func() {
+		if err := reader.close(); err != nil {
+			e.log.Error(err, "unable to stop reading flows")
+		}
+	}()
+
+	pending := []Flow{}
+	lastFlush := time.Now()
+	backoff := time.Duration(0)
+	for {
+		select {
+		case <-stop:
+			e.send(conn, enc, pending)
+			return
+		default:
+		}
+
+		flows, err := reader.receive()
+		if err != nil {
+			backoff *= 2
+			if backoff < flushInterval {
+				backoff = flushInterval
+			}
+			if backoff > maxReceiveBackoff {
+				backoff = maxReceiveBackoff
+			}
+			e.log.Error(err, "unable to receive flows", "retry", backoff)
+			select {
+			case <-stop:
+			case <-time.After(backoff):
+			}
+		} else {
+			backoff = 0
+		}
+		now := time.Now()
+		for _, f := range flows {
+			if f.End.IsZero() {
+				f.End = now
+			}
+			f.Source = e.source(f)
+			pending = append(pending, f)
+		}
+
+		for len(pending) >= enc.maxRecords() {
+			e.send(conn, enc, pending[:enc.maxRecords()])
+			pending = pending[enc.maxRecords():]
+		}
+		if now.Sub(lastFlush) >= flushInterval {
+			e.send(conn, enc, pending)
+			pending = pending[:0]
+			lastFlush = now
+		}
+	}
+}
+
+func (e *Exporter) send(conn net.Conn, enc encoder, flows []Flow) {
+	if len(flows) == 0 {
+		return
+	}
+	if _, err := conn.Write(enc.encode(flows, time.Now())); err != nil {
+		e.log.Error(err, "unable to export flows", "flows", len(flows))
+	}
+}
+
+// source describes the kubernetes object whose rule accepted a flow, e.g. Service/kube-system/vpn-shoot/loadbalancer
+func (e *Exporter) source(f Flow) string {
+	e.sourcesLock.RLock()
+	sources := e.sources
+	e.sourcesLock.RUnlock()
+
+	var protocol string
+	switch f.Protocol {
+	case syscall.IPPROTO_TCP:
+		protocol = "tcp"
+	case syscall.IPPROTO_UDP:
+		protocol = "udp"
+	default:
+		return ""
+	}
+	src := sources.Match(protocol, f.SrcIP, f.DstIP, f.DstPort)
+	if src == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", src.Kind, src.Namespace, src.Name, src.Rule)
+}
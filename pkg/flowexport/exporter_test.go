@@ -0,0 +1,89 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+type fakeReader struct {
+	lock   sync.Mutex
+	flows  []Flow
+	closed bool
+}
+
+func (r *fakeReader) receive() ([]Flow, error) {
+	time.Sleep(10 * time.Millisecond)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	flows := r.flows
+	r.flows = nil
+	return flows, nil
+}
+
+func (r *fakeReader) isClosed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.closed
+}
+
+func (r *fakeReader) close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	return nil
+}
+
+func TestExporter(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+
+	reader := &fakeReader{flows: []Flow{testFlow()}}
+	e := NewExporter(logr.Discard())
+	e.newReader = func() (flowReader, error) {
+		return reader, nil
+	}
+
+	config := &firewallv1.FlowExport{Collector: collector.LocalAddr().String(), Protocol: firewallv1.FlowExportNetFlow9}
+	if err := e.Update(config, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := make([]byte, maxMessageSize)
+	_ = collector.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := collector.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no flows exported: %v", err)
+	}
+	if v := binary.BigEndian.Uint16(buf[:n]); v != netflow9Version {
+		t.Errorf("exported version %d, want %d", v, netflow9Version)
+	}
+
+	// an unchanged configuration keeps the export running
+	if err := e.Update(config.DeepCopy(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reader.isClosed() {
+		t.Errorf("export was restarted without a change of the configuration")
+	}
+
+	if err := e.Update(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reader.isClosed() {
+		t.Errorf("export was not stopped")
+	}
+
+	if err := e.Update(&firewallv1.FlowExport{Collector: collector.LocalAddr().String(), Protocol: "sflow"}, nil); err == nil {
+		t.Errorf("expected an error for an unsupported protocol")
+	}
+}
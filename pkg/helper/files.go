@@ -0,0 +1,27 @@
+package helper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteFile writes a file atomically by writing a temporary file next to it and renaming it,
+// readers either see the previous or the new content. The directory is created if it does not exist.
+func WriteFile(file string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return fmt.Errorf("unable to create directory of %s: %w", file, err)
+	}
+	tmp := fmt.Sprintf("%s.%d", file, time.Now().UnixNano())
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to write %s: %w", file, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to write %s: %w", file, err)
+	}
+	return nil
+}
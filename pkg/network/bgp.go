@@ -0,0 +1,116 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// bgpSummaryCommand queries the summary of the BGP sessions of all vrfs and address families from FRR
+var bgpSummaryCommand = []string{"vtysh", "-c", "show bgp vrf all summary json"}
+
+type (
+	// bgpSummary is the summary of an address family of a vrf as reported by vtysh
+	bgpSummary struct {
+		Peers map[string]bgpPeer `json:"peers"`
+	}
+
+	// bgpPeer is a neighbor in the summary, FRR renamed the prefix counters between releases
+	bgpPeer struct {
+		Hostname            string `json:"hostname"`
+		RemoteAS            int64  `json:"remoteAs"`
+		State               string `json:"state"`
+		PeerUptimeMsec      int64  `json:"peerUptimeMsec"`
+		PfxRcd              *int64 `json:"pfxRcd"`
+		PrefixReceivedCount *int64 `json:"prefixReceivedCount"`
+		PfxSnt              *int64 `json:"pfxSnt"`
+	}
+)
+
+// BGPNeighbors queries FRR for the state of the BGP sessions of all vrfs
+func BGPNeighbors() ([]firewallv1.BGPNeighbor, error) {
+	out, err := exec.Command(bgpSummaryCommand[0], bgpSummaryCommand[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to query bgp summary from frr: %w", err)
+	}
+	return parseBGPSummary(out)
+}
+
+// parseBGPSummary parses the output of "show bgp vrf all summary json", which is keyed by vrf and address family
+func parseBGPSummary(data []byte) ([]firewallv1.BGPNeighbor, error) {
+	vrfs := map[string]map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &vrfs); err != nil {
+		return nil, fmt.Errorf("unable to parse bgp summary: %w", err)
+	}
+
+	neighbors := []firewallv1.BGPNeighbor{}
+	for vrf, families := range vrfs {
+		for family, raw := range families {
+			var summary bgpSummary
+			// vrfs without bgp instance or address families without neighbors are reported with other attributes only
+			if err := json.Unmarshal(raw, &summary); err != nil {
+				continue
+			}
+			for name, peer := range summary.Peers {
+				n := firewallv1.BGPNeighbor{
+					VRF:           vrf,
+					AddressFamily: family,
+					Peer:          name,
+					Hostname:      peer.Hostname,
+					RemoteAS:      peer.RemoteAS,
+					State:         peer.State,
+					Uptime:        metav1.Duration{Duration: time.Duration(peer.PeerUptimeMsec) * time.Millisecond},
+				}
+				if peer.PfxRcd != nil {
+					n.PrefixesReceived = *peer.PfxRcd
+				} else if peer.PrefixReceivedCount != nil {
+					n.PrefixesReceived = *peer.PrefixReceivedCount
+				}
+				if peer.PfxSnt != nil {
+					n.PrefixesAdvertised = *peer.PfxSnt
+				}
+				neighbors = append(neighbors, n)
+			}
+		}
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		a, b := neighbors[i], neighbors[j]
+		if a.VRF != b.VRF {
+			return a.VRF < b.VRF
+		}
+		if a.AddressFamily != b.AddressFamily {
+			return a.AddressFamily < b.AddressFamily
+		}
+		return a.Peer < b.Peer
+	})
+	return neighbors, nil
+}
+
+// SummarizeBGP counts the configured and established sessions
+func SummarizeBGP(neighbors []firewallv1.BGPNeighbor) *firewallv1.BGPStatus {
+	status := &firewallv1.BGPStatus{Total: len(neighbors)}
+	for _, n := range neighbors {
+		if n.State == firewallv1.BGPStateEstablished {
+			status.Established++
+		}
+	}
+	return status
+}
+
+// DownBGPNeighbors returns the sessions which are not established
+func DownBGPNeighbors(neighbors []firewallv1.BGPNeighbor) []firewallv1.BGPNeighbor {
+	down := []firewallv1.BGPNeighbor{}
+	for _, n := range neighbors {
+		if n.State != firewallv1.BGPStateEstablished {
+			down = append(down, n)
+		}
+	}
+	return down
+}
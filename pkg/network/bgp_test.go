@@ -0,0 +1,71 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestParseBGPSummary(t *testing.T) {
+	summary := `{
+  "default": {
+    "ipv4Unicast": {
+      "routerId": "10.1.0.1",
+      "as": 4200003073,
+      "vrfName": "default",
+      "peers": {
+        "lan0": {"hostname": "leaf01", "remoteAs": 4200003000, "state": "Established", "peerUptimeMsec": 3723000, "pfxRcd": 12, "pfxSnt": 5},
+        "lan1": {"hostname": "leaf02", "remoteAs": 4200003000, "state": "Active", "peerUptimeMsec": 0, "pfxRcd": 0, "pfxSnt": 0}
+      },
+      "failedPeers": 1,
+      "totalPeers": 2
+    },
+    "l2VpnEvpn": {
+      "peers": {
+        "lan0": {"hostname": "leaf01", "remoteAs": 4200003000, "state": "Established", "peerUptimeMsec": 3723000, "prefixReceivedCount": 40}
+      }
+    }
+  },
+  "vrf104009": {
+    "ipv4Unicast": {
+      "peers": {
+        "10.0.0.1": {"remoteAs": 4200003073, "state": "Idle", "peerUptimeMsec": 1000}
+      }
+    }
+  },
+  "vrf3981": {}
+}`
+
+	got, err := parseBGPSummary([]byte(summary))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uptime := metav1.Duration{Duration: time.Hour + 2*time.Minute + 3*time.Second}
+	want := []firewallv1.BGPNeighbor{
+		{VRF: "default", AddressFamily: "ipv4Unicast", Peer: "lan0", Hostname: "leaf01", RemoteAS: 4200003000, State: "Established", Uptime: uptime, PrefixesReceived: 12, PrefixesAdvertised: 5},
+		{VRF: "default", AddressFamily: "ipv4Unicast", Peer: "lan1", Hostname: "leaf02", RemoteAS: 4200003000, State: "Active"},
+		{VRF: "default", AddressFamily: "l2VpnEvpn", Peer: "lan0", Hostname: "leaf01", RemoteAS: 4200003000, State: "Established", Uptime: uptime, PrefixesReceived: 40},
+		{VRF: "vrf104009", AddressFamily: "ipv4Unicast", Peer: "10.0.0.1", RemoteAS: 4200003073, State: "Idle", Uptime: metav1.Duration{Duration: time.Second}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("parseBGPSummary() diff: %v", cmp.Diff(got, want))
+	}
+
+	status := SummarizeBGP(got)
+	if status.Established != 2 || status.Total != 4 {
+		t.Errorf("unexpected bgp status: %v", status)
+	}
+
+	down := DownBGPNeighbors(got)
+	if len(down) != 2 || down[0].Peer != "lan1" || down[1].Peer != "10.0.0.1" {
+		t.Errorf("unexpected down neighbors: %v", down)
+	}
+
+	if _, err := parseBGPSummary([]byte("% BGP instance not found")); err == nil {
+		t.Errorf("expected an error for malformed output")
+	}
+}
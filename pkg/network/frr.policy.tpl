@@ -0,0 +1,44 @@
+! routing policies of the firewall spec
+{{- range .Networks }}
+{{- $vrf := .VRF }}
+{{- range .Accept }}
+ip prefix-list fw-vrf{{ $vrf }}-accept seq {{ .Seq }} permit {{ .Filter }}
+{{- end }}
+{{- range .Announce }}
+ip prefix-list fw-vrf{{ $vrf }}-announce seq {{ .Seq }} permit {{ .Filter }}
+{{- end }}
+{{- end }}
+{{- if .PrivateImport }}
+!
+{{- range $n := .PrivateImport }}
+route-map fw-vrf{{ $.PrivateVRF }}-import permit {{ $n.Seq }}
+ match source-vrf vrf{{ $n.VRF }}
+{{- if $n.Accept }}
+ match ip address prefix-list fw-vrf{{ $n.VRF }}-accept
+{{- end }}
+{{- if $n.LocalPreference }}
+ set local-preference {{ $n.LocalPreference }}
+{{- end }}
+ call vrf{{ $.PrivateVRF }}-import-map
+{{- if $n.Accept }}
+route-map fw-vrf{{ $.PrivateVRF }}-import deny {{ $n.DenySeq }}
+ match source-vrf vrf{{ $n.VRF }}
+{{- end }}
+{{- end }}
+route-map fw-vrf{{ .PrivateVRF }}-import permit 65000
+ call vrf{{ .PrivateVRF }}-import-map
+{{- end }}
+{{- range .Networks }}
+{{- if .ImportMap }}
+!
+route-map fw-vrf{{ .VRF }}-import permit 10
+{{- if .Announce }}
+ match ip address prefix-list fw-vrf{{ .VRF }}-announce
+{{- end }}
+{{- if .Communities }}
+ set community {{ .Communities }} additive
+{{- end }}
+ call vrf{{ .VRF }}-import-map
+{{- end }}
+{{- end }}
+!
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -26,6 +27,11 @@ var templates embed.FS
 // ReconcileNetwork reconciles the network settings for a firewall
 // in the current stage it only changes the FRR-Configuration when network prefixes or FRR template changes
 func ReconcileNetwork(f firewallv1.Firewall, log logr.Logger) (bool, error) {
+	policy, err := renderRoutingPolicies(f.Spec)
+	if err != nil {
+		return false, fmt.Errorf("invalid routing policies: %w", err)
+	}
+
 	kb := netconf.NewKnowledgeBase(MetalKnowledgeBase)
 
 	networkMap := map[string]firewallv1.FirewallNetwork{}
@@ -53,7 +59,7 @@ func ReconcileNetwork(f firewallv1.Firewall, log logr.Logger) (bool, error) {
 	}()
 
 	a := netconf.NewFrrConfigApplier(netconf.Firewall, kb, tmpFile)
-	tpl, err := readTpl(netconf.TplFirewallFRR)
+	tpl, err := readTpl(netconf.TplFirewallFRR, policy)
 	if err != nil {
 		return false, fmt.Errorf("error during network reconcilation: %v: %w", tmpFile, err)
 	}
@@ -80,7 +86,8 @@ func tmpFile(prefix string) (string, error) {
 	return f.Name(), nil
 }
 
-func readTpl(tplName string) (*template.Template, error) {
+// readTpl reads the template, the routing policy is applied to the configuration the template renders
+func readTpl(tplName string, policy *routingPolicy) (*template.Template, error) {
 	contents, err := templates.ReadFile(tplName)
 	if err != nil {
 		return nil, err
@@ -90,6 +97,22 @@ func readTpl(tplName string) (*template.Template, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not parse template %v from embed.FS: %w", tplName, err)
 	}
+	if policy == nil {
+		return t, nil
+	}
+
+	withPolicy, err := template.New(tplName + "+policy").Funcs(template.FuncMap{
+		"withPolicy": func(data interface{}) (string, error) {
+			var b bytes.Buffer
+			if err := t.Execute(&b, data); err != nil {
+				return "", err
+			}
+			return policy.apply(b.String())
+		},
+	}).Parse("{{ withPolicy . }}")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %v with routing policies: %w", tplName, err)
+	}
 
-	return t, nil
+	return withPolicy, nil
 }
@@ -0,0 +1,94 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	mn "github.com/metal-stack/metal-lib/pkg/net"
+	"github.com/metal-stack/metal-networker/pkg/netconf"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestReadTplWithRoutingPolicies(t *testing.T) {
+	if _, err := templates.ReadFile(netconf.TplFirewallFRR); err != nil {
+		t.Skipf("the template of metal-networker is fetched with make fetch-template: %v", err)
+	}
+
+	str := func(s string) *string { return &s }
+	i64 := func(i int64) *int64 { return &i }
+	u32 := func(i uint32) *uint32 { return &i }
+
+	policy, err := renderRoutingPolicies(firewallv1.FirewallSpec{
+		Data: firewallv1.Data{
+			FirewallNetworks: []firewallv1.FirewallNetwork{
+				{Networkid: str("private"), Networktype: str(mn.PrivatePrimaryUnshared), Asn: i64(4200003073), Vrf: i64(3981)},
+				{Networkid: str("internet"), Networktype: str(mn.External), Asn: i64(4200003073), Vrf: i64(104009)},
+			},
+			RoutingPolicies: []firewallv1.RoutingPolicy{
+				{
+					NetworkID:       "internet",
+					Accept:          []firewallv1.PrefixFilter{{Prefix: "0.0.0.0/0"}},
+					Announce:        []firewallv1.PrefixFilter{{Prefix: "185.1.2.0/24"}},
+					LocalPreference: u32(50),
+					Communities:     []string{"65000:100"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vrf := func(id int, prefixes string, imports ...string) netconf.VRF {
+		name := fmt.Sprintf("vrf%d-import-prefixes", id)
+		return netconf.VRF{
+			Identity:       netconf.Identity{ID: id},
+			VNI:            id,
+			ImportVRFNames: imports,
+			IPPrefixLists: []netconf.IPPrefixList{
+				{Name: name, Spec: "permit " + prefixes, AddressFamily: netconf.AddressFamilyIPv4},
+			},
+			RouteMaps: []netconf.RouteMap{
+				{Name: fmt.Sprintf("vrf%d-import-map", id), Policy: "permit", Order: 10, Entries: []string{"match ip address prefix-list " + name}},
+				{Name: fmt.Sprintf("vrf%d-import-map", id), Policy: "deny", Order: 20},
+			},
+		}
+	}
+	data := netconf.FirewallFRRData{
+		CommonFRRData: netconf.CommonFRRData{
+			ASN:        4200003073,
+			Comment:    "# This file was auto generated.",
+			FRRVersion: "7.5",
+			Hostname:   "firewall",
+			RouterID:   "10.1.0.1",
+		},
+		VRFs: []netconf.VRF{
+			vrf(3981, "0.0.0.0/0", "vrf104009"),
+			vrf(104009, "10.0.0.0/8 le 32", "vrf3981"),
+		},
+	}
+
+	tpl, err := readTpl(netconf.TplFirewallFRR, policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var b bytes.Buffer
+	if err := tpl.Execute(&b, data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rendered, _ := ioutil.ReadFile(path.Join("test_data", "routing-policies.frr.conf"))
+	if got, want := b.String(), string(rendered); got != want {
+		t.Errorf("readTpl() diff: %v", cmp.Diff(got, want))
+	}
+
+	// the policies are not applied if metal-networker renders no import route-map for a vrf
+	data.VRFs = data.VRFs[:1]
+	if err := tpl.Execute(&b, data); err == nil {
+		t.Errorf("expected an error for a vrf without import route-map")
+	}
+}
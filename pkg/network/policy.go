@@ -0,0 +1,304 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/go-multierror"
+	mn "github.com/metal-stack/metal-lib/pkg/net"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// tplRoutingPolicy renders the prefix-lists and route-maps of the routing policies, the import route-maps of metal-networker
+// are named vrf<vrf>-import-map and are called after the policy is applied
+const tplRoutingPolicy = "frr.policy.tpl"
+
+// sectionBeforePolicies is the line of the FRR configuration of metal-networker the routing policies are inserted before
+const sectionBeforePolicies = "line vty"
+
+// wellKnownCommunities are the BGP communities FRR accepts by name
+var wellKnownCommunities = map[string]bool{
+	"internet":          true,
+	"local-AS":          true,
+	"no-advertise":      true,
+	"no-export":         true,
+	"no-peer":           true,
+	"graceful-shutdown": true,
+	"blackhole":         true,
+}
+
+type (
+	// routingPolicy is the rendered routing policy, which is applied to the rendered FRR configuration of metal-networker
+	routingPolicy struct {
+		// section contains the prefix-lists and route-maps of the policy
+		section string
+		// importVRFs are the vrfs whose ipv4 import route-map is replaced by the route-map of the policy
+		importVRFs []int64
+	}
+
+	// policyConfig is the input of the routing policy template
+	policyConfig struct {
+		PrivateVRF int64
+		Networks   []policyNetwork
+		// PrivateImport are the networks of which the routes imported into the private vrf are filtered or modified
+		PrivateImport []policyNetwork
+	}
+
+	// policyNetwork is the routing policy of an external network
+	policyNetwork struct {
+		VRF             int64
+		Accept          []prefixEntry
+		Announce        []prefixEntry
+		LocalPreference string
+		Communities     string
+		Seq             int
+		DenySeq         int
+	}
+
+	// prefixEntry is an entry of a prefix-list
+	prefixEntry struct {
+		Seq    int
+		Filter string
+	}
+)
+
+// renderRoutingPolicies validates the routing policies of the firewall spec and renders them as FRR configuration,
+// nil is returned if there are no policies
+func renderRoutingPolicies(spec firewallv1.FirewallSpec) (*routingPolicy, error) {
+	c, err := newPolicyConfig(spec)
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	contents, err := templates.ReadFile(tplRoutingPolicy)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(tplRoutingPolicy).Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %v from embed.FS: %w", tplRoutingPolicy, err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, c); err != nil {
+		return nil, fmt.Errorf("could not render routing policies: %w", err)
+	}
+
+	p := &routingPolicy{section: b.String()}
+	if len(c.PrivateImport) > 0 {
+		p.importVRFs = append(p.importVRFs, c.PrivateVRF)
+	}
+	for _, n := range c.Networks {
+		if n.ImportMap() {
+			p.importVRFs = append(p.importVRFs, n.VRF)
+		}
+	}
+	return p, nil
+}
+
+// ImportMap returns whether the import route-map of the external vrf is replaced, which filters and marks the announced routes
+func (n policyNetwork) ImportMap() bool {
+	return len(n.Announce) > 0 || n.Communities != ""
+}
+
+// apply replaces the ipv4 import route-maps of the vrfs in the rendered FRR configuration of metal-networker by the route-maps
+// of the policy and inserts the prefix-lists and route-maps of the policy as a section of their own
+func (p *routingPolicy) apply(config string) (string, error) {
+	replaced := map[string]bool{}
+	var (
+		b        strings.Builder
+		vrf      string
+		ipv4     bool
+		inserted bool
+	)
+	for _, line := range strings.SplitAfter(config, "\n") {
+		trimmed := strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 5 && fields[0] == "router" && fields[1] == "bgp" && fields[3] == "vrf":
+			vrf = fields[4]
+		case !strings.HasPrefix(line, " "):
+			vrf = ""
+			ipv4 = false
+		case trimmed == "address-family ipv4 unicast":
+			ipv4 = true
+		case trimmed == "exit-address-family":
+			ipv4 = false
+		}
+
+		if vrf != "" && ipv4 && trimmed == fmt.Sprintf("import vrf route-map %s-import-map", vrf) && p.imports(vrf) {
+			line = strings.Replace(line, vrf+"-import-map", "fw-"+vrf+"-import", 1)
+			replaced[vrf] = true
+		}
+		if trimmed == sectionBeforePolicies && !inserted {
+			b.WriteString(p.section)
+			inserted = true
+		}
+		b.WriteString(line)
+	}
+	if !inserted {
+		if !strings.HasSuffix(config, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(p.section)
+	}
+
+	var errors *multierror.Error
+	for _, id := range p.importVRFs {
+		if !replaced[fmt.Sprintf("vrf%d", id)] {
+			errors = multierror.Append(errors, fmt.Errorf("no ipv4 import route-map of vrf%d found in the FRR configuration", id))
+		}
+	}
+	if errors.ErrorOrNil() != nil {
+		return "", errors
+	}
+	return b.String(), nil
+}
+
+func (p *routingPolicy) imports(vrf string) bool {
+	for _, id := range p.importVRFs {
+		if fmt.Sprintf("vrf%d", id) == vrf {
+			return true
+		}
+	}
+	return false
+}
+
+// newPolicyConfig validates the routing policies against the firewall networks
+func newPolicyConfig(spec firewallv1.FirewallSpec) (*policyConfig, error) {
+	if len(spec.RoutingPolicies) == 0 {
+		return nil, nil
+	}
+
+	var (
+		errors   *multierror.Error
+		c        = &policyConfig{}
+		private  *firewallv1.FirewallNetwork
+		networks = map[string]firewallv1.FirewallNetwork{}
+	)
+	for i := range spec.FirewallNetworks {
+		n := spec.FirewallNetworks[i]
+		if n.Networkid == nil || n.Networktype == nil {
+			continue
+		}
+		networks[*n.Networkid] = n
+		if *n.Networktype == mn.PrivatePrimaryUnshared || *n.Networktype == mn.PrivatePrimaryShared {
+			private = &n
+		}
+	}
+	if private == nil || private.Vrf == nil {
+		return nil, fmt.Errorf("routing policies require a private network with vrf")
+	}
+	c.PrivateVRF = *private.Vrf
+
+	seen := map[string]bool{}
+	for _, p := range spec.RoutingPolicies {
+		n, ok := networks[p.NetworkID]
+		if !ok {
+			errors = multierror.Append(errors, fmt.Errorf("routing policy for unknown network %q", p.NetworkID))
+			continue
+		}
+		if *n.Networktype != mn.External || n.Vrf == nil {
+			errors = multierror.Append(errors, fmt.Errorf("routing policy for network %q, which is not an external network", p.NetworkID))
+			continue
+		}
+		if seen[p.NetworkID] {
+			errors = multierror.Append(errors, fmt.Errorf("duplicate routing policy for network %q", p.NetworkID))
+			continue
+		}
+		seen[p.NetworkID] = true
+
+		pn := policyNetwork{VRF: *n.Vrf}
+		var err error
+		if pn.Accept, err = prefixEntries(p.Accept); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("invalid accepted prefixes of network %q: %w", p.NetworkID, err))
+		}
+		if pn.Announce, err = prefixEntries(p.Announce); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("invalid announced prefixes of network %q: %w", p.NetworkID, err))
+		}
+		for _, community := range p.Communities {
+			if err := validateCommunity(community); err != nil {
+				errors = multierror.Append(errors, fmt.Errorf("invalid community of network %q: %w", p.NetworkID, err))
+			}
+		}
+		pn.Communities = strings.Join(p.Communities, " ")
+		if p.LocalPreference != nil {
+			pn.LocalPreference = strconv.FormatUint(uint64(*p.LocalPreference), 10)
+		}
+		c.Networks = append(c.Networks, pn)
+	}
+	if errors.ErrorOrNil() != nil {
+		return nil, errors
+	}
+
+	sort.Slice(c.Networks, func(i, j int) bool { return c.Networks[i].VRF < c.Networks[j].VRF })
+	for _, pn := range c.Networks {
+		if len(pn.Accept) == 0 && pn.LocalPreference == "" {
+			continue
+		}
+		pn.Seq = 10 * (len(c.PrivateImport) + 1)
+		pn.DenySeq = pn.Seq + 1
+		c.PrivateImport = append(c.PrivateImport, pn)
+	}
+	return c, nil
+}
+
+// prefixEntries validates the prefix filters and converts them to prefix-list entries
+func prefixEntries(filters []firewallv1.PrefixFilter) ([]prefixEntry, error) {
+	var (
+		errors  *multierror.Error
+		entries []prefixEntry
+	)
+	for i, f := range filters {
+		ip, ipnet, err := net.ParseCIDR(f.Prefix)
+		if err != nil || ip.To4() == nil {
+			errors = multierror.Append(errors, fmt.Errorf("%q is no ipv4 prefix", f.Prefix))
+			continue
+		}
+		if !ip.Equal(ipnet.IP) {
+			errors = multierror.Append(errors, fmt.Errorf("%q has host bits set, use %s", f.Prefix, ipnet))
+			continue
+		}
+		length, _ := ipnet.Mask.Size()
+		filter := ipnet.String()
+		if f.GE != nil {
+			if int(*f.GE) <= length || *f.GE > 32 {
+				errors = multierror.Append(errors, fmt.Errorf("ge %d of %q must be longer than the prefix and at most 32", *f.GE, f.Prefix))
+				continue
+			}
+			filter += fmt.Sprintf(" ge %d", *f.GE)
+		}
+		if f.LE != nil {
+			if int(*f.LE) < length || *f.LE > 32 || (f.GE != nil && *f.LE < *f.GE) {
+				errors = multierror.Append(errors, fmt.Errorf("le %d of %q must be at least the prefix length and ge and at most 32", *f.LE, f.Prefix))
+				continue
+			}
+			filter += fmt.Sprintf(" le %d", *f.LE)
+		}
+		entries = append(entries, prefixEntry{Seq: 10 * (i + 1), Filter: filter})
+	}
+	return entries, errors.ErrorOrNil()
+}
+
+// validateCommunity checks that the community is well-known or in the format AA:NN
+func validateCommunity(community string) error {
+	if wellKnownCommunities[community] {
+		return nil
+	}
+	parts := strings.Split(community, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("%q is neither well-known nor in the format AA:NN", community)
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 16); err != nil {
+			return fmt.Errorf("%q is neither well-known nor in the format AA:NN", community)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	mn "github.com/metal-stack/metal-lib/pkg/net"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestRenderRoutingPolicies(t *testing.T) {
+	str := func(s string) *string { return &s }
+	i64 := func(i int64) *int64 { return &i }
+	u8 := func(i uint8) *uint8 { return &i }
+	u32 := func(i uint32) *uint32 { return &i }
+
+	networks := []firewallv1.FirewallNetwork{
+		{Networkid: str("private"), Networktype: str(mn.PrivatePrimaryUnshared), Asn: i64(4200003073), Vrf: i64(3981)},
+		{Networkid: str("internet"), Networktype: str(mn.External), Asn: i64(4200003073), Vrf: i64(104009)},
+		{Networkid: str("mpls"), Networktype: str(mn.External), Asn: i64(4200003073), Vrf: i64(104010)},
+		{Networkid: str("underlay"), Networktype: str(mn.Underlay), Asn: i64(4200003073), Vrf: i64(0)},
+	}
+
+	tests := []struct {
+		name           string
+		policies       []firewallv1.RoutingPolicy
+		want           string
+		wantImportVRFs []int64
+		wantErr        bool
+	}{
+		{
+			name: "no policies",
+			want: "",
+		},
+		{
+			name: "accept, announce, local preference and communities",
+			policies: []firewallv1.RoutingPolicy{
+				{
+					NetworkID: "mpls",
+					Accept:    []firewallv1.PrefixFilter{{Prefix: "10.100.0.0/16", LE: u8(24)}},
+				},
+				{
+					NetworkID:       "internet",
+					Announce:        []firewallv1.PrefixFilter{{Prefix: "185.1.2.0/24"}, {Prefix: "212.34.0.0/16", GE: u8(24), LE: u8(28)}},
+					LocalPreference: u32(50),
+					Communities:     []string{"65000:100", "no-export"},
+				},
+			},
+			want: `! routing policies of the firewall spec
+ip prefix-list fw-vrf104009-announce seq 10 permit 185.1.2.0/24
+ip prefix-list fw-vrf104009-announce seq 20 permit 212.34.0.0/16 ge 24 le 28
+ip prefix-list fw-vrf104010-accept seq 10 permit 10.100.0.0/16 le 24
+!
+route-map fw-vrf3981-import permit 10
+ match source-vrf vrf104009
+ set local-preference 50
+ call vrf3981-import-map
+route-map fw-vrf3981-import permit 20
+ match source-vrf vrf104010
+ match ip address prefix-list fw-vrf104010-accept
+ call vrf3981-import-map
+route-map fw-vrf3981-import deny 21
+ match source-vrf vrf104010
+route-map fw-vrf3981-import permit 65000
+ call vrf3981-import-map
+!
+route-map fw-vrf104009-import permit 10
+ match ip address prefix-list fw-vrf104009-announce
+ set community 65000:100 no-export additive
+ call vrf104009-import-map
+!
+`,
+			wantImportVRFs: []int64{3981, 104009},
+		},
+		{
+			name: "announce only",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet", Communities: []string{"blackhole"}},
+			},
+			want: `! routing policies of the firewall spec
+!
+route-map fw-vrf104009-import permit 10
+ set community blackhole additive
+ call vrf104009-import-map
+!
+`,
+			wantImportVRFs: []int64{104009},
+		},
+		{
+			name: "unknown network",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "unknown"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no external network",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "underlay"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate network",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet"},
+				{NetworkID: "internet"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid prefixes",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet", Accept: []firewallv1.PrefixFilter{{Prefix: "10.0.0.1/8"}}},
+				{NetworkID: "mpls", Announce: []firewallv1.PrefixFilter{{Prefix: "2001:db8::/32"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ge not longer than the prefix",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet", Accept: []firewallv1.PrefixFilter{{Prefix: "10.0.0.0/16", GE: u8(16)}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "le shorter than ge",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet", Accept: []firewallv1.PrefixFilter{{Prefix: "10.0.0.0/16", GE: u8(24), LE: u8(20)}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid community",
+			policies: []firewallv1.RoutingPolicy{
+				{NetworkID: "internet", Communities: []string{"65000:70000"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderRoutingPolicies(firewallv1.FirewallSpec{
+				Data: firewallv1.Data{
+					FirewallNetworks: networks,
+					RoutingPolicies:  tt.policies,
+				},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderRoutingPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var (
+				section    string
+				importVRFs []int64
+			)
+			if got != nil {
+				section, importVRFs = got.section, got.importVRFs
+			}
+			if section != tt.want {
+				t.Errorf("renderRoutingPolicies() diff: %v", cmp.Diff(section, tt.want))
+			}
+			if !cmp.Equal(importVRFs, tt.wantImportVRFs) {
+				t.Errorf("renderRoutingPolicies() import vrfs diff: %v", cmp.Diff(importVRFs, tt.wantImportVRFs))
+			}
+		})
+	}
+}
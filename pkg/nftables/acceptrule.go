@@ -0,0 +1,78 @@
+package nftables
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// acceptRule is an accept rule of the forward chain generated for a kubernetes object.
+// It is rendered into the ruleset and the flows accepted by it are attributed to its source.
+type acceptRule struct {
+	// source identifies the kubernetes object including the protocol of the ports
+	source firewallv1.RuleSource
+	// fromCluster restricts the sources to the cluster_prefixes set
+	fromCluster bool
+	saddrExcept []string
+	saddr       []string
+	daddrExcept []string
+	daddr       []string
+	ports       []string
+	statements  []string
+	// comment is the custom comment appended to the identifier of the source
+	comment string
+}
+
+type acceptRules []acceptRule
+
+func (r acceptRule) render() string {
+	common := []string{}
+	if r.fromCluster {
+		common = append(common, "ip saddr == @cluster_prefixes")
+	}
+	if len(r.saddrExcept) > 0 {
+		common = append(common, fmt.Sprintf("ip saddr != { %s }", strings.Join(r.saddrExcept, ", ")))
+	}
+	if len(r.saddr) > 0 {
+		common = append(common, fmt.Sprintf("ip saddr { %s }", strings.Join(r.saddr, ", ")))
+	}
+	if len(r.daddrExcept) > 0 {
+		common = append(common, fmt.Sprintf("ip daddr != { %s }", strings.Join(r.daddrExcept, ", ")))
+	}
+	if len(r.daddr) > 0 {
+		common = append(common, fmt.Sprintf("ip daddr { %s }", strings.Join(r.daddr, ", ")))
+	}
+	return assembleDestinationPortRuleWithStatements(common, r.source.Protocol, r.ports, r.statements, ruleComment(r.source, r.comment))
+}
+
+func (rules acceptRules) render() nftablesRules {
+	if rules == nil {
+		return nil
+	}
+	rendered := nftablesRules{}
+	for _, r := range rules {
+		rendered = append(rendered, r.render())
+	}
+	return rendered
+}
+
+// uniqueSorted returns the rules sorted by their rendering, rules which render identically are dropped
+func (rules acceptRules) uniqueSorted() acceptRules {
+	rendered := map[string]acceptRule{}
+	for _, r := range rules {
+		rendered[r.render()] = r
+	}
+	keys := []string{}
+	for k := range rendered {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sorted := acceptRules{}
+	for _, k := range keys {
+		sorted = append(sorted, rendered[k])
+	}
+	return sorted
+}
@@ -0,0 +1,164 @@
+package nftables
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	annotationPrefix = "firewall.metal-stack.io/"
+
+	// AnnotationDisabled opts a service out of the automatically generated firewall rules, e.g. "true"
+	AnnotationDisabled = annotationPrefix + "disabled"
+	// AnnotationSourceRangesPrefix followed by a service port number or name adds extra source CIDRs
+	// to the loadBalancerSourceRanges for this port, e.g. "firewall.metal-stack.io/source-ranges.443: 10.0.0.0/8,1.2.3.4"
+	AnnotationSourceRangesPrefix = annotationPrefix + "source-ranges."
+	// AnnotationLog enables logging of accepted packets, e.g. "true"
+	AnnotationLog = annotationPrefix + "log"
+	// AnnotationRateLimit limits the rate of accepted packets, e.g. "100/second" or "100/second burst 10 packets"
+	AnnotationRateLimit = annotationPrefix + "rate-limit"
+	// AnnotationComment overrides the description of the generated rules which is used as key for the rule statistics
+	AnnotationComment = annotationPrefix + "comment"
+	// AnnotationIPS sends the accepted connections to suricata for inline inspection, e.g. "true"
+	AnnotationIPS = annotationPrefix + "ips"
+
+	maxCommentLength = 100
+)
+
+var rateLimitRegex = regexp.MustCompile(`^[1-9][0-9]*/(second|minute|hour|day)( burst [1-9][0-9]* packets)?$`)
+
+// serviceAnnotations holds the parsed firewall annotations of a service
+type serviceAnnotations struct {
+	disabled     bool
+	sourceRanges map[string][]string
+	log          bool
+	rateLimit    string
+	comment      string
+	ips          bool
+}
+
+// ValidateServiceAnnotations validates the firewall annotations of a service,
+// invalid annotations are ignored when the rules for the service are generated.
+func ValidateServiceAnnotations(svc corev1.Service) error {
+	_, err := parseServiceAnnotations(svc)
+	return err
+}
+
+// parseServiceAnnotations parses the firewall annotations of a service, only valid annotations are returned
+func parseServiceAnnotations(svc corev1.Service) (serviceAnnotations, error) {
+	var errors *multierror.Error
+	a := serviceAnnotations{
+		sourceRanges: map[string][]string{},
+	}
+
+	keys := []string{}
+	for k := range svc.Annotations {
+		if strings.HasPrefix(k, annotationPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := strings.TrimSpace(svc.Annotations[k])
+		switch {
+		case k == AnnotationDisabled:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s must be a boolean, but %q given", k, v))
+				continue
+			}
+			a.disabled = b
+		case k == AnnotationLog:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s must be a boolean, but %q given", k, v))
+				continue
+			}
+			a.log = b
+		case k == AnnotationIPS:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s must be a boolean, but %q given", k, v))
+				continue
+			}
+			a.ips = b
+		case k == AnnotationRateLimit:
+			if !rateLimitRegex.MatchString(v) {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s must be a rate like 100/second, but %q given", k, v))
+				continue
+			}
+			a.rateLimit = v
+		case k == AnnotationComment:
+			if v == "" || len(v) > maxCommentLength || strings.ContainsAny(v, "\"\\\n") {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s must be a non-empty string of at most %d characters without quotes, but %q given", k, maxCommentLength, v))
+				continue
+			}
+			a.comment = v
+		case strings.HasPrefix(k, AnnotationSourceRangesPrefix):
+			p := strings.TrimPrefix(k, AnnotationSourceRangesPrefix)
+			if !hasServicePort(svc, p) {
+				errors = multierror.Append(errors, fmt.Errorf("annotation %s references port %s which is not a port of the service", k, p))
+				continue
+			}
+			ranges := []string{}
+			valid := true
+			for _, r := range strings.Split(v, ",") {
+				r = strings.TrimSpace(r)
+				if !isCIDR(r) && !isIP(r) {
+					errors = multierror.Append(errors, fmt.Errorf("annotation %s contains %q which is not a valid IP or CIDR", k, r))
+					valid = false
+					break
+				}
+				ranges = append(ranges, r)
+			}
+			if valid {
+				a.sourceRanges[p] = ranges
+			}
+		default:
+			errors = multierror.Append(errors, fmt.Errorf("annotation %s is unknown", k))
+		}
+	}
+
+	return a, errors.ErrorOrNil()
+}
+
+// extraSourceRanges returns the extra source ranges for a service port, which is referenced by number or name
+func (a serviceAnnotations) extraSourceRanges(p corev1.ServicePort) []string {
+	ranges := append([]string{}, a.sourceRanges[fmt.Sprint(p.Port)]...)
+	if p.Name != "" {
+		ranges = append(ranges, a.sourceRanges[p.Name]...)
+	}
+	return ranges
+}
+
+// statements returns the statements to add to an accept rule
+func (a serviceAnnotations) statements() []string {
+	statements := []string{}
+	if a.rateLimit != "" {
+		statements = append(statements, fmt.Sprintf("limit rate %s", a.rateLimit))
+	}
+	statements = append(statements, "counter")
+	if a.ips {
+		statements = append(statements, ipsMarkStatement)
+	}
+	if a.log {
+		statements = append(statements, `log prefix "nftables-firewall-accepted: "`)
+	}
+	return statements
+}
+
+func hasServicePort(svc corev1.Service, port string) bool {
+	for _, p := range svc.Spec.Ports {
+		if port == fmt.Sprint(p.Port) || (p.Name != "" && port == p.Name) {
+			return true
+		}
+	}
+	return false
+}
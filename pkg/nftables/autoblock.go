@@ -0,0 +1,44 @@
+package nftables
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// autoBlockSet is the set of nftables.tpl which contains the sources blocked because of ids alerts
+const autoBlockSet = "auto_block"
+
+// UpdateAutoBlockSet replaces the elements of the set of blocked sources atomically with the given sources and their remaining timeouts.
+// The kernel removes an element after its timeout, so a block expires even if the controller is not running.
+func UpdateAutoBlockSet(timeouts map[string]time.Duration) error {
+	c := exec.Command(nftBin, "-f", "-")
+	c.Stdin = strings.NewReader(autoBlockCommands(timeouts))
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to update set %s: %s, err: %w", autoBlockSet, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+func autoBlockCommands(timeouts map[string]time.Duration) string {
+	commands := []string{fmt.Sprintf("flush set ip firewall %s", autoBlockSet)}
+	if len(timeouts) > 0 {
+		ips := []string{}
+		for ip := range timeouts {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		elements := []string{}
+		for _, ip := range ips {
+			// nftables requires a timeout of at least a second
+			seconds := math.Max(1, math.Ceil(timeouts[ip].Seconds()))
+			elements = append(elements, fmt.Sprintf("%s timeout %.0fs", ip, seconds))
+		}
+		commands = append(commands, fmt.Sprintf("add element ip firewall %s { %s }", autoBlockSet, strings.Join(elements, ", ")))
+	}
+	return strings.Join(commands, "\n") + "\n"
+}
@@ -0,0 +1,37 @@
+package nftables
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAutoBlockCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts map[string]time.Duration
+		want     string
+	}{
+		{
+			name: "no blocked sources",
+			want: "flush set ip firewall auto_block\n",
+		},
+		{
+			name: "blocked sources",
+			timeouts: map[string]time.Duration{
+				"2.2.2.2": 500 * time.Millisecond,
+				"1.1.1.1": time.Hour + 100*time.Millisecond,
+			},
+			want: "flush set ip firewall auto_block\nadd element ip firewall auto_block { 1.1.1.1 timeout 3601s, 2.2.2.2 timeout 1s }\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := autoBlockCommands(tt.timeouts)
+			if got != tt.want {
+				t.Errorf("autoBlockCommands() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
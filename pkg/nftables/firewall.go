@@ -35,13 +35,27 @@ type Firewall struct {
 	spec                       firewallv1.FirewallSpec
 	clusterwideNetworkPolicies *firewallv1.ClusterwideNetworkPolicyList
 	services                   *corev1.ServiceList
+	nodes                      *corev1.NodeList
+	ingressRestrictions        []IngressSourceRestriction
 
 	primaryPrivateNet *firewallv1.FirewallNetwork
 	networkMap        networkMap
 
+	reloadObserver ReloadObserver
+	ipsQueue       *uint16
+	dropLogGroup   *uint16
+
 	dryRun bool
 }
 
+// ReloadObserver is notified around reloads of the ruleset, which reset all counters
+type ReloadObserver interface {
+	// BeforeReload is called right before the ruleset is reloaded
+	BeforeReload()
+	// AfterReload is called after the ruleset was reloaded with the error of the reload
+	AfterReload(err error)
+}
+
 type networkMap map[string]firewallv1.FirewallNetwork
 
 type nftablesRules []string
@@ -54,11 +68,11 @@ type forwardingRules struct {
 // NewDefaultFirewall creates a new default nftables firewall.
 func NewDefaultFirewall(log logr.Logger) *Firewall {
 	defaultSpec := firewallv1.FirewallSpec{}
-	return NewFirewall(&firewallv1.ClusterwideNetworkPolicyList{}, &v1.ServiceList{}, defaultSpec, log)
+	return NewFirewall(&firewallv1.ClusterwideNetworkPolicyList{}, &v1.ServiceList{}, &v1.NodeList{}, nil, defaultSpec, log)
 }
 
 // NewFirewall creates a new nftables firewall object based on k8s entities
-func NewFirewall(nps *firewallv1.ClusterwideNetworkPolicyList, svcs *corev1.ServiceList, spec firewallv1.FirewallSpec, log logr.Logger) *Firewall {
+func NewFirewall(nps *firewallv1.ClusterwideNetworkPolicyList, svcs *corev1.ServiceList, nodes *corev1.NodeList, ingressRestrictions []IngressSourceRestriction, spec firewallv1.FirewallSpec, log logr.Logger) *Firewall {
 	networkMap := networkMap{}
 	var primaryPrivateNet *firewallv1.FirewallNetwork
 	for i, n := range spec.FirewallNetworks {
@@ -75,6 +89,8 @@ func NewFirewall(nps *firewallv1.ClusterwideNetworkPolicyList, svcs *corev1.Serv
 		spec:                       spec,
 		clusterwideNetworkPolicies: nps,
 		services:                   svcs,
+		nodes:                      nodes,
+		ingressRestrictions:        ingressRestrictions,
 		primaryPrivateNet:          primaryPrivateNet,
 		networkMap:                 networkMap,
 		dryRun:                     spec.DryRun,
@@ -82,6 +98,17 @@ func NewFirewall(nps *firewallv1.ClusterwideNetworkPolicyList, svcs *corev1.Serv
 	}
 }
 
+// SetReloadObserver sets the observer which is notified around reloads of the ruleset
+func (f *Firewall) SetReloadObserver(o ReloadObserver) {
+	f.reloadObserver = o
+}
+
+// SetDropLogGroup logs the dropped packets to the given NFLOG group instead of the kernel log,
+// then also the packets dropped by the rate limits, the blocked sources, ping floods and an invalid ct state are logged
+func (f *Firewall) SetDropLogGroup(group uint16) {
+	f.dropLogGroup = &group
+}
+
 func (f *Firewall) ipv4RuleFile() string {
 	if f.spec.Ipv4RuleFile != "" {
 		return f.spec.Ipv4RuleFile
@@ -253,8 +280,14 @@ func (f *Firewall) reload() error {
 		return nil
 	}
 
+	if f.reloadObserver != nil {
+		f.reloadObserver.BeforeReload()
+	}
 	c := exec.Command(systemctlBin, "reload", nftablesService)
 	err := c.Run()
+	if f.reloadObserver != nil {
+		f.reloadObserver.AfterReload(err)
+	}
 	if err != nil {
 		return fmt.Errorf("could not reload nftables service, err: %w", err)
 	}
@@ -0,0 +1,143 @@
+package nftables
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+// clusterPrefixes are the elements of the cluster_prefixes set of nftables.tpl
+var clusterPrefixes = []string{"10.0.0.0/8"}
+
+// FlowSources attributes flows to the kubernetes objects the accept rules of the forward chain were rendered for
+type FlowSources struct {
+	matchers []flowMatcher
+}
+
+// flowMatcher holds the selectors of an accept rule
+type flowMatcher struct {
+	source      firewallv1.RuleSource
+	protocol    string
+	saddr       []*net.IPNet
+	saddrExcept []*net.IPNet
+	daddr       []*net.IPNet
+	daddrExcept []*net.IPNet
+	ports       []portRange
+}
+
+type portRange struct {
+	from, to uint16
+}
+
+// FlowSources returns the sources of the accept rules of the forward chain, in the order they are evaluated by nftables
+func (f *Firewall) FlowSources() *FlowSources {
+	ingress, egress := f.acceptRules()
+	return newFlowSources(append(append(acceptRules{}, ingress...), egress...))
+}
+
+func newFlowSources(rules acceptRules) *FlowSources {
+	s := &FlowSources{}
+	for _, rule := range rules {
+		s.matchers = append(s.matchers, newFlowMatcher(rule))
+	}
+	return s
+}
+
+// newFlowMatcher returns the selectors of an accept rule, elements nftables would not accept are skipped
+func newFlowMatcher(rule acceptRule) flowMatcher {
+	m := flowMatcher{
+		source:      rule.source,
+		protocol:    rule.source.Protocol,
+		saddr:       parseNets(rule.saddr),
+		saddrExcept: parseNets(rule.saddrExcept),
+		daddr:       parseNets(rule.daddr),
+		daddrExcept: parseNets(rule.daddrExcept),
+	}
+	if rule.fromCluster {
+		m.saddr = append(m.saddr, parseNets(clusterPrefixes)...)
+	}
+	for _, p := range rule.ports {
+		r, ok := parsePortRange(p)
+		if !ok {
+			continue
+		}
+		m.ports = append(m.ports, r)
+	}
+	return m
+}
+
+func parseNets(elements []string) []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, e := range elements {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			e += "/32"
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func parsePortRange(p string) (portRange, bool) {
+	parts := strings.SplitN(strings.TrimSpace(p), "-", 2)
+	from, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return portRange{}, false
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return portRange{}, false
+		}
+	}
+	return portRange{from: uint16(from), to: uint16(to)}, true
+}
+
+// Match returns the source of the first accept rule matching a flow, nil if the flow was not accepted by a rule generated for a kubernetes object
+func (s *FlowSources) Match(protocol string, src, dst net.IP, dport uint16) *firewallv1.RuleSource {
+	if s == nil {
+		return nil
+	}
+	for i := range s.matchers {
+		m := &s.matchers[i]
+		if m.matches(protocol, src, dst, dport) {
+			source := m.source
+			return &source
+		}
+	}
+	return nil
+}
+
+func (m *flowMatcher) matches(protocol string, src, dst net.IP, dport uint16) bool {
+	if m.protocol != protocol {
+		return false
+	}
+	if len(m.saddr) > 0 && !containsIP(m.saddr, src) || containsIP(m.saddrExcept, src) {
+		return false
+	}
+	if len(m.daddr) > 0 && !containsIP(m.daddr, dst) || containsIP(m.daddrExcept, dst) {
+		return false
+	}
+	for _, r := range m.ports {
+		if dport >= r.from && dport <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
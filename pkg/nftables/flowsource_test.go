@@ -0,0 +1,124 @@
+package nftables
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestFlowSources(t *testing.T) {
+	svc := func(rule string) *firewallv1.RuleSource {
+		return &firewallv1.RuleSource{Kind: KindService, Namespace: "test", Name: "svc", UID: "1", Rule: rule, Protocol: "tcp"}
+	}
+	policy := func(name, uid, rule, protocol string) *firewallv1.RuleSource {
+		return &firewallv1.RuleSource{Kind: KindClusterwideNetworkPolicy, Namespace: "firewall", Name: name, UID: uid, Rule: rule, Protocol: protocol}
+	}
+
+	sources := newFlowSources(acceptRules{
+		{source: *svc("loadbalancer"), saddr: []string{"185.0.0.0/16"}, daddr: []string{"185.0.0.1"}, ports: []string{"443"}},
+		{source: *svc("nodeport"), daddr: []string{"10.0.0.1", "10.0.0.2"}, ports: []string{"30000-30010"}},
+		{source: *policy("allow-dns", "2", "ingress-0", "udp"), saddrExcept: []string{"1.1.1.1"}, saddr: []string{"1.1.0.0/16"}, ports: []string{"53"}},
+		{source: *policy("allow-dns", "2", "egress-0", "udp"), fromCluster: true, daddrExcept: []string{"8.8.4.4"}, daddr: []string{"8.8.0.0/16"}, ports: []string{"53"}},
+		{source: *policy("allow-https", "3", "egress-0", "tcp"), fromCluster: true, ports: []string{"443"}},
+	})
+
+	tests := []struct {
+		name     string
+		protocol string
+		src      string
+		dst      string
+		dport    uint16
+		want     *firewallv1.RuleSource
+	}{
+		{
+			name:     "load balancer",
+			protocol: "tcp",
+			src:      "185.0.1.1",
+			dst:      "185.0.0.1",
+			dport:    443,
+			want:     svc("loadbalancer"),
+		},
+		{
+			name:     "load balancer from other source",
+			protocol: "tcp",
+			src:      "186.0.1.1",
+			dst:      "185.0.0.1",
+			dport:    443,
+		},
+		{
+			name:     "node port range",
+			protocol: "tcp",
+			src:      "186.0.1.1",
+			dst:      "10.0.0.2",
+			dport:    30005,
+			want:     svc("nodeport"),
+		},
+		{
+			name:     "ingress policy",
+			protocol: "udp",
+			src:      "1.1.2.2",
+			dst:      "10.0.0.2",
+			dport:    53,
+			want:     policy("allow-dns", "2", "ingress-0", "udp"),
+		},
+		{
+			name:     "ingress policy except",
+			protocol: "udp",
+			src:      "1.1.1.1",
+			dst:      "10.0.0.2",
+			dport:    53,
+		},
+		{
+			name:     "egress policy",
+			protocol: "udp",
+			src:      "10.1.2.3",
+			dst:      "8.8.8.8",
+			dport:    53,
+			want:     policy("allow-dns", "2", "egress-0", "udp"),
+		},
+		{
+			name:     "egress policy except",
+			protocol: "udp",
+			src:      "10.1.2.3",
+			dst:      "8.8.4.4",
+			dport:    53,
+		},
+		{
+			name:     "egress policy to any destination",
+			protocol: "tcp",
+			src:      "10.1.2.3",
+			dst:      "1.2.3.4",
+			dport:    443,
+			want:     policy("allow-https", "3", "egress-0", "tcp"),
+		},
+		{
+			name:     "egress from outside the cluster",
+			protocol: "tcp",
+			src:      "11.1.2.3",
+			dst:      "1.2.3.4",
+			dport:    443,
+		},
+		{
+			name:     "port without rule",
+			protocol: "tcp",
+			src:      "10.1.2.3",
+			dst:      "1.2.3.4",
+			dport:    80,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sources.Match(tt.protocol, net.ParseIP(tt.src), net.ParseIP(tt.dst), tt.dport)
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("Match() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+
+	var empty *FlowSources
+	if got := empty.Match("tcp", net.ParseIP("10.0.0.1"), net.ParseIP("1.1.1.1"), 443); got != nil {
+		t.Errorf("expected no source without rules, got %v", got)
+	}
+}
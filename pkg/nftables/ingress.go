@@ -0,0 +1,223 @@
+package nftables
+
+import (
+	"fmt"
+	"strings"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// AnnotationIngressSourceRanges restricts the sources of an Ingress or all listeners of a Gateway, e.g. "10.0.0.0/8,1.2.3.4"
+	AnnotationIngressSourceRanges = annotationPrefix + "source-ranges"
+	// AnnotationGatewayListenerSourceRangesPrefix followed by a listener name replaces the source ranges of the Gateway for a single listener,
+	// e.g. "firewall.metal-stack.io/listener-source-ranges.api: 1.2.3.4"
+	AnnotationGatewayListenerSourceRangesPrefix = annotationPrefix + "listener-source-ranges."
+)
+
+// ingressSourceRangeAnnotations are the annotations of ingress controllers which restrict the sources of an Ingress
+var ingressSourceRangeAnnotations = []string{
+	"nginx.ingress.kubernetes.io/whitelist-source-range",
+	"nginx.ingress.kubernetes.io/allowlist-source-range",
+	AnnotationIngressSourceRanges,
+}
+
+// IngressSourceRestriction holds the sources which are allowed to reach the ips of an ingress controller for an Ingress or Gateway listener.
+// The restriction applies per ip of the ingress controller and not per hostname, see the README.
+type IngressSourceRestriction struct {
+	// Source identifies the restricting object, the protocol is set for the generated rules
+	Source firewallv1.RuleSource
+	// IPs of the ingress controller
+	IPs []string
+	// SourceRanges which are allowed, if empty any source is allowed
+	SourceRanges []string
+	// Invalid is the reason why the source ranges of the object are rejected, then no source is allowed
+	Invalid string
+}
+
+// IngressSourceRestrictions computes the source restrictions of Ingresses and Gateways
+func IngressSourceRestrictions(ingresses *networkingv1beta1.IngressList, gateways *unstructured.UnstructuredList) []IngressSourceRestriction {
+	restrictions := []IngressSourceRestriction{}
+	if ingresses != nil {
+		for _, i := range ingresses.Items {
+			ips := []string{}
+			for _, lb := range i.Status.LoadBalancer.Ingress {
+				if isIP(lb.IP) {
+					ips = append(ips, lb.IP)
+				}
+			}
+			if len(ips) == 0 {
+				continue
+			}
+
+			restriction := IngressSourceRestriction{
+				Source: firewallv1.RuleSource{
+					Kind:      KindIngress,
+					Namespace: i.Namespace,
+					Name:      i.Name,
+					UID:       string(i.UID),
+					Rule:      ServiceRuleLoadBalancer,
+				},
+				IPs: uniqueSorted(ips),
+			}
+			ranges := []string{}
+			for _, a := range ingressSourceRangeAnnotations {
+				v, ok := i.Annotations[a]
+				if !ok {
+					continue
+				}
+				r, err := parseSourceRanges(a, v)
+				if err != nil {
+					restriction.Invalid = err.Error()
+					ranges = nil
+					break
+				}
+				ranges = append(ranges, r...)
+			}
+			restriction.SourceRanges = uniqueSorted(ranges)
+
+			restrictions = append(restrictions, restriction)
+		}
+	}
+
+	if gateways != nil {
+		for _, g := range gateways.Items {
+			restrictions = append(restrictions, gatewaySourceRestrictions(g)...)
+		}
+	}
+
+	return restrictions
+}
+
+// gatewaySourceRestrictions computes the source restrictions of every listener of a Gateway
+func gatewaySourceRestrictions(g unstructured.Unstructured) []IngressSourceRestriction {
+	ips := []string{}
+	addresses, _, _ := unstructured.NestedSlice(g.Object, "status", "addresses")
+	for _, a := range addresses {
+		address, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ip, _, _ := unstructured.NestedString(address, "value")
+		if isIP(ip) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	annotations := g.GetAnnotations()
+	gatewayRanges, gatewayErr := parseSourceRanges(AnnotationIngressSourceRanges, annotations[AnnotationIngressSourceRanges])
+
+	restrictions := []IngressSourceRestriction{}
+	listeners, _, _ := unstructured.NestedSlice(g.Object, "spec", "listeners")
+	for _, l := range listeners {
+		listener, ok := l.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(listener, "name")
+
+		ranges, err := gatewayRanges, gatewayErr
+		if v, ok := annotations[AnnotationGatewayListenerSourceRangesPrefix+name]; ok {
+			ranges, err = parseSourceRanges(AnnotationGatewayListenerSourceRangesPrefix+name, v)
+		}
+		invalid := ""
+		if err != nil {
+			invalid = err.Error()
+		}
+
+		restrictions = append(restrictions, IngressSourceRestriction{
+			Source: firewallv1.RuleSource{
+				Kind:      KindGateway,
+				Namespace: g.GetNamespace(),
+				Name:      g.GetName(),
+				UID:       string(g.GetUID()),
+				Rule:      "listener-" + name,
+			},
+			IPs:          uniqueSorted(ips),
+			SourceRanges: uniqueSorted(ranges),
+			Invalid:      invalid,
+		})
+	}
+	return restrictions
+}
+
+// parseSourceRanges parses the comma separated list of source ranges of an annotation,
+// if any of them is invalid the whole annotation is rejected
+func parseSourceRanges(annotation, v string) ([]string, error) {
+	ranges := []string{}
+	for _, r := range strings.Split(v, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !isCIDR(r) && !isIP(r) {
+			return nil, fmt.Errorf("annotation %s contains %q which is not a valid IP or CIDR, no source is allowed", annotation, r)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// ingressRules tightens the rules for the load balancer ips of an ingress controller service:
+// an ip is only restricted if every Ingress or Gateway listener served by it restricts the sources,
+// the allowed sources are the union of all restrictions with a rule per Ingress or Gateway listener.
+// An Ingress or listener with invalid source ranges restricts the ip but allows no source, it fails closed.
+// It returns the ips which remain unrestricted and the rules for the restricted ones.
+func ingressRules(to, tcpPorts, udpPorts []string, restrictions []IngressSourceRestriction, a serviceAnnotations) ([]string, acceptRules) {
+	// the rules belong to the Ingresses and Gateways, so the custom comment of the service is not used
+	a.comment = ""
+	open := []string{}
+	restricted := map[string]bool{}
+	for _, ip := range to {
+		served := false
+		unrestricted := false
+		for _, r := range restrictions {
+			if !contains(r.IPs, ip) {
+				continue
+			}
+			served = true
+			if len(r.SourceRanges) == 0 && r.Invalid == "" {
+				unrestricted = true
+				break
+			}
+		}
+		if !served || unrestricted {
+			open = append(open, ip)
+			continue
+		}
+		restricted[ip] = true
+	}
+
+	rules := acceptRules{}
+	if len(restricted) == 0 {
+		return open, rules
+	}
+
+	for _, r := range restrictions {
+		if r.Invalid != "" {
+			continue
+		}
+		daddrs := []string{}
+		for _, ip := range r.IPs {
+			if restricted[ip] {
+				daddrs = append(daddrs, ip)
+			}
+		}
+		rules = append(rules, assembleServiceRules(r.SourceRanges, daddrs, tcpPorts, udpPorts, a, r.Source)...)
+	}
+	return open, rules
+}
+
+func contains(elements []string, e string) bool {
+	for _, element := range elements {
+		if element == e {
+			return true
+		}
+	}
+	return false
+}
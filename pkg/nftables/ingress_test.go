@@ -0,0 +1,209 @@
+package nftables
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIngressSourceRestrictions(t *testing.T) {
+	ingresses := &networkingv1beta1.IngressList{
+		Items: []networkingv1beta1.Ingress{
+			{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "shop",
+					Name:      "frontend",
+					Annotations: map[string]string{
+						"nginx.ingress.kubernetes.io/whitelist-source-range": "185.0.0.0/16, 185.1.0.0/16",
+					},
+				},
+				Spec: networkingv1beta1.IngressSpec{
+					Rules: []networkingv1beta1.IngressRule{
+						{Host: "shop.example.com"},
+					},
+				},
+				Status: networkingv1beta1.IngressStatus{
+					LoadBalancer: corev1.LoadBalancerStatus{
+						Ingress: []corev1.LoadBalancerIngress{
+							{IP: "185.0.0.1"},
+						},
+					},
+				},
+			},
+			{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "shop",
+					Name:      "invalid",
+					Annotations: map[string]string{
+						AnnotationIngressSourceRanges: "185.0.0.0/16, no-cidr",
+					},
+				},
+				Status: networkingv1beta1.IngressStatus{
+					LoadBalancer: corev1.LoadBalancerStatus{
+						Ingress: []corev1.LoadBalancerIngress{
+							{IP: "185.0.0.1"},
+						},
+					},
+				},
+			},
+			{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "shop",
+					Name:      "pending",
+				},
+			},
+		},
+	}
+	gateways := &unstructured.UnstructuredList{
+		Items: []unstructured.Unstructured{
+			{
+				Object: map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"namespace": "infra",
+						"name":      "gw",
+						"annotations": map[string]interface{}{
+							AnnotationIngressSourceRanges:                       "10.0.0.0/8",
+							AnnotationGatewayListenerSourceRangesPrefix + "api": "1.2.3.4",
+						},
+					},
+					"spec": map[string]interface{}{
+						"listeners": []interface{}{
+							map[string]interface{}{"name": "web", "hostname": "www.example.com"},
+							map[string]interface{}{"name": "api"},
+						},
+					},
+					"status": map[string]interface{}{
+						"addresses": []interface{}{
+							map[string]interface{}{"type": "IPAddress", "value": "185.0.0.2"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	want := []IngressSourceRestriction{
+		{
+			Source:       firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "frontend", Rule: ServiceRuleLoadBalancer},
+			IPs:          []string{"185.0.0.1"},
+			SourceRanges: []string{"185.0.0.0/16", "185.1.0.0/16"},
+		},
+		{
+			Source:       firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "invalid", Rule: ServiceRuleLoadBalancer},
+			IPs:          []string{"185.0.0.1"},
+			SourceRanges: []string{},
+			Invalid:      `annotation firewall.metal-stack.io/source-ranges contains "no-cidr" which is not a valid IP or CIDR, no source is allowed`,
+		},
+		{
+			Source:       firewallv1.RuleSource{Kind: KindGateway, Namespace: "infra", Name: "gw", Rule: "listener-web"},
+			IPs:          []string{"185.0.0.2"},
+			SourceRanges: []string{"10.0.0.0/8"},
+		},
+		{
+			Source:       firewallv1.RuleSource{Kind: KindGateway, Namespace: "infra", Name: "gw", Rule: "listener-api"},
+			IPs:          []string{"185.0.0.2"},
+			SourceRanges: []string{"1.2.3.4"},
+		},
+	}
+
+	got := IngressSourceRestrictions(ingresses, gateways)
+	if !cmp.Equal(got, want) {
+		t.Errorf("IngressSourceRestrictions() diff: %v", cmp.Diff(got, want))
+	}
+}
+
+func TestServiceRulesWithIngressSourceRestrictions(t *testing.T) {
+	svc := corev1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "ingress-nginx",
+			Name:      "controller",
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{
+				{
+					Port:     443,
+					Protocol: corev1.ProtocolTCP,
+				},
+			},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{
+					{IP: "185.0.0.1"},
+					{IP: "185.0.0.2"},
+					{IP: "185.0.0.3"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		restrictions []IngressSourceRestriction
+		want         nftablesRules
+	}{
+		{
+			name: "only fully restricted ips are tightened",
+			restrictions: []IngressSourceRestriction{
+				{
+					Source:       firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "frontend", Rule: ServiceRuleLoadBalancer},
+					IPs:          []string{"185.0.0.1", "185.0.0.2"},
+					SourceRanges: []string{"185.0.0.0/16"},
+				},
+				{
+					Source:       firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "backend", Rule: ServiceRuleLoadBalancer},
+					IPs:          []string{"185.0.0.1"},
+					SourceRanges: []string{"10.0.0.0/8"},
+				},
+				{
+					Source: firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "public", Rule: ServiceRuleLoadBalancer},
+					IPs:    []string{"185.0.0.2"},
+				},
+			},
+			want: nftablesRules{
+				`ip saddr { 185.0.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:ing/shop/frontend//loadbalancer/tcp"`,
+				`ip saddr { 10.0.0.0/8 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:ing/shop/backend//loadbalancer/tcp"`,
+				`ip daddr { 185.0.0.2, 185.0.0.3 } tcp dport { 443 } counter accept comment "k8s:svc/ingress-nginx/controller//loadbalancer/tcp"`,
+			},
+		},
+		{
+			name: "invalid source ranges fail closed",
+			restrictions: []IngressSourceRestriction{
+				{
+					Source:       firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "frontend", Rule: ServiceRuleLoadBalancer},
+					IPs:          []string{"185.0.0.1"},
+					SourceRanges: []string{"185.0.0.0/16"},
+				},
+				{
+					Source:  firewallv1.RuleSource{Kind: KindIngress, Namespace: "shop", Name: "typo", Rule: ServiceRuleLoadBalancer},
+					IPs:     []string{"185.0.0.1", "185.0.0.2"},
+					Invalid: "invalid",
+				},
+			},
+			want: nftablesRules{
+				`ip saddr { 185.0.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:ing/shop/frontend//loadbalancer/tcp"`,
+				`ip daddr { 185.0.0.3 } tcp dport { 443 } counter accept comment "k8s:svc/ingress-nginx/controller//loadbalancer/tcp"`,
+			},
+		},
+		{
+			name: "no restrictions",
+			want: nftablesRules{
+				`ip daddr { 185.0.0.1, 185.0.0.2, 185.0.0.3 } tcp dport { 443 } counter accept comment "k8s:svc/ingress-nginx/controller//loadbalancer/tcp"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serviceRules(svc, nil, tt.restrictions).render()
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("serviceRules() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
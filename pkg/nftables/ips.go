@@ -0,0 +1,31 @@
+package nftables
+
+import "strings"
+
+const (
+	// ipsMark is the bit of the conntrack mark which marks connections for the inline inspection by suricata
+	ipsMark = "0x00000100"
+	// ipsMarkStatement is added to the accept rules of objects which request the inline inspection,
+	// the connection is queued to suricata by the ips chain which follows the forward chain
+	ipsMarkStatement = "ct mark set ct mark or " + ipsMark
+)
+
+// SetIPSQueue enables the inline inspection of the marked connections, they are sent to the given NFQUEUE
+func (f *Firewall) SetIPSQueue(queue uint16) {
+	f.ipsQueue = &queue
+}
+
+// IPSInspected returns whether connections are sent to suricata for inline inspection
+func (f *Firewall) IPSInspected() bool {
+	return f.ipsQueue != nil && f.forwardingRules().inspected()
+}
+
+// inspected returns whether any rule marks connections for the inline inspection
+func (r forwardingRules) inspected() bool {
+	for _, rule := range append(append(nftablesRules{}, r.Ingress...), r.Egress...) {
+		if strings.Contains(rule, ipsMarkStatement) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,14 +2,13 @@ package nftables
 
 import (
 	"fmt"
-	"strings"
 
 	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
 )
 
 // clusterwideNetworkPolicyRules generates nftables rules for a clusterwidenetworkpolicy
-func clusterwideNetworkPolicyRules(np firewallv1.ClusterwideNetworkPolicy) (nftablesRules, nftablesRules) {
-	ingress, egress := nftablesRules{}, nftablesRules{}
+func clusterwideNetworkPolicyRules(np firewallv1.ClusterwideNetworkPolicy) (acceptRules, acceptRules) {
+	ingress, egress := acceptRules{}, acceptRules{}
 	if len(np.Spec.Egress) > 0 {
 		egress = append(egress, clusterwideNetworkPolicyEgressRules(np)...)
 	}
@@ -19,26 +18,19 @@ func clusterwideNetworkPolicyRules(np firewallv1.ClusterwideNetworkPolicy) (nfta
 	return ingress, egress
 }
 
-func clusterwideNetworkPolicyIngressRules(np firewallv1.ClusterwideNetworkPolicy) nftablesRules {
+func clusterwideNetworkPolicyIngressRules(np firewallv1.ClusterwideNetworkPolicy) acceptRules {
 	ingress := np.Spec.Ingress
 	if ingress == nil {
 		return nil
 	}
-	rules := nftablesRules{}
-	for _, i := range ingress {
+	rules := acceptRules{}
+	for n, i := range ingress {
 		allow := []string{}
 		except := []string{}
 		for _, ipBlock := range i.From {
 			allow = append(allow, ipBlock.CIDR)
 			except = append(except, ipBlock.Except...)
 		}
-		common := []string{}
-		if len(except) > 0 {
-			common = append(common, fmt.Sprintf("ip saddr != { %s }", strings.Join(except, ", ")))
-		}
-		if len(allow) > 0 {
-			common = append(common, fmt.Sprintf("ip saddr { %s }", strings.Join(allow, ", ")))
-		}
 		tcpPorts := []string{}
 		udpPorts := []string{}
 		for _, p := range i.Ports {
@@ -49,24 +41,24 @@ func clusterwideNetworkPolicyIngressRules(np firewallv1.ClusterwideNetworkPolicy
 				udpPorts = append(udpPorts, fmt.Sprint(p.Port))
 			}
 		}
-		comment := fmt.Sprintf("accept traffic for k8s network policy %s", np.ObjectMeta.Name)
-		if len(tcpPorts) > 0 {
-			rules = append(rules, assembleDestinationPortRule(common, "tcp", tcpPorts, comment+" tcp"))
-		}
-		if len(udpPorts) > 0 {
-			rules = append(rules, assembleDestinationPortRule(common, "udp", udpPorts, comment+" udp"))
+		rule := acceptRule{
+			source:      policyRuleSource(np, PolicyDirectionIngress, n),
+			saddrExcept: except,
+			saddr:       allow,
+			statements:  policyStatements(np),
 		}
+		rules = append(rules, policyProtocolRules(rule, tcpPorts, udpPorts)...)
 	}
-	return uniqueSorted(rules)
+	return rules.uniqueSorted()
 }
 
-func clusterwideNetworkPolicyEgressRules(np firewallv1.ClusterwideNetworkPolicy) nftablesRules {
+func clusterwideNetworkPolicyEgressRules(np firewallv1.ClusterwideNetworkPolicy) acceptRules {
 	egress := np.Spec.Egress
 	if egress == nil {
 		return nil
 	}
-	rules := nftablesRules{}
-	for _, e := range egress {
+	rules := acceptRules{}
+	for n, e := range egress {
 		tcpPorts := []string{}
 		udpPorts := []string{}
 		for _, p := range e.Ports {
@@ -83,22 +75,50 @@ func clusterwideNetworkPolicyEgressRules(np firewallv1.ClusterwideNetworkPolicy)
 			allow = append(allow, ipBlock.CIDR)
 			except = append(except, ipBlock.Except...)
 		}
-		ruleBase := []string{"ip saddr == @cluster_prefixes"}
-		if len(except) > 0 {
-			ruleBase = append(ruleBase, fmt.Sprintf("ip daddr != { %s }", strings.Join(except, ", ")))
-		}
-		if len(allow) > 0 {
-			if allow[0] != "0.0.0.0/0" {
-				ruleBase = append(ruleBase, fmt.Sprintf("ip daddr { %s }", strings.Join(allow, ", ")))
-			}
-		}
-		comment := fmt.Sprintf("accept traffic for np %s", np.ObjectMeta.Name)
-		if len(tcpPorts) > 0 {
-			rules = append(rules, assembleDestinationPortRule(ruleBase, "tcp", tcpPorts, comment+" tcp"))
+		rule := acceptRule{
+			source:      policyRuleSource(np, PolicyDirectionEgress, n),
+			fromCluster: true,
+			daddrExcept: except,
+			statements:  policyStatements(np),
 		}
-		if len(udpPorts) > 0 {
-			rules = append(rules, assembleDestinationPortRule(ruleBase, "udp", udpPorts, comment+" udp"))
+		if len(allow) > 0 && allow[0] != "0.0.0.0/0" {
+			rule.daddr = allow
 		}
+		rules = append(rules, policyProtocolRules(rule, tcpPorts, udpPorts)...)
+	}
+	return rules.uniqueSorted()
+}
+
+// policyProtocolRules returns a rule per protocol with ports
+func policyProtocolRules(rule acceptRule, tcpPorts, udpPorts []string) acceptRules {
+	rules := acceptRules{}
+	if len(tcpPorts) > 0 {
+		rule.source.Protocol = "tcp"
+		rule.ports = tcpPorts
+		rules = append(rules, rule)
+	}
+	if len(udpPorts) > 0 {
+		rule.source.Protocol = "udp"
+		rule.ports = udpPorts
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// policyStatements returns the statements of the accept rules of a policy
+func policyStatements(np firewallv1.ClusterwideNetworkPolicy) []string {
+	if np.Spec.IPS {
+		return []string{"counter", ipsMarkStatement}
+	}
+	return []string{"counter"}
+}
+
+func policyRuleSource(np firewallv1.ClusterwideNetworkPolicy, direction string, index int) firewallv1.RuleSource {
+	return firewallv1.RuleSource{
+		Kind:      KindClusterwideNetworkPolicy,
+		Namespace: np.Namespace,
+		Name:      np.Name,
+		UID:       string(np.UID),
+		Rule:      PolicyRule(direction, index),
 	}
-	return uniqueSorted(rules)
 }
@@ -76,18 +76,48 @@ func TestClusterwideNetworkPolicyRules(t *testing.T) {
 			},
 			want: want{
 				ingress: nftablesRules{
-					`ip saddr != { 1.1.0.1 } ip saddr { 1.1.0.0/24 } tcp dport { 80 } counter accept comment "accept traffic for k8s network policy  tcp"`,
+					`ip saddr != { 1.1.0.1 } ip saddr { 1.1.0.0/24 } tcp dport { 80 } counter accept comment "k8s:cwnp////ingress-0/tcp"`,
 				},
 				egress: nftablesRules{
-					`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } tcp dport { 53 } counter accept comment "accept traffic for np  tcp"`,
-					`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } udp dport { 53 } counter accept comment "accept traffic for np  udp"`,
+					`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } tcp dport { 53 } counter accept comment "k8s:cwnp////egress-0/tcp"`,
+					`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } udp dport { 53 } counter accept comment "k8s:cwnp////egress-0/udp"`,
 				},
 			},
 		},
+		{
+			name: "policy with inline inspection",
+			input: firewallv1.ClusterwideNetworkPolicy{
+				Spec: firewallv1.PolicySpec{
+					IPS: true,
+					Ingress: []firewallv1.IngressRule{
+						{
+							From: []networking.IPBlock{
+								{
+									CIDR: "1.1.0.0/24",
+								},
+							},
+							Ports: []networking.NetworkPolicyPort{
+								{
+									Protocol: &tcp,
+									Port:     port(80),
+								},
+							},
+						},
+					},
+				},
+			},
+			want: want{
+				ingress: nftablesRules{
+					`ip saddr { 1.1.0.0/24 } tcp dport { 80 } counter ct mark set ct mark or 0x00000100 accept comment "k8s:cwnp////ingress-0/tcp"`,
+				},
+				egress: nftablesRules{},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ingress, egress := clusterwideNetworkPolicyRules(tt.input)
+			i, e := clusterwideNetworkPolicyRules(tt.input)
+			ingress, egress := i.render(), e.render()
 			if !cmp.Equal(ingress, tt.want.ingress) {
 				t.Errorf("clusterwideNetworkPolicyRules() ingress diff: %v", cmp.Diff(ingress, tt.want.ingress))
 			}
@@ -136,14 +166,14 @@ func TestClusterwideNetworkPolicyEgressRules(t *testing.T) {
 				},
 			},
 			want: nftablesRules{
-				`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } tcp dport { 53 } counter accept comment "accept traffic for np  tcp"`,
-				`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } udp dport { 53 } counter accept comment "accept traffic for np  udp"`,
+				`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } tcp dport { 53 } counter accept comment "k8s:cwnp////egress-0/tcp"`,
+				`ip saddr == @cluster_prefixes ip daddr != { 1.1.0.1 } ip daddr { 1.1.0.0/24, 1.1.1.0/24 } udp dport { 53 } counter accept comment "k8s:cwnp////egress-0/udp"`,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := clusterwideNetworkPolicyEgressRules(tt.input)
+			got := clusterwideNetworkPolicyEgressRules(tt.input).render()
 			if !cmp.Equal(got, tt.want) {
 				t.Errorf("clusterwideNetworkPolicyEgressRules() diff: %v", cmp.Diff(got, tt.want))
 			}
@@ -17,6 +17,14 @@ table ip firewall {
 		auto-merge
 		elements = { 10.0.0.0/8 }
 	}
+{{- if .AutoBlock }}
+
+	# sources blocked because of ids alerts, the elements are managed by the controller and expire with their timeout
+	set auto_block {
+		type ipv4_addr
+		flags timeout
+	}
+{{- end }}
 
 	# counters
 	counter internal_in { }
@@ -41,13 +49,18 @@ table ip firewall {
 		{{- range .RateLimitRules }}
 		{{ . }}
 		{{- end }}
+{{- if .AutoBlock }}
+
+		# blocked sources
+		ip saddr @auto_block counter {{ dropLog "blocked" }}drop comment "drop sources blocked because of ids alerts"
+{{- end }}
 
 		# state dependent rules
 		ct state established,related counter accept comment "accept established connections"
-		ct state invalid counter drop comment "drop packets with invalid ct state"
+		ct state invalid counter {{ dropLog "invalid" }}drop comment "drop packets with invalid ct state"
 
 		# icmp
-		ip protocol icmp icmp type echo-request limit rate over 10/second burst 4 packets counter drop comment "drop ping floods"
+		ip protocol icmp icmp type echo-request limit rate over 10/second burst 4 packets counter {{ dropLog "ping-flood" }}drop comment "drop ping floods"
 		ip protocol icmp icmp type { destination-unreachable, router-solicitation, router-advertisement, time-exceeded, parameter-problem } counter accept comment "accept icmp"
 
 		# dynamic ingress rules
@@ -61,8 +74,17 @@ table ip firewall {
 		{{- end }}
 
 		counter comment "count and log dropped packets"
-		limit rate 10/second counter name drop_total log prefix "nftables-firewall-dropped: "
+		counter name drop_total {{ if .DropLog }}{{ dropLog "" }}comment "log all dropped packets to nflog"{{ else }}limit rate 10/second log prefix "nftables-firewall-dropped: "{{ end }}
+	}
+{{- if .IPS }}
+
+	# connections marked by the dynamic rules are inspected inline by suricata after they were accepted,
+	# without suricata listening on the queue the packets bypass the inspection
+	chain ips {
+		type filter hook forward priority 2; policy accept;
+		ct mark and {{ .IPSMark }} == {{ .IPSMark }} counter queue num {{ .IPSQueue }} bypass comment "inspect marked connections with suricata"
 	}
+{{- end }}
 {{- if gt (len .SnatRules) 0 }}
 
 	chain postrouting {
@@ -0,0 +1,108 @@
+package nftables
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PolicyDirectionIngress identifies the ingress rules of a ClusterwideNetworkPolicy
+	PolicyDirectionIngress = "ingress"
+	// PolicyDirectionEgress identifies the egress rules of a ClusterwideNetworkPolicy
+	PolicyDirectionEgress = "egress"
+)
+
+// PolicyRule returns the rule of a RuleSource for the ingress or egress rule with the given index of a ClusterwideNetworkPolicy
+func PolicyRule(direction string, index int) string {
+	return fmt.Sprintf("%s-%d", direction, index)
+}
+
+// parsePolicyRule parses a rule created by PolicyRule
+func parsePolicyRule(rule string) (string, int, bool) {
+	parts := strings.SplitN(rule, "-", 2)
+	if len(parts) != 2 || (parts[0] != PolicyDirectionIngress && parts[0] != PolicyDirectionEgress) {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+	return parts[0], index, true
+}
+
+// ClusterwideNetworkPolicyStatus attributes the rule statistics to the ingress and egress rules of a ClusterwideNetworkPolicy.
+// The counters are accumulated across reloads of the ruleset.
+// The last hit of a rule is set to now if its packet counter changed since the previous status, otherwise it is kept.
+func ClusterwideNetworkPolicyStatus(np firewallv1.ClusterwideNetworkPolicy, stats firewallv1.RuleStatsByAction, now time.Time) firewallv1.PolicyStatus {
+	status := firewallv1.PolicyStatus{
+		Ingress: make([]firewallv1.PolicyRuleStatus, len(np.Spec.Ingress)),
+		Egress:  make([]firewallv1.PolicyRuleStatus, len(np.Spec.Egress)),
+		Updated: metav1.NewTime(now),
+	}
+
+	for _, ruleStats := range stats {
+		for _, stat := range ruleStats {
+			if !isPolicyRule(np, stat.Source) {
+				continue
+			}
+			direction, index, ok := parsePolicyRule(stat.Source.Rule)
+			if !ok {
+				continue
+			}
+			rules := status.Ingress
+			if direction == PolicyDirectionEgress {
+				rules = status.Egress
+			}
+			if index >= len(rules) {
+				continue
+			}
+			rules[index].Counter.Bytes += stat.Cumulative.Bytes
+			rules[index].Counter.Packets += stat.Cumulative.Packets
+		}
+	}
+
+	updateLastHits(status.Ingress, np.Status.Ingress, now)
+	updateLastHits(status.Egress, np.Status.Egress, now)
+	return status
+}
+
+// isPolicyRule checks if a rule was generated for the given policy, the name is compared if the uid is unknown
+func isPolicyRule(np firewallv1.ClusterwideNetworkPolicy, src *firewallv1.RuleSource) bool {
+	if src == nil || src.Kind != KindClusterwideNetworkPolicy {
+		return false
+	}
+	if src.UID != "" && np.UID != "" {
+		return src.UID == string(np.UID)
+	}
+	return src.Name == np.Name
+}
+
+// PolicyStatusChanged checks if the statistics of the rules of a policy changed, the time of the update is ignored
+func PolicyStatusChanged(old, new firewallv1.PolicyStatus) bool {
+	return !equality.Semantic.DeepEqual(old.Ingress, new.Ingress) || !equality.Semantic.DeepEqual(old.Egress, new.Egress)
+}
+
+func updateLastHits(current, previous []firewallv1.PolicyRuleStatus, now time.Time) {
+	for i := range current {
+		var prev firewallv1.PolicyRuleStatus
+		if i < len(previous) {
+			prev = previous[i]
+		}
+		// the counters are cumulative, so any change of a non zero counter is a hit
+		if current[i].Counter.Packets > 0 && current[i].Counter.Packets != prev.Counter.Packets {
+			t := metav1.NewTime(now)
+			current[i].LastHit = &t
+			continue
+		}
+		if prev.LastHit != nil {
+			t := *prev.LastHit
+			current[i].LastHit = &t
+		}
+	}
+}
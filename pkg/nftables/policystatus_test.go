@@ -0,0 +1,84 @@
+package nftables
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterwideNetworkPolicyStatus(t *testing.T) {
+	earlier := v1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)
+	hit := v1.NewTime(now)
+
+	np := firewallv1.ClusterwideNetworkPolicy{
+		ObjectMeta: v1.ObjectMeta{Namespace: "firewall", Name: "allow-dns", UID: "1"},
+		Spec: firewallv1.PolicySpec{
+			Ingress: []firewallv1.IngressRule{{}, {}},
+			Egress:  []firewallv1.EgressRule{{}},
+		},
+		Status: firewallv1.PolicyStatus{
+			Ingress: []firewallv1.PolicyRuleStatus{
+				{Counter: firewallv1.Counter{Bytes: 100, Packets: 1}, LastHit: &earlier},
+				{Counter: firewallv1.Counter{Bytes: 100, Packets: 1}, LastHit: &earlier},
+			},
+		},
+	}
+	stat := func(uid, rule, protocol string, bytes, packets uint64) firewallv1.RuleStat {
+		return firewallv1.RuleStat{
+			// the ruleset was reloaded, only the cumulative counters are published
+			Cumulative: firewallv1.Counter{Bytes: bytes, Packets: packets},
+			Source: &firewallv1.RuleSource{
+				Kind:      KindClusterwideNetworkPolicy,
+				Namespace: "firewall",
+				Name:      "allow-dns",
+				UID:       uid,
+				Rule:      rule,
+				Protocol:  protocol,
+			},
+		}
+	}
+	stats := firewallv1.RuleStatsByAction{
+		"accept": firewallv1.RuleStats{
+			"accept traffic for k8s network policy allow-dns ingress 0 tcp":     stat("1", "ingress-0", "tcp", 100, 1),
+			"accept traffic for k8s network policy allow-dns ingress 1 tcp":     stat("1", "ingress-1", "tcp", 200, 2),
+			"accept traffic for np allow-dns egress 0 tcp":                      stat("1", "egress-0", "tcp", 100, 1),
+			"accept traffic for np allow-dns egress 0 udp":                      stat("1", "egress-0", "udp", 50, 1),
+			"accept traffic for np allow-dns egress 5 tcp":                      stat("1", "egress-5", "tcp", 1000, 10),
+			"accept traffic for np allow-dns egress 0 tcp (firewall/allow-dns)": stat("2", "egress-0", "tcp", 1000, 10),
+			"accept established connections": firewallv1.RuleStat{
+				Counter: firewallv1.Counter{Bytes: 1000, Packets: 10},
+			},
+		},
+	}
+
+	want := firewallv1.PolicyStatus{
+		Ingress: []firewallv1.PolicyRuleStatus{
+			{Counter: firewallv1.Counter{Bytes: 100, Packets: 1}, LastHit: &earlier},
+			{Counter: firewallv1.Counter{Bytes: 200, Packets: 2}, LastHit: &hit},
+		},
+		Egress: []firewallv1.PolicyRuleStatus{
+			{Counter: firewallv1.Counter{Bytes: 150, Packets: 2}, LastHit: &hit},
+		},
+		Updated: v1.NewTime(now),
+	}
+
+	got := ClusterwideNetworkPolicyStatus(np, stats, now)
+	if !cmp.Equal(got, want) {
+		t.Errorf("ClusterwideNetworkPolicyStatus() diff: %v", cmp.Diff(got, want))
+	}
+
+	// an unchanged status is not written again
+	np.Status = got
+	again := ClusterwideNetworkPolicyStatus(np, stats, now.Add(time.Minute))
+	if PolicyStatusChanged(np.Status, again) {
+		t.Errorf("expected an unchanged status, got %v", again)
+	}
+	stats["accept"]["accept traffic for np allow-dns egress 0 udp"] = stat("1", "egress-0", "udp", 60, 2)
+	if !PolicyStatusChanged(np.Status, ClusterwideNetworkPolicyStatus(np, stats, now.Add(time.Minute))) {
+		t.Errorf("expected a changed status")
+	}
+}
@@ -17,7 +17,7 @@ func rateLimitRules(f *Firewall) nftablesRules {
 		if n.Networktype == nil || *n.Networktype == mn.Underlay {
 			continue
 		}
-		rules = append(rules, fmt.Sprintf(`meta iifname "%s" limit rate over %d mbytes/second counter name drop_ratelimit drop`, fmt.Sprintf("vrf%d", *n.Vrf), l.Rate))
+		rules = append(rules, fmt.Sprintf(`meta iifname "%s" limit rate over %d mbytes/second counter name drop_ratelimit %sdrop`, fmt.Sprintf("vrf%d", *n.Vrf), l.Rate, dropLog(f.dropLogGroup, "ratelimit")))
 	}
 	return uniqueSorted(rules)
 }
@@ -17,10 +17,12 @@ func TestRateLimitRules(t *testing.T) {
 	vrf3 := int64(3)
 	privatePrimary := mn.PrivatePrimaryShared
 	external := mn.External
+	group := uint16(100)
 	tests := []struct {
-		name  string
-		input firewallv1.FirewallSpec
-		want  nftablesRules
+		name         string
+		input        firewallv1.FirewallSpec
+		dropLogGroup *uint16
+		want         nftablesRules
 	}{
 		{
 			name: "rate limit for multiple networks",
@@ -72,10 +74,39 @@ func TestRateLimitRules(t *testing.T) {
 				`meta iifname "vrf3" limit rate over 20 mbytes/second counter name drop_ratelimit drop`,
 			},
 		},
+		{
+			name: "rate limit with dropped packets logged to nflog",
+			input: firewallv1.FirewallSpec{
+				Data: firewallv1.Data{
+					FirewallNetworks: []firewallv1.FirewallNetwork{
+						{
+							Networkid:   &internet,
+							Prefixes:    []string{"185.0.0.0/24"},
+							Ips:         []string{"185.0.0.1"},
+							Vrf:         &vrf2,
+							Networktype: &external,
+						},
+					},
+					RateLimits: []firewallv1.RateLimit{
+						{
+							NetworkID: "internet",
+							Rate:      uint32(10),
+						},
+					},
+				},
+			},
+			dropLogGroup: &group,
+			want: nftablesRules{
+				`meta iifname "vrf2" limit rate over 10 mbytes/second counter name drop_ratelimit log group 100 queue-threshold 20 prefix "nftables-firewall-dropped-ratelimit: " drop`,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			f := NewFirewall(nil, nil, tt.input, nil)
+			f := NewFirewall(nil, nil, nil, nil, tt.input, nil)
+			if tt.dropLogGroup != nil {
+				f.SetDropLogGroup(*tt.dropLogGroup)
+			}
 			got := rateLimitRules(f)
 			if !cmp.Equal(got, tt.want) {
 				t.Errorf("rateLimitRules() diff: %v", cmp.Diff(got, tt.want))
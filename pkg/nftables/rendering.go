@@ -8,6 +8,14 @@ import (
 	"text/template"
 )
 
+const (
+	// dropLogPrefix is the log prefix of the dropped packets, the rules which drop packets append their name
+	dropLogPrefix = "nftables-firewall-dropped"
+	// dropLogQueueThreshold is the number of dropped packets the kernel batches into one NFLOG message,
+	// the dropped packets are not limited when they are logged to NFLOG
+	dropLogQueueThreshold = 20
+)
+
 // firewallRenderingData holds the data available in the nftables template
 type firewallRenderingData struct {
 	ForwardingRules  forwardingRules
@@ -15,10 +23,53 @@ type firewallRenderingData struct {
 	SnatRules        nftablesRules
 	InternalPrefixes string
 	PrivateVrfID     uint
+	IPS              bool
+	IPSQueue         uint16
+	IPSMark          string
+	AutoBlock        bool
+	DropLog          bool
+	DropLogGroup     uint16
 }
 
 func newFirewallRenderingData(f *Firewall) (*firewallRenderingData, error) {
-	ingress, egress := nftablesRules{}, nftablesRules{}
+	snatRules, err := snatRules(f)
+	if err != nil {
+		return &firewallRenderingData{}, err
+	}
+
+	rules := f.forwardingRules()
+	d := &firewallRenderingData{
+		PrivateVrfID:     uint(*f.primaryPrivateNet.Vrf),
+		InternalPrefixes: strings.Join(f.spec.InternalPrefixes, ", "),
+		ForwardingRules:  rules,
+		RateLimitRules:   rateLimitRules(f),
+		SnatRules:        snatRules,
+		IPSMark:          ipsMark,
+		AutoBlock:        f.spec.AutoBlock != nil,
+	}
+	if f.dropLogGroup != nil {
+		d.DropLog = true
+		d.DropLogGroup = *f.dropLogGroup
+	}
+	if f.ipsQueue != nil && rules.inspected() {
+		d.IPS = true
+		d.IPSQueue = *f.ipsQueue
+	}
+	return d, nil
+}
+
+// forwardingRules generates the rules of the forward chain for the cluster wide network policies and services
+func (f *Firewall) forwardingRules() forwardingRules {
+	ingress, egress := f.acceptRules()
+	return forwardingRules{
+		Ingress: ingress.render(),
+		Egress:  egress.render(),
+	}
+}
+
+// acceptRules generates the accept rules of the forward chain in the order they are evaluated by nftables
+func (f *Firewall) acceptRules() (acceptRules, acceptRules) {
+	ingress, egress := acceptRules{}, acceptRules{}
 	for _, np := range f.clusterwideNetworkPolicies.Items {
 		err := np.Spec.Validate()
 		if err != nil {
@@ -29,25 +80,12 @@ func newFirewallRenderingData(f *Firewall) (*firewallRenderingData, error) {
 		egress = append(egress, e...)
 	}
 
+	nodeIPs := nodeIPs(f.nodes)
 	for _, svc := range f.services.Items {
-		ingress = append(ingress, serviceRules(svc)...)
-	}
-
-	snatRules, err := snatRules(f)
-	if err != nil {
-		return &firewallRenderingData{}, err
+		ingress = append(ingress, serviceRules(svc, nodeIPs, f.ingressRestrictions)...)
 	}
 
-	return &firewallRenderingData{
-		PrivateVrfID:     uint(*f.primaryPrivateNet.Vrf),
-		InternalPrefixes: strings.Join(f.spec.InternalPrefixes, ", "),
-		ForwardingRules: forwardingRules{
-			Ingress: ingress,
-			Egress:  egress,
-		},
-		RateLimitRules: rateLimitRules(f),
-		SnatRules:      snatRules,
-	}, nil
+	return ingress, egress
 }
 
 func (d *firewallRenderingData) write(file string) error {
@@ -70,7 +108,14 @@ func (d *firewallRenderingData) renderString() (string, error) {
 		return "", err
 	}
 
-	tpl := template.Must(template.New("v4").Parse(tplString))
+	tpl := template.Must(template.New("v4").Funcs(template.FuncMap{
+		"dropLog": func(rule string) string {
+			if !d.DropLog {
+				return ""
+			}
+			return dropLog(&d.DropLogGroup, rule)
+		},
+	}).Parse(tplString))
 
 	err = tpl.Execute(&b, d)
 	if err != nil {
@@ -80,6 +125,19 @@ func (d *firewallRenderingData) renderString() (string, error) {
 	return b.String(), nil
 }
 
+// dropLog returns the log statement of a rule which drops packets, if the dropped packets are logged to the given NFLOG group.
+// The prefix tells which rule dropped a packet, the packets dropped by the policy of the forward chain are logged with dropLogPrefix.
+func dropLog(group *uint16, rule string) string {
+	if group == nil {
+		return ""
+	}
+	prefix := dropLogPrefix
+	if rule != "" {
+		prefix += "-" + rule
+	}
+	return fmt.Sprintf(`log group %d queue-threshold %d prefix "%s: " `, *group, dropLogQueueThreshold, prefix)
+}
+
 func (d *firewallRenderingData) readTpl() (string, error) {
 	r, err := templates.Open("nftables.tpl")
 	if err != nil {
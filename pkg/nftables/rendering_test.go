@@ -42,6 +42,54 @@ func TestFirewallRenderingData_renderString(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ips",
+			data: &firewallRenderingData{
+				ForwardingRules: forwardingRules{
+					Egress:  []string{},
+					Ingress: []string{`ip daddr { 185.0.0.2 } tcp dport { 443 } counter ct mark set ct mark or 0x00000100 accept`},
+				},
+				InternalPrefixes: "1.2.3.4",
+				RateLimitRules:   []string{},
+				SnatRules:        []string{},
+				PrivateVrfID:     uint(42),
+				IPS:              true,
+				IPSQueue:         3,
+				IPSMark:          ipsMark,
+			},
+			wantErr: false,
+		},
+		{
+			name: "auto-block",
+			data: &firewallRenderingData{
+				ForwardingRules: forwardingRules{
+					Egress:  []string{},
+					Ingress: []string{},
+				},
+				InternalPrefixes: "1.2.3.4",
+				RateLimitRules:   []string{},
+				SnatRules:        []string{},
+				PrivateVrfID:     uint(42),
+				AutoBlock:        true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "drop-log",
+			data: &firewallRenderingData{
+				ForwardingRules: forwardingRules{
+					Egress:  []string{},
+					Ingress: []string{},
+				},
+				InternalPrefixes: "1.2.3.4",
+				RateLimitRules:   []string{},
+				SnatRules:        []string{},
+				PrivateVrfID:     uint(42),
+				DropLog:          true,
+				DropLogGroup:     100,
+			},
+			wantErr: false,
+		},
 		{
 			name: "validated",
 			data: &firewallRenderingData{
@@ -0,0 +1,159 @@
+package nftables
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+const (
+	// ruleSourcePrefix marks a rule comment which starts with a rule source identifier
+	ruleSourcePrefix = "k8s:"
+	// maxRuleCommentLength is the maximum length of a comment nftables accepts
+	maxRuleCommentLength = 128
+)
+
+// Kinds of the kubernetes objects rules are generated for
+const (
+	KindClusterwideNetworkPolicy = "ClusterwideNetworkPolicy"
+	KindService                  = "Service"
+	KindIngress                  = "Ingress"
+	KindGateway                  = "Gateway"
+)
+
+// Rules generated for a service
+const (
+	ServiceRuleLoadBalancer = "loadbalancer"
+	ServiceRuleNodePort     = "nodeport"
+	ServiceRuleExternalIPs  = "externalips"
+)
+
+// ruleSourceKinds are the short names of the kinds used in the rule comments to save space
+var ruleSourceKinds = map[string]string{
+	KindClusterwideNetworkPolicy: "cwnp",
+	KindService:                  "svc",
+	KindIngress:                  "ing",
+	KindGateway:                  "gw",
+}
+
+// ruleComment returns the comment of a rule generated for a kubernetes object, which is stored in the rule's userdata.
+// It starts with an identifier of the form "k8s:<kind>/<namespace>/<name>/<uid>/<rule>/<protocol>" followed by an optional custom comment.
+// Namespace and name are left out if the identifier would not fit into the comment, the custom comment is truncated.
+func ruleComment(src firewallv1.RuleSource, custom string) string {
+	id := ruleSourceID(src)
+	if len(id) > maxRuleCommentLength {
+		src.Namespace, src.Name = "", ""
+		id = ruleSourceID(src)
+	}
+	if len(id) > maxRuleCommentLength {
+		// the rule is too long to be identified, but the ruleset must still be valid
+		id = id[:maxRuleCommentLength]
+	}
+	if custom == "" {
+		return id
+	}
+
+	custom = id + " " + custom
+	if len(custom) <= maxRuleCommentLength {
+		return custom
+	}
+	custom = custom[:maxRuleCommentLength]
+	for !utf8.ValidString(custom) {
+		custom = custom[:len(custom)-1]
+	}
+	return strings.TrimSpace(custom)
+}
+
+func ruleSourceID(src firewallv1.RuleSource) string {
+	return fmt.Sprintf("%s%s/%s/%s/%s/%s/%s", ruleSourcePrefix, ruleSourceKinds[src.Kind], src.Namespace, src.Name, src.UID, src.Rule, src.Protocol)
+}
+
+// ParseRuleComment parses the comment of a rule. For rules generated for kubernetes objects it returns
+// a human readable description and the rule source, for all other rules the comment is returned unchanged.
+func ParseRuleComment(comment string) (string, *firewallv1.RuleSource) {
+	if !strings.HasPrefix(comment, ruleSourcePrefix) {
+		return comment, nil
+	}
+
+	id, custom := comment, ""
+	if i := strings.Index(comment, " "); i >= 0 {
+		id, custom = comment[:i], comment[i+1:]
+	}
+	fields := strings.Split(strings.TrimPrefix(id, ruleSourcePrefix), "/")
+	if len(fields) != 6 {
+		return comment, nil
+	}
+
+	src := &firewallv1.RuleSource{
+		Namespace: fields[1],
+		Name:      fields[2],
+		UID:       fields[3],
+		Rule:      fields[4],
+		Protocol:  fields[5],
+	}
+	for kind, short := range ruleSourceKinds {
+		if short == fields[0] {
+			src.Kind = kind
+		}
+	}
+	if src.Kind == "" {
+		return comment, nil
+	}
+
+	return RuleDescription(*src, custom), src
+}
+
+// RuleDescription returns the human readable description of a rule which is used as key of the rule statistics,
+// a custom comment replaces the description of the object.
+func RuleDescription(src firewallv1.RuleSource, custom string) string {
+	object := src.Name
+	// cluster wide network policies always reside in the same namespace
+	if src.Namespace != "" && src.Kind != KindClusterwideNetworkPolicy {
+		object = src.Namespace + "/" + src.Name
+	}
+	if src.Name == "" {
+		object = src.UID
+	}
+
+	var description, rule string
+	switch src.Kind {
+	case KindClusterwideNetworkPolicy:
+		description = "accept traffic for k8s network policy " + object
+		if strings.HasPrefix(src.Rule, PolicyDirectionEgress) {
+			description = "accept traffic for np " + object
+		}
+		rule = strings.Replace(src.Rule, "-", " ", 1)
+	case KindService:
+		description = "accept traffic for k8s service " + object
+		switch {
+		case src.Rule == ServiceRuleNodePort:
+			rule = "nodeport"
+		case src.Rule == ServiceRuleExternalIPs:
+			rule = "external ips"
+		case strings.HasPrefix(src.Rule, ServiceRuleLoadBalancer+"-"):
+			rule = "port " + strings.TrimPrefix(src.Rule, ServiceRuleLoadBalancer+"-")
+		}
+	case KindIngress:
+		description = "accept traffic for k8s ingress " + object
+	case KindGateway:
+		description = "accept traffic for k8s gateway " + object
+		rule = strings.Replace(src.Rule, "-", " ", 1)
+	default:
+		description = "accept traffic for k8s " + object
+		rule = src.Rule
+	}
+	if custom != "" {
+		description = custom
+	}
+
+	parts := []string{description}
+	if rule != "" {
+		parts = append(parts, rule)
+	}
+	if src.Protocol != "" {
+		parts = append(parts, src.Protocol)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,124 @@
+package nftables
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestRuleComment(t *testing.T) {
+	uid := "0a8a3c9e-65e4-4d7c-9a3f-3d4e4f6b8c21"
+	tests := []struct {
+		name        string
+		source      firewallv1.RuleSource
+		custom      string
+		want        string
+		description string
+		parsed      *firewallv1.RuleSource
+	}{
+		{
+			name: "network policy",
+			source: firewallv1.RuleSource{
+				Kind:      KindClusterwideNetworkPolicy,
+				Namespace: "firewall",
+				Name:      "allow-dns",
+				UID:       uid,
+				Rule:      PolicyRule(PolicyDirectionEgress, 1),
+				Protocol:  "udp",
+			},
+			want:        "k8s:cwnp/firewall/allow-dns/" + uid + "/egress-1/udp",
+			description: "accept traffic for np allow-dns egress 1 udp",
+		},
+		{
+			name: "service with custom comment",
+			source: firewallv1.RuleSource{
+				Kind:      KindService,
+				Namespace: "shop",
+				Name:      "web",
+				UID:       uid,
+				Rule:      ServiceRuleNodePort,
+				Protocol:  "tcp",
+			},
+			custom:      "web shop",
+			want:        "k8s:svc/shop/web/" + uid + "/nodeport/tcp web shop",
+			description: "web shop nodeport tcp",
+		},
+		{
+			name: "gateway listener",
+			source: firewallv1.RuleSource{
+				Kind:      KindGateway,
+				Namespace: "infra",
+				Name:      "gw",
+				Rule:      "listener-web",
+				Protocol:  "tcp",
+			},
+			want:        "k8s:gw/infra/gw//listener-web/tcp",
+			description: "accept traffic for k8s gateway infra/gw listener web tcp",
+		},
+		{
+			name: "custom comment is truncated",
+			source: firewallv1.RuleSource{
+				Kind:      KindService,
+				Namespace: "shop",
+				Name:      "web",
+				UID:       uid,
+				Rule:      ServiceRuleLoadBalancer,
+				Protocol:  "tcp",
+			},
+			custom:      strings.Repeat("a", 100),
+			want:        "k8s:svc/shop/web/" + uid + "/loadbalancer/tcp " + strings.Repeat("a", 57),
+			description: strings.Repeat("a", 57) + " tcp",
+		},
+		{
+			name: "namespace and name are left out if the identifier is too long",
+			source: firewallv1.RuleSource{
+				Kind:      KindClusterwideNetworkPolicy,
+				Namespace: "firewall",
+				Name:      strings.Repeat("a", 100),
+				UID:       uid,
+				Rule:      PolicyRule(PolicyDirectionIngress, 0),
+				Protocol:  "tcp",
+			},
+			want:        "k8s:cwnp///" + uid + "/ingress-0/tcp",
+			description: "accept traffic for k8s network policy " + uid + " ingress 0 tcp",
+			parsed: &firewallv1.RuleSource{
+				Kind:     KindClusterwideNetworkPolicy,
+				UID:      uid,
+				Rule:     PolicyRule(PolicyDirectionIngress, 0),
+				Protocol: "tcp",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ruleComment(tt.source, tt.custom)
+			if got != tt.want {
+				t.Errorf("ruleComment() = %v, want %v", got, tt.want)
+			}
+			if len(got) > maxRuleCommentLength {
+				t.Errorf("ruleComment() is longer than %d characters", maxRuleCommentLength)
+			}
+
+			description, source := ParseRuleComment(got)
+			if description != tt.description {
+				t.Errorf("ParseRuleComment() description = %v, want %v", description, tt.description)
+			}
+			parsed := tt.parsed
+			if parsed == nil {
+				parsed = &tt.source
+			}
+			if !cmp.Equal(source, parsed) {
+				t.Errorf("ParseRuleComment() source diff: %v", cmp.Diff(source, parsed))
+			}
+		})
+	}
+}
+
+func TestParseRuleCommentOfStaticRule(t *testing.T) {
+	description, source := ParseRuleComment("accept established connections")
+	if description != "accept established connections" || source != nil {
+		t.Errorf("ParseRuleComment() = %v, %v, want the unchanged comment without source", description, source)
+	}
+}
@@ -3,14 +3,14 @@ package nftables
 import (
 	"fmt"
 	"net"
-	"strings"
 
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 func isCIDR(cidr string) bool {
 	_, _, err := net.ParseCIDR(cidr)
-	return err != nil
+	return err == nil
 }
 
 func isIP(ip string) bool {
@@ -18,22 +18,42 @@ func isIP(ip string) bool {
 	return i != nil
 }
 
-// serviceRules generates nftables rules base on a k8s service definition
-func serviceRules(svc corev1.Service) nftablesRules {
-	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer && svc.Spec.Type != corev1.ServiceTypeNodePort {
+// serviceRules generates nftables rules base on a k8s service definition.
+// The rules grant exactly the exposure kubernetes grants the service:
+// - the load balancer ingress on the service ports, restricted by loadBalancerSourceRanges
+// - the node ips on the node ports for services of type NodePort and LoadBalancer
+// - the external ips on the service ports for every service type
+// The firewall annotations of the service are honoured, invalid annotations are ignored.
+// Load balancer ips of ingress controllers which are open to the world are tightened by the given ingress source restrictions.
+func serviceRules(svc corev1.Service, nodeIPs []string, restrictions []IngressSourceRestriction) acceptRules {
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
 		return nil
 	}
 
-	from := []string{}
-	for _, lbsr := range svc.Spec.LoadBalancerSourceRanges {
-		if !isCIDR(lbsr) && !isIP(lbsr) {
-			continue
-		}
+	a, _ := parseServiceAnnotations(svc)
+	if a.disabled {
+		return nil
+	}
+
+	src := firewallv1.RuleSource{
+		Kind:      KindService,
+		Namespace: svc.ObjectMeta.Namespace,
+		Name:      svc.ObjectMeta.Name,
+		UID:       string(svc.ObjectMeta.UID),
 	}
+	rules := acceptRules{}
 
-	from = append(from, svc.Spec.LoadBalancerSourceRanges...)
-	to := []string{}
 	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		// kubernetes only applies loadBalancerSourceRanges to traffic for the load balancer ingress
+		from := []string{}
+		for _, lbsr := range svc.Spec.LoadBalancerSourceRanges {
+			if !isCIDR(lbsr) && !isIP(lbsr) {
+				continue
+			}
+			from = append(from, lbsr)
+		}
+
+		to := []string{}
 		if svc.Spec.LoadBalancerIP != "" {
 			if isIP(svc.Spec.LoadBalancerIP) {
 				to = append(to, svc.Spec.LoadBalancerIP)
@@ -44,39 +64,126 @@ func serviceRules(svc corev1.Service) nftablesRules {
 				to = append(to, e.IP)
 			}
 		}
+
+		to = uniqueSorted(to)
+
+		if len(from) == 0 && len(restrictions) > 0 {
+			tcpPorts, udpPorts := servicePorts(svc.Spec.Ports, false)
+			var restrictedRules acceptRules
+			to, restrictedRules = ingressRules(to, tcpPorts, udpPorts, restrictions, a)
+			rules = append(rules, restrictedRules...)
+		}
+
+		// ports with extra source ranges get rules on their own, without source ranges any source is allowed anyways
+		ports := []corev1.ServicePort{}
+		extraRules := acceptRules{}
+		for _, p := range svc.Spec.Ports {
+			extra := a.extraSourceRanges(p)
+			if len(from) == 0 || len(extra) == 0 {
+				ports = append(ports, p)
+				continue
+			}
+			extendedFrom := uniqueSorted(append(append([]string{}, from...), extra...))
+			tcpPorts, udpPorts := servicePorts([]corev1.ServicePort{p}, false)
+			src.Rule = fmt.Sprintf("%s-%d", ServiceRuleLoadBalancer, p.Port)
+			extraRules = append(extraRules, assembleServiceRules(extendedFrom, to, tcpPorts, udpPorts, a, src)...)
+		}
+
+		tcpPorts, udpPorts := servicePorts(ports, false)
+		src.Rule = ServiceRuleLoadBalancer
+		rules = append(rules, assembleServiceRules(from, to, tcpPorts, udpPorts, a, src)...)
+		rules = append(rules, extraRules...)
 	}
 
-	// avoid empty rules
-	if len(from) == 0 && len(to) == 0 {
-		return nil
+	if svc.Spec.Type == corev1.ServiceTypeNodePort || svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		tcpPorts, udpPorts := servicePorts(svc.Spec.Ports, true)
+		src.Rule = ServiceRuleNodePort
+		rules = append(rules, assembleServiceRules(nil, nodeIPs, tcpPorts, udpPorts, a, src)...)
 	}
 
-	ruleBase := []string{}
-	if len(from) > 0 {
-		ruleBase = append(ruleBase, fmt.Sprintf("ip saddr { %s }", strings.Join(from, ", ")))
+	externalIPs := []string{}
+	for _, ip := range svc.Spec.ExternalIPs {
+		if isIP(ip) {
+			externalIPs = append(externalIPs, ip)
+		}
 	}
+	tcpPorts, udpPorts := servicePorts(svc.Spec.Ports, false)
+	src.Rule = ServiceRuleExternalIPs
+	rules = append(rules, assembleServiceRules(nil, uniqueSorted(externalIPs), tcpPorts, udpPorts, a, src)...)
 
-	if len(to) > 0 {
-		ruleBase = append(ruleBase, fmt.Sprintf("ip daddr { %s }", strings.Join(to, ", ")))
+	if len(rules) == 0 {
+		return nil
 	}
+	return rules
+}
 
+// servicePorts returns the tcp and udp ports of a service, either the service ports or the allocated node ports
+func servicePorts(ports []corev1.ServicePort, nodePorts bool) ([]string, []string) {
 	tcpPorts := []string{}
 	udpPorts := []string{}
-	for _, p := range svc.Spec.Ports {
+	for _, p := range ports {
+		port := p.Port
+		if nodePorts {
+			port = p.NodePort
+		}
+		if port == 0 {
+			continue
+		}
 		proto := proto(&p.Protocol)
 		if proto == "tcp" {
-			tcpPorts = append(tcpPorts, fmt.Sprint(p.Port))
+			tcpPorts = append(tcpPorts, fmt.Sprint(port))
 		} else if proto == "udp" {
-			udpPorts = append(udpPorts, fmt.Sprint(p.Port))
+			udpPorts = append(udpPorts, fmt.Sprint(port))
 		}
 	}
-	comment := fmt.Sprintf("accept traffic for k8s service %s/%s", svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
-	rules := nftablesRules{}
+	return tcpPorts, udpPorts
+}
+
+// assembleServiceRules generates the accept rules for the given destinations, rules without any destination are never generated.
+// The rules are identified by the given source completed by the protocol.
+func assembleServiceRules(from, to, tcpPorts, udpPorts []string, a serviceAnnotations, src firewallv1.RuleSource) acceptRules {
+	if len(to) == 0 {
+		return nil
+	}
+
+	rule := acceptRule{
+		source:     src,
+		saddr:      from,
+		daddr:      to,
+		statements: a.statements(),
+		comment:    a.comment,
+	}
+	rules := acceptRules{}
 	if len(tcpPorts) > 0 {
-		rules = append(rules, assembleDestinationPortRule(ruleBase, "tcp", tcpPorts, comment))
+		rule.source.Protocol = "tcp"
+		rule.ports = tcpPorts
+		rules = append(rules, rule)
 	}
 	if len(udpPorts) > 0 {
-		rules = append(rules, assembleDestinationPortRule(ruleBase, "udp", udpPorts, comment))
+		rule.source.Protocol = "udp"
+		rule.ports = udpPorts
+		rules = append(rules, rule)
 	}
 	return rules
 }
+
+// nodeIPs returns the ipv4 addresses of all nodes, which are reachable for node ports
+func nodeIPs(nodes *corev1.NodeList) []string {
+	if nodes == nil {
+		return nil
+	}
+	ips := []string{}
+	for _, n := range nodes.Items {
+		for _, a := range n.Status.Addresses {
+			if a.Type != corev1.NodeInternalIP && a.Type != corev1.NodeExternalIP {
+				continue
+			}
+			ip := net.ParseIP(a.Address)
+			if ip == nil || ip.To4() == nil {
+				continue
+			}
+			ips = append(ips, ip.String())
+		}
+	}
+	return uniqueSorted(ips)
+}
@@ -10,9 +10,10 @@ import (
 
 func TestServiceRules(t *testing.T) {
 	tests := []struct {
-		name  string
-		input corev1.Service
-		want  nftablesRules
+		name    string
+		input   corev1.Service
+		nodeIPs []string
+		want    nftablesRules
 	}{
 		{
 			name: "standard service type loadbalancer with restricted source IP range",
@@ -43,11 +44,192 @@ func TestServiceRules(t *testing.T) {
 				},
 			},
 			want: nftablesRules{
-				`ip saddr { 185.0.0.0/16, 185.1.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "accept traffic for k8s service test/svc"`,
+				`ip saddr { 185.0.0.0/16, 185.1.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:svc/test/svc//loadbalancer/tcp"`,
 			},
 		},
 		{
-			name: "service type nodeport is a noop",
+			name: "service type loadbalancer without ingress ip is a noop",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					LoadBalancerSourceRanges: []string{"185.0.0.0/16"},
+				},
+			},
+			want: nil,
+		},
+		{
+			name: "service type loadbalancer with invalid source range, node ports and external ips",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							NodePort:   31443,
+							Protocol:   corev1.ProtocolTCP,
+						},
+						{
+							Port:       53,
+							TargetPort: *port(53),
+							NodePort:   31053,
+							Protocol:   corev1.ProtocolUDP,
+						},
+					},
+					ExternalIPs:              []string{"185.0.0.2", "no-ip"},
+					LoadBalancerIP:           "185.0.0.1",
+					LoadBalancerSourceRanges: []string{"185.0.0.0/16", "no-cidr"},
+				},
+			},
+			nodeIPs: []string{"10.0.0.1", "10.0.0.2"},
+			want: nftablesRules{
+				`ip saddr { 185.0.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:svc/test/svc//loadbalancer/tcp"`,
+				`ip saddr { 185.0.0.0/16 } ip daddr { 185.0.0.1 } udp dport { 53 } counter accept comment "k8s:svc/test/svc//loadbalancer/udp"`,
+				`ip daddr { 10.0.0.1, 10.0.0.2 } tcp dport { 31443 } counter accept comment "k8s:svc/test/svc//nodeport/tcp"`,
+				`ip daddr { 10.0.0.1, 10.0.0.2 } udp dport { 31053 } counter accept comment "k8s:svc/test/svc//nodeport/udp"`,
+				`ip daddr { 185.0.0.2 } tcp dport { 443 } counter accept comment "k8s:svc/test/svc//externalips/tcp"`,
+				`ip daddr { 185.0.0.2 } udp dport { 53 } counter accept comment "k8s:svc/test/svc//externalips/udp"`,
+			},
+		},
+		{
+			name: "service with annotations",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+					Annotations: map[string]string{
+						AnnotationComment:                    "accept traffic for the web shop",
+						AnnotationLog:                        "true",
+						AnnotationRateLimit:                  "100/second",
+						AnnotationSourceRangesPrefix + "ssh": "10.0.0.0/8",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "https",
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+						{
+							Name:       "ssh",
+							Port:       22,
+							TargetPort: *port(22),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					LoadBalancerSourceRanges: []string{"185.0.0.0/16"},
+				},
+				Status: corev1.ServiceStatus{
+					LoadBalancer: corev1.LoadBalancerStatus{
+						Ingress: []corev1.LoadBalancerIngress{
+							{
+								IP: "185.0.0.1",
+							},
+						},
+					},
+				},
+			},
+			want: nftablesRules{
+				`ip saddr { 185.0.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 443 } limit rate 100/second counter log prefix "nftables-firewall-accepted: " accept comment "k8s:svc/test/svc//loadbalancer/tcp accept traffic for the web shop"`,
+				`ip saddr { 10.0.0.0/8, 185.0.0.0/16 } ip daddr { 185.0.0.1 } tcp dport { 22 } limit rate 100/second counter log prefix "nftables-firewall-accepted: " accept comment "k8s:svc/test/svc//loadbalancer-22/tcp accept traffic for the web shop"`,
+			},
+		},
+		{
+			name: "service with invalid annotations",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+					Annotations: map[string]string{
+						AnnotationComment:   `"`,
+						AnnotationRateLimit: "fast",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					LoadBalancerIP: "185.0.0.1",
+				},
+			},
+			want: nftablesRules{
+				`ip daddr { 185.0.0.1 } tcp dport { 443 } counter accept comment "k8s:svc/test/svc//loadbalancer/tcp"`,
+			},
+		},
+		{
+			name: "service opted out of rules",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+					Annotations: map[string]string{
+						AnnotationDisabled: "true",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					LoadBalancerIP: "185.0.0.1",
+				},
+			},
+			want: nil,
+		},
+		{
+			name: "service type nodeport is allowed to the node ips",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeNodePort,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							NodePort:   31443,
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					LoadBalancerSourceRanges: []string{"185.0.0.0/16"},
+				},
+			},
+			nodeIPs: []string{"10.0.0.1"},
+			want: nftablesRules{
+				`ip daddr { 10.0.0.1 } tcp dport { 31443 } counter accept comment "k8s:svc/test/svc//nodeport/tcp"`,
+			},
+		},
+		{
+			name: "service type nodeport without nodes is a noop",
 			input: corev1.Service{
 				Spec: corev1.ServiceSpec{
 					Type: corev1.ServiceTypeNodePort,
@@ -55,6 +237,7 @@ func TestServiceRules(t *testing.T) {
 						{
 							Port:       443,
 							TargetPort: *port(30443),
+							NodePort:   31443,
 							Protocol:   corev1.ProtocolTCP,
 						},
 					},
@@ -76,15 +259,167 @@ func TestServiceRules(t *testing.T) {
 					},
 				},
 			},
-			want: nil,
+			nodeIPs: []string{"10.0.0.1"},
+			want:    nil,
+		},
+		{
+			name: "service type clusterip with external ips",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					ExternalIPs: []string{"185.0.0.3", "185.0.0.2"},
+				},
+			},
+			nodeIPs: []string{"10.0.0.1"},
+			want: nftablesRules{
+				`ip daddr { 185.0.0.2, 185.0.0.3 } tcp dport { 443 } counter accept comment "k8s:svc/test/svc//externalips/tcp"`,
+			},
+		},
+		{
+			name: "service with inline inspection",
+			input: corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "test",
+					Name:      "svc",
+					Annotations: map[string]string{
+						AnnotationIPS: "true",
+						AnnotationLog: "true",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       443,
+							TargetPort: *port(30443),
+							Protocol:   corev1.ProtocolTCP,
+						},
+					},
+					ExternalIPs: []string{"185.0.0.2"},
+				},
+			},
+			want: nftablesRules{
+				`ip daddr { 185.0.0.2 } tcp dport { 443 } counter ct mark set ct mark or 0x00000100 log prefix "nftables-firewall-accepted: " accept comment "k8s:svc/test/svc//externalips/tcp"`,
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := serviceRules(tt.input)
+			got := serviceRules(tt.input, tt.nodeIPs, nil).render()
 			if !cmp.Equal(got, tt.want) {
 				t.Errorf("serviceRules() diff: %v", cmp.Diff(got, tt.want))
 			}
 		})
 	}
 }
+
+func TestNodeIPs(t *testing.T) {
+	nodes := &corev1.NodeList{
+		Items: []corev1.Node{
+			{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{Type: corev1.NodeHostName, Address: "shoot--test-worker-1"},
+						{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+						{Type: corev1.NodeInternalIP, Address: "2001:db8::1"},
+					},
+				},
+			},
+			{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+						{Type: corev1.NodeExternalIP, Address: "10.0.0.2"},
+					},
+				},
+			},
+		},
+	}
+
+	got := nodeIPs(nodes)
+	want := []string{"10.0.0.1", "10.0.0.2"}
+	if !cmp.Equal(got, want) {
+		t.Errorf("nodeIPs() diff: %v", cmp.Diff(got, want))
+	}
+}
+
+func TestValidateServiceAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				AnnotationDisabled:                   "false",
+				AnnotationLog:                        "true",
+				AnnotationRateLimit:                  "10/minute burst 5 packets",
+				AnnotationComment:                    "web shop",
+				AnnotationIPS:                        "false",
+				AnnotationSourceRangesPrefix + "443": "10.0.0.0/8, 1.2.3.4",
+				"other.io/annotation":                "ignored",
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown annotation",
+			annotations: map[string]string{
+				annotationPrefix + "unknown": "true",
+			},
+			wantErr: true,
+		},
+		{
+			name: "source ranges for unknown port",
+			annotations: map[string]string{
+				AnnotationSourceRangesPrefix + "80": "10.0.0.0/8",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid source range",
+			annotations: map[string]string{
+				AnnotationSourceRangesPrefix + "443": "10.0.0.0/33",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid boolean",
+			annotations: map[string]string{
+				AnnotationLog: "yes please",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := corev1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{
+						{
+							Port: 443,
+						},
+					},
+				},
+			}
+			err := ValidateServiceAnnotations(svc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateServiceAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
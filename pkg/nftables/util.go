@@ -58,9 +58,14 @@ func checksum(file string) ([]byte, error) {
 }
 
 func assembleDestinationPortRule(common []string, protocol string, ports []string, comment string) string {
-	parts := common
+	return assembleDestinationPortRuleWithStatements(common, protocol, ports, []string{"counter"}, comment)
+}
+
+// assembleDestinationPortRuleWithStatements assembles an accept rule with the given statements before the verdict, e.g. counter or log
+func assembleDestinationPortRuleWithStatements(common []string, protocol string, ports []string, statements []string, comment string) string {
+	parts := append([]string{}, common...)
 	parts = append(parts, fmt.Sprintf("%s dport { %s }", protocol, strings.Join(ports, ", ")))
-	parts = append(parts, "counter")
+	parts = append(parts, statements...)
 	parts = append(parts, "accept")
 	if comment != "" {
 		parts = append(parts, "comment", fmt.Sprintf(`"%s"`, comment))
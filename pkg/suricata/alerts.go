@@ -0,0 +1,259 @@
+package suricata
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+const (
+	// maxAggregates limits the number of aggregated alerts kept in memory, the least recently seen are dropped first
+	maxAggregates = 1000
+	// alertRetention is the time an aggregated alert is kept after it was last seen
+	alertRetention = 24 * time.Hour
+)
+
+var alertsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("firewall", "ids", "alerts_total"),
+	"Alerts raised by the IDS by signature.",
+	[]string{"signature_id", "signature", "severity"}, nil,
+)
+
+type (
+	// Alert is an alert read from the EVE output of suricata
+	Alert struct {
+		Time        time.Time
+		SignatureID int64
+		Signature   string
+		Category    string
+		Severity    int
+		Source      string
+		Destination string
+		// Blocked is set if the packet was dropped by the inline IPS
+		Blocked bool
+	}
+
+	// AlertAggregator aggregates the alerts of the IDS by signature, severity, source and destination.
+	// It implements prometheus.Collector to expose the number of alerts by signature.
+	AlertAggregator struct {
+		lock       sync.Mutex
+		since      time.Time
+		total      uint64
+		aggregates map[alertKey]*aggregate
+		signatures map[signatureKey]uint64
+	}
+
+	alertKey struct {
+		signatureID int64
+		severity    int
+		source      string
+		destination string
+	}
+
+	signatureKey struct {
+		id        int64
+		signature string
+		severity  int
+	}
+
+	aggregate struct {
+		alert firewallv1.IDSAlert
+		// published is the count of the alert when it was last published
+		published   uint64
+		publishedAt time.Time
+	}
+)
+
+// NewAlertAggregator creates a new aggregator, which must be registered at a prometheus registry to expose the alerts
+func NewAlertAggregator() *AlertAggregator {
+	return &AlertAggregator{
+		since:      time.Now(),
+		aggregates: map[alertKey]*aggregate{},
+		signatures: map[signatureKey]uint64{},
+	}
+}
+
+// Add adds an alert. The IDS observes all traffic, so an alert of the IPS only counts the blocked packets of the alert of the IDS.
+func (a *AlertAggregator) Add(alert Alert) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !alert.Blocked {
+		a.total++
+		a.signatures[signatureKey{id: alert.SignatureID, signature: alert.Signature, severity: alert.Severity}]++
+	}
+
+	key := alertKey{signatureID: alert.SignatureID, severity: alert.Severity, source: alert.Source, destination: alert.Destination}
+	agg, ok := a.aggregates[key]
+	if !ok {
+		// an alert storm from many sources must not exhaust the memory until the next prune
+		if len(a.aggregates) >= 2*maxAggregates {
+			return
+		}
+		agg = &aggregate{alert: firewallv1.IDSAlert{
+			SignatureID: alert.SignatureID,
+			Signature:   alert.Signature,
+			Category:    alert.Category,
+			Severity:    alert.Severity,
+			Source:      alert.Source,
+			Destination: alert.Destination,
+			FirstSeen:   metav1.NewTime(alert.Time),
+		}}
+		a.aggregates[key] = agg
+	}
+	if alert.Blocked {
+		agg.alert.Blocked++
+	} else {
+		agg.alert.Count++
+	}
+	if alert.Time.After(agg.alert.LastSeen.Time) {
+		agg.alert.LastSeen = metav1.NewTime(alert.Time)
+	}
+}
+
+// Summary returns the total number of alerts
+func (a *AlertAggregator) Summary() *firewallv1.IDSAlertSummary {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return &firewallv1.IDSAlertSummary{
+		Total: a.total,
+		Since: metav1.NewTime(a.since),
+	}
+}
+
+// Top returns the n most frequent aggregated alerts, nil if there are none
+func (a *AlertAggregator) Top(n int, now time.Time) []firewallv1.IDSAlert {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.prune(now)
+
+	alerts := []firewallv1.IDSAlert{}
+	for _, agg := range a.aggregates {
+		alerts = append(alerts, agg.alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Count != alerts[j].Count {
+			return alerts[i].Count > alerts[j].Count
+		}
+		return lessAlert(alerts[i], alerts[j])
+	})
+	if len(alerts) > n {
+		alerts = alerts[:n]
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	return alerts
+}
+
+// Alerts returns all aggregated alerts
+func (a *AlertAggregator) Alerts(now time.Time) []firewallv1.IDSAlert {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.prune(now)
+
+	alerts := []firewallv1.IDSAlert{}
+	for _, agg := range a.aggregates {
+		alerts = append(alerts, agg.alert)
+	}
+	return alerts
+}
+
+// Pending returns the aggregated alerts which occurred since they were last published, at most max alerts ordered by severity.
+// An aggregated alert is published at most once per cooldown, the count of the returned alerts is the number of alerts since the last publication.
+// The number of alerts which are not returned because of the limit is returned as well, they are pending for the next call.
+func (a *AlertAggregator) Pending(max int, cooldown time.Duration, now time.Time) ([]firewallv1.IDSAlert, int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.prune(now)
+
+	pending := []*aggregate{}
+	for _, agg := range a.aggregates {
+		if agg.alert.Count == agg.published {
+			continue
+		}
+		if !agg.publishedAt.IsZero() && now.Sub(agg.publishedAt) < cooldown {
+			continue
+		}
+		pending = append(pending, agg)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].alert.Severity != pending[j].alert.Severity {
+			return pending[i].alert.Severity < pending[j].alert.Severity
+		}
+		ci, cj := pending[i].alert.Count-pending[i].published, pending[j].alert.Count-pending[j].published
+		if ci != cj {
+			return ci > cj
+		}
+		return lessAlert(pending[i].alert, pending[j].alert)
+	})
+
+	suppressed := 0
+	if len(pending) > max {
+		suppressed = len(pending) - max
+		pending = pending[:max]
+	}
+	alerts := []firewallv1.IDSAlert{}
+	for _, agg := range pending {
+		alert := agg.alert
+		alert.Count -= agg.published
+		alerts = append(alerts, alert)
+		agg.published = agg.alert.Count
+		agg.publishedAt = now
+	}
+	return alerts, suppressed
+}
+
+// prune drops the aggregated alerts which were not seen for the retention and the least recently seen above the limit
+func (a *AlertAggregator) prune(now time.Time) {
+	for key, agg := range a.aggregates {
+		if now.Sub(agg.alert.LastSeen.Time) > alertRetention {
+			delete(a.aggregates, key)
+		}
+	}
+	if len(a.aggregates) <= maxAggregates {
+		return
+	}
+	keys := []alertKey{}
+	for key := range a.aggregates {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return a.aggregates[keys[i]].alert.LastSeen.Before(&a.aggregates[keys[j]].alert.LastSeen)
+	})
+	for _, key := range keys[:len(keys)-maxAggregates] {
+		delete(a.aggregates, key)
+	}
+}
+
+func lessAlert(a, b firewallv1.IDSAlert) bool {
+	if a.SignatureID != b.SignatureID {
+		return a.SignatureID < b.SignatureID
+	}
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	return a.Destination < b.Destination
+}
+
+// Describe implements prometheus.Collector
+func (a *AlertAggregator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- alertsDesc
+}
+
+// Collect implements prometheus.Collector
+func (a *AlertAggregator) Collect(ch chan<- prometheus.Metric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for key, count := range a.signatures {
+		ch <- prometheus.MustNewConstMetric(alertsDesc, prometheus.CounterValue, float64(count), strconv.FormatInt(key.id, 10), key.signature, strconv.Itoa(key.severity))
+	}
+}
@@ -0,0 +1,101 @@
+package suricata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestAlertAggregator(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	alert := func(sid int64, severity int, src string, after time.Duration) Alert {
+		return Alert{Time: start.Add(after), SignatureID: sid, Signature: "signature", Severity: severity, Source: src, Destination: "185.0.0.1"}
+	}
+	aggregated := func(sid int64, severity int, src string, count uint64, first, last time.Duration) firewallv1.IDSAlert {
+		return firewallv1.IDSAlert{
+			SignatureID: sid,
+			Signature:   "signature",
+			Severity:    severity,
+			Source:      src,
+			Destination: "185.0.0.1",
+			Count:       count,
+			FirstSeen:   metav1.NewTime(start.Add(first)),
+			LastSeen:    metav1.NewTime(start.Add(last)),
+		}
+	}
+
+	a := NewAlertAggregator()
+	a.Add(alert(1, 3, "1.1.1.1", 0))
+	a.Add(alert(1, 3, "1.1.1.1", time.Second))
+	a.Add(alert(1, 3, "1.1.1.1", 2*time.Second))
+	a.Add(alert(2, 1, "2.2.2.2", time.Second))
+	a.Add(alert(1, 3, "3.3.3.3", time.Second))
+	blocked := alert(1, 3, "1.1.1.1", 2*time.Second)
+	blocked.Blocked = true
+	a.Add(blocked)
+
+	top := a.Top(2, start.Add(time.Minute))
+	want := []firewallv1.IDSAlert{
+		aggregated(1, 3, "1.1.1.1", 3, 0, 2*time.Second),
+		aggregated(1, 3, "3.3.3.3", 1, time.Second, time.Second),
+	}
+	want[0].Blocked = 1
+	if summary := a.Summary(); summary.Total != 5 {
+		t.Errorf("expected 5 alerts, got %d", summary.Total)
+	}
+	if !cmp.Equal(top, want) {
+		t.Errorf("Top() diff: %v", cmp.Diff(top, want))
+	}
+
+	// the highest severity is published first
+	alerts, suppressed := a.Pending(2, time.Minute, start.Add(time.Minute))
+	want = []firewallv1.IDSAlert{
+		aggregated(2, 1, "2.2.2.2", 1, time.Second, time.Second),
+		aggregated(1, 3, "1.1.1.1", 3, 0, 2*time.Second),
+	}
+	want[1].Blocked = 1
+	if suppressed != 1 {
+		t.Errorf("expected 1 suppressed alert, got %d", suppressed)
+	}
+	if !cmp.Equal(alerts, want) {
+		t.Errorf("Pending() diff: %v", cmp.Diff(alerts, want))
+	}
+
+	// published alerts are in cooldown, the suppressed alert is still pending
+	a.Add(alert(1, 3, "1.1.1.1", time.Minute))
+	alerts, suppressed = a.Pending(2, time.Minute, start.Add(time.Minute+time.Second))
+	want = []firewallv1.IDSAlert{
+		aggregated(1, 3, "3.3.3.3", 1, time.Second, time.Second),
+	}
+	if suppressed != 0 {
+		t.Errorf("expected no suppressed alerts, got %d", suppressed)
+	}
+	if !cmp.Equal(alerts, want) {
+		t.Errorf("Pending() diff: %v", cmp.Diff(alerts, want))
+	}
+
+	// after the cooldown only the alerts since the last publication are counted
+	alerts, _ = a.Pending(2, time.Minute, start.Add(2*time.Minute))
+	want = []firewallv1.IDSAlert{
+		aggregated(1, 3, "1.1.1.1", 1, 0, time.Minute),
+	}
+	want[0].Blocked = 1
+	if !cmp.Equal(alerts, want) {
+		t.Errorf("Pending() diff: %v", cmp.Diff(alerts, want))
+	}
+
+	// the alerts are counted by signature
+	if got := testutil.CollectAndCount(a); got != 2 {
+		t.Errorf("expected 2 metrics, got %d", got)
+	}
+
+	// alerts are dropped after the retention
+	if top := a.Top(2, start.Add(alertRetention+2*time.Minute)); top != nil || a.Summary().Total != 6 {
+		t.Errorf("expected no alerts after the retention but the total, got %v", top)
+	}
+}
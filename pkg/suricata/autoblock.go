@@ -0,0 +1,303 @@
+package suricata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+)
+
+const (
+	// DefaultAutoBlockSeverity is the default lowest severity of an alert which blocks its source
+	DefaultAutoBlockSeverity = 2
+	// DefaultAutoBlockTimeout is the default duration a source is blocked after its last alert
+	DefaultAutoBlockTimeout = time.Hour
+	// DefaultAutoBlockStateFile is the default file the blocked sources are persisted to
+	DefaultAutoBlockStateFile = "/var/lib/firewall-controller/auto-block.json"
+
+	// maxBlocked limits the number of blocked sources, further sources are blocked once others expired
+	maxBlocked = 1000
+	// maxStatusBlocked limits the number of blocked sources in the status of the firewall, all sources are in the FirewallMonitor
+	maxStatusBlocked = 10
+)
+
+// Blocker blocks the sources of IDS alerts with at least a severity for a timeout after their last alert.
+// Sources in the allow-list are never blocked.
+// The blocked sources are persisted, so a restart of the controller neither lifts the blocks nor forgets their expiry.
+type Blocker struct {
+	lock     sync.Mutex
+	log      logr.Logger
+	file     string
+	enabled  bool
+	severity int
+	timeout  time.Duration
+	allowed  []*net.IPNet
+	blocked  map[string]*firewallv1.BlockedSource
+}
+
+// NewBlocker creates a new blocker which persists the blocked sources to the given file, previously persisted sources are restored.
+// It does not block any further source until it is configured.
+func NewBlocker(file string, log logr.Logger) *Blocker {
+	b := &Blocker{
+		log:     log,
+		file:    file,
+		blocked: map[string]*firewallv1.BlockedSource{},
+	}
+	if err := b.load(); err != nil {
+		log.Error(err, "unable to restore the blocked sources", "file", file)
+	}
+	return b
+}
+
+// Configure applies the configuration of the firewall spec, the allowed prefixes are never blocked in addition to the allow-list.
+// Without configuration all blocks are removed.
+func (b *Blocker) Configure(config *firewallv1.AutoBlock, allowed []string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if config == nil {
+		b.enabled = false
+		b.unblockAll()
+		return nil
+	}
+
+	var errors *multierror.Error
+	severity := DefaultAutoBlockSeverity
+	if config.Severity > 0 {
+		severity = config.Severity
+	}
+	timeout := DefaultAutoBlockTimeout
+	if config.Timeout != "" {
+		t, err := time.ParseDuration(config.Timeout)
+		if err != nil || t <= 0 {
+			errors = multierror.Append(errors, fmt.Errorf("auto block timeout %q is not a positive duration", config.Timeout))
+		} else {
+			timeout = t
+		}
+	}
+	nets := []*net.IPNet{}
+	for _, prefix := range append(append([]string{}, config.AllowList...), allowed...) {
+		n, err := parsePrefix(prefix)
+		if err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("auto block allow-list contains %q which is not a valid IP or CIDR", prefix))
+			continue
+		}
+		nets = append(nets, n)
+	}
+	if errors.ErrorOrNil() != nil {
+		// blocking with an incomplete allow-list could lock out internal sources
+		b.enabled = false
+		b.unblockAll()
+		return errors
+	}
+
+	b.enabled = true
+	b.severity = severity
+	b.timeout = timeout
+	b.allowed = nets
+	changed := false
+	for ip := range b.blocked {
+		if b.isAllowed(net.ParseIP(ip)) {
+			delete(b.blocked, ip)
+			changed = true
+		}
+	}
+	if changed {
+		b.persist()
+	}
+	return nil
+}
+
+// unblockAll removes all blocks
+func (b *Blocker) unblockAll() {
+	if len(b.blocked) == 0 {
+		return
+	}
+	b.blocked = map[string]*firewallv1.BlockedSource{}
+	b.persist()
+}
+
+// Update blocks the sources of the given alerts and removes the expired blocks, the newly blocked sources are returned.
+// A source which raises further alerts is blocked until the timeout after its last alert.
+func (b *Blocker) Update(alerts []firewallv1.IDSAlert, now time.Time) []firewallv1.BlockedSource {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	changed := false
+	defer func() {
+		if changed {
+			b.persist()
+		}
+	}()
+
+	for ip, blocked := range b.blocked {
+		if !blocked.Expires.Time.After(now) {
+			delete(b.blocked, ip)
+			changed = true
+		}
+	}
+	if !b.enabled {
+		return nil
+	}
+
+	// the most recent alerts first, they are blocked preferably if the limit is reached
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].LastSeen.After(alerts[j].LastSeen.Time)
+	})
+	added := []firewallv1.BlockedSource{}
+	for _, a := range alerts {
+		if a.Severity < 1 || a.Severity > b.severity {
+			continue
+		}
+		expires := a.LastSeen.Add(b.timeout)
+		if !expires.After(now) {
+			continue
+		}
+		if blocked, ok := b.blocked[a.Source]; ok {
+			if expires.After(blocked.Expires.Time) {
+				blocked.Expires = metav1.NewTime(expires)
+				blocked.SignatureID, blocked.Signature, blocked.Severity = a.SignatureID, a.Signature, a.Severity
+				changed = true
+			}
+			continue
+		}
+		ip := net.ParseIP(a.Source)
+		if ip == nil || ip.To4() == nil || b.isAllowed(ip) || len(b.blocked) >= maxBlocked {
+			continue
+		}
+		blocked := &firewallv1.BlockedSource{
+			IP:          a.Source,
+			SignatureID: a.SignatureID,
+			Signature:   a.Signature,
+			Severity:    a.Severity,
+			Since:       metav1.NewTime(now),
+			Expires:     metav1.NewTime(expires),
+		}
+		b.blocked[a.Source] = blocked
+		added = append(added, *blocked)
+		changed = true
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].IP < added[j].IP })
+	return added
+}
+
+// Timeouts returns the blocked sources with their remaining timeout
+func (b *Blocker) Timeouts(now time.Time) map[string]time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	timeouts := map[string]time.Duration{}
+	for ip, blocked := range b.blocked {
+		if remaining := blocked.Expires.Sub(now); remaining > 0 {
+			timeouts[ip] = remaining
+		}
+	}
+	return timeouts
+}
+
+// Status returns the number of blocked sources and the most recently blocked ones, nil if auto blocking is disabled
+func (b *Blocker) Status() *firewallv1.AutoBlockStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.enabled {
+		return nil
+	}
+	blocked := b.sorted()
+	if len(blocked) > maxStatusBlocked {
+		blocked = blocked[:maxStatusBlocked]
+	}
+	return &firewallv1.AutoBlockStatus{Total: len(b.blocked), Blocked: blocked}
+}
+
+// Blocked returns the blocked sources, the most recently blocked first, nil if there are none
+func (b *Blocker) Blocked() []firewallv1.BlockedSource {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.sorted()
+}
+
+func (b *Blocker) sorted() []firewallv1.BlockedSource {
+	if len(b.blocked) == 0 {
+		return nil
+	}
+	blocked := []firewallv1.BlockedSource{}
+	for _, s := range b.blocked {
+		blocked = append(blocked, *s)
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		if !blocked[i].Since.Equal(&blocked[j].Since) {
+			return blocked[i].Since.After(blocked[j].Since.Time)
+		}
+		return blocked[i].IP < blocked[j].IP
+	})
+	return blocked
+}
+
+func (b *Blocker) load() error {
+	if b.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(b.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blocked := map[string]*firewallv1.BlockedSource{}
+	if err := json.Unmarshal(data, &blocked); err != nil {
+		return fmt.Errorf("unable to parse the blocked sources: %w", err)
+	}
+	b.blocked = blocked
+	return nil
+}
+
+// persist writes the blocked sources atomically, errors are only logged because the sources are blocked in nftables already
+func (b *Blocker) persist() {
+	if b.file == "" {
+		return
+	}
+	data, err := json.Marshal(b.blocked)
+	if err != nil {
+		b.log.Error(err, "unable to marshal the blocked sources")
+		return
+	}
+	if err := helper.WriteFile(b.file, data, 0600); err != nil {
+		b.log.Error(err, "unable to write the blocked sources", "file", b.file)
+	}
+}
+
+func (b *Blocker) isAllowed(ip net.IP) bool {
+	for _, n := range b.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses a CIDR or a single IP
+func parsePrefix(prefix string) (*net.IPNet, error) {
+	if ip := net.ParseIP(prefix); ip != nil {
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(prefix)
+	return n, err
+}
@@ -0,0 +1,84 @@
+package suricata
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestBlocker(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	alert := func(src string, severity int, lastSeen time.Duration) firewallv1.IDSAlert {
+		return firewallv1.IDSAlert{SignatureID: 1, Signature: "scan", Severity: severity, Source: src, Destination: "185.0.0.1", LastSeen: metav1.NewTime(start.Add(lastSeen))}
+	}
+	blocked := func(src string, since, expires time.Duration) firewallv1.BlockedSource {
+		return firewallv1.BlockedSource{IP: src, SignatureID: 1, Signature: "scan", Severity: 1, Since: metav1.NewTime(start.Add(since)), Expires: metav1.NewTime(start.Add(expires))}
+	}
+
+	file := filepath.Join(t.TempDir(), "auto-block.json")
+	b := NewBlocker(file, logr.Discard())
+	if got := b.Update([]firewallv1.IDSAlert{alert("1.1.1.1", 1, 0)}, start); len(got) != 0 || b.Status() != nil {
+		t.Errorf("expected no blocks without configuration, got %v", got)
+	}
+
+	if err := b.Configure(&firewallv1.AutoBlock{AllowList: []string{"invalid"}}, nil); err == nil {
+		t.Errorf("expected an error for an invalid allow-list")
+	}
+	if err := b.Configure(&firewallv1.AutoBlock{Severity: 1, Timeout: "10m", AllowList: []string{"2.2.2.2"}}, []string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := b.Update([]firewallv1.IDSAlert{
+		alert("1.1.1.1", 1, 0),
+		alert("2.2.2.2", 1, 0),
+		alert("10.1.2.3", 1, 0),
+		alert("3.3.3.3", 2, 0),
+		alert("4.4.4.4", 1, -20*time.Minute),
+	}, start)
+	want := []firewallv1.BlockedSource{blocked("1.1.1.1", 0, 10*time.Minute)}
+	if !cmp.Equal(got, want) {
+		t.Errorf("Update() diff: %v", cmp.Diff(got, want))
+	}
+
+	// further alerts extend the block
+	if got := b.Update([]firewallv1.IDSAlert{alert("1.1.1.1", 1, 5*time.Minute)}, start.Add(5*time.Minute)); len(got) != 0 {
+		t.Errorf("expected no new blocks, got %v", got)
+	}
+	wantTimeouts := map[string]time.Duration{"1.1.1.1": 10 * time.Minute}
+	if got := b.Timeouts(start.Add(5 * time.Minute)); !cmp.Equal(got, wantTimeouts) {
+		t.Errorf("Timeouts() diff: %v", cmp.Diff(got, wantTimeouts))
+	}
+	wantBlocked := []firewallv1.BlockedSource{blocked("1.1.1.1", 0, 15*time.Minute)}
+	wantStatus := &firewallv1.AutoBlockStatus{Total: 1, Blocked: wantBlocked}
+	if got := b.Status(); !cmp.Equal(got, wantStatus) {
+		t.Errorf("Status() diff: %v", cmp.Diff(got, wantStatus))
+	}
+	if got := b.Blocked(); !cmp.Equal(got, wantBlocked) {
+		t.Errorf("Blocked() diff: %v", cmp.Diff(got, wantBlocked))
+	}
+
+	// the blocks survive a restart
+	if got := NewBlocker(file, logr.Discard()).Blocked(); !cmp.Equal(got, wantBlocked) {
+		t.Errorf("Blocked() after restart diff: %v", cmp.Diff(got, wantBlocked))
+	}
+
+	// blocks expire
+	if got := b.Update(nil, start.Add(15*time.Minute)); len(got) != 0 || len(b.Timeouts(start.Add(15*time.Minute))) != 0 {
+		t.Errorf("expected the block to expire, got %v", b.Timeouts(start.Add(15*time.Minute)))
+	}
+
+	// sources of the allow-list are unblocked
+	b.Update([]firewallv1.IDSAlert{alert("5.5.5.5", 1, 20*time.Minute)}, start.Add(20*time.Minute))
+	if err := b.Configure(&firewallv1.AutoBlock{Severity: 1, AllowList: []string{"5.5.5.0/24"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := b.Status(); got == nil || got.Total != 0 || b.Blocked() != nil {
+		t.Errorf("expected no blocked sources, got %v", got)
+	}
+}
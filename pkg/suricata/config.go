@@ -0,0 +1,199 @@
+package suricata
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	mn "github.com/metal-stack/metal-lib/pkg/net"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+)
+
+const (
+	// mainConfigFile is the configuration of suricata on the firewall image, it includes the config of the controller
+	mainConfigFile = "/etc/suricata/suricata.yaml"
+	// includeConfigFile contains the settings which depend on the networks of the firewall
+	includeConfigFile = "/etc/suricata/firewall-controller.yaml"
+
+	idsService = "suricata.service"
+)
+
+// includeConfig overrides the address groups and the monitored interfaces of the image,
+// suricata reads both only on startup. The cluster ids are counted down from 99, the default of the image.
+var includeConfig = template.Must(template.New("suricata").Funcs(template.FuncMap{
+	"clusterID": func(i int) int { return 99 - i },
+	"join":      strings.Join,
+}).Parse(`%YAML 1.1
+---
+# managed by the firewall-controller
+vars:
+  address-groups:
+    HOME_NET: "[{{ join .HomeNet "," }}]"
+    EXTERNAL_NET: "!$HOME_NET"
+
+af-packet:
+{{- range $i, $iface := .Interfaces }}
+  - interface: {{ $iface }}
+    cluster-id: {{ clusterID $i }}
+    cluster-type: cluster_flow
+    defrag: yes
+    use-mmap: yes
+    tpacket-v3: yes
+{{- end }}
+`))
+
+type (
+	// ConfigManager applies the settings of suricata which depend on the networks of the firewall
+	ConfigManager struct {
+		lock        sync.Mutex
+		log         logr.Logger
+		mainConfig  string
+		includeFile string
+		// pending is set if the config was written but suricata was not restarted successfully
+		pending bool
+
+		run func(name string, arg ...string) ([]byte, error)
+	}
+
+	// networkConfig are the settings rendered into the include config
+	networkConfig struct {
+		HomeNet    []string
+		Interfaces []string
+	}
+)
+
+// NewConfigManager creates a new config manager for the suricata instance of the firewall image
+func NewConfigManager(log logr.Logger) *ConfigManager {
+	return &ConfigManager{
+		log:         log,
+		mainConfig:  mainConfigFile,
+		includeFile: includeConfigFile,
+		run: func(name string, arg ...string) ([]byte, error) {
+			return exec.Command(name, arg...).CombinedOutput()
+		},
+	}
+}
+
+// Reconcile renders the include config from the networks of the firewall and restarts suricata if it changed.
+// The inline IPS shares the config, it is restarted as well if it is running.
+// It returns whether the config changed, a failed restart is retried with the next reconcilation.
+func (m *ConfigManager) Reconcile(f firewallv1.Firewall) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	c, err := newNetworkConfig(f.Spec)
+	if err != nil {
+		return false, err
+	}
+	var b bytes.Buffer
+	if err := includeConfig.Execute(&b, c); err != nil {
+		return false, fmt.Errorf("unable to render suricata config: %w", err)
+	}
+
+	current, err := ioutil.ReadFile(m.includeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("unable to read suricata config: %w", err)
+	}
+	if bytes.Equal(current, b.Bytes()) && !m.pending {
+		return false, nil
+	}
+
+	if err := m.ensureInclude(); err != nil {
+		return true, err
+	}
+	if err := helper.WriteFile(m.includeFile, b.Bytes(), 0644); err != nil {
+		return true, err
+	}
+	m.pending = true
+	if err := systemctl(m.run, "restart", idsService); err != nil {
+		return true, err
+	}
+	if err := systemctl(m.run, "try-restart", ipsService); err != nil {
+		return true, err
+	}
+	m.pending = false
+	m.log.Info("applied suricata config", "homenet", c.HomeNet, "interfaces", c.Interfaces)
+	return true, nil
+}
+
+// ensureInclude adds the include config to the configuration of the image if it is not included yet
+func (m *ConfigManager) ensureInclude() error {
+	main, err := ioutil.ReadFile(m.mainConfig)
+	if err != nil {
+		return fmt.Errorf("unable to read suricata config: %w", err)
+	}
+	for _, line := range strings.Split(string(main), "\n") {
+		if strings.HasPrefix(line, "include:") && strings.Contains(line, m.includeFile) {
+			return nil
+		}
+	}
+	// later keys override the earlier ones, the include has to be the last key
+	content := strings.TrimRight(string(main), "\n") + "\n\ninclude: " + m.includeFile + "\n"
+	return helper.WriteFile(m.mainConfig, []byte(content), 0644)
+}
+
+// newNetworkConfig derives the home networks and the monitored interfaces from the firewall spec.
+// The home networks are the internal prefixes and the prefixes of all networks which are not external.
+// The vlan interfaces of all networks except the underlay and the primary private network are monitored,
+// the traffic of the cluster passes one of them. Like the config of metal-networker the vlan interfaces are captured,
+// the vrf interfaces are l3 master devices which do not pass all packets of their slaves to af-packet.
+func newNetworkConfig(spec firewallv1.FirewallSpec) (*networkConfig, error) {
+	homeNet := map[string]bool{}
+	interfaces := []string{}
+	for _, prefix := range spec.InternalPrefixes {
+		if _, err := parsePrefix(prefix); err != nil {
+			return nil, fmt.Errorf("internal prefix %q is not a valid IP or CIDR", prefix)
+		}
+		homeNet[prefix] = true
+	}
+	for _, n := range spec.FirewallNetworks {
+		if n.Networktype == nil {
+			continue
+		}
+		if *n.Networktype != mn.External {
+			for _, prefix := range n.Prefixes {
+				if _, err := parsePrefix(prefix); err != nil {
+					return nil, fmt.Errorf("prefix %q of network %s is not a valid CIDR", prefix, networkID(n))
+				}
+				homeNet[prefix] = true
+			}
+		}
+		switch *n.Networktype {
+		case mn.Underlay, mn.PrivatePrimaryShared, mn.PrivatePrimaryUnshared:
+		default:
+			if n.Vrf != nil && *n.Vrf != 0 {
+				interfaces = append(interfaces, fmt.Sprintf("vlan%d", *n.Vrf))
+			}
+		}
+	}
+	if len(homeNet) == 0 {
+		return nil, fmt.Errorf("unable to configure suricata, the firewall has no home networks")
+	}
+	if len(interfaces) == 0 {
+		return nil, fmt.Errorf("unable to configure suricata, the firewall has no networks to monitor")
+	}
+
+	c := &networkConfig{Interfaces: interfaces}
+	for prefix := range homeNet {
+		c.HomeNet = append(c.HomeNet, prefix)
+	}
+	sort.Strings(c.HomeNet)
+	sort.Strings(c.Interfaces)
+	return c, nil
+}
+
+func networkID(n firewallv1.FirewallNetwork) string {
+	if n.Networkid == nil {
+		return ""
+	}
+	return *n.Networkid
+}
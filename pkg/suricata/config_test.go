@@ -0,0 +1,143 @@
+package suricata
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	mn "github.com/metal-stack/metal-lib/pkg/net"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestNewNetworkConfig(t *testing.T) {
+	network := func(typ string, vrf int64, prefixes ...string) firewallv1.FirewallNetwork {
+		id := typ
+		return firewallv1.FirewallNetwork{Networkid: &id, Networktype: &typ, Vrf: &vrf, Prefixes: prefixes}
+	}
+	networks := []firewallv1.FirewallNetwork{
+		network(mn.PrivatePrimaryUnshared, 3981, "10.0.1.0/22"),
+		network(mn.External, 104009, "185.1.2.0/24"),
+		network(mn.Underlay, 0, "10.1.0.0/24"),
+		network(mn.PrivateSecondaryShared, 3982, "10.0.2.0/22"),
+	}
+
+	tests := []struct {
+		name    string
+		spec    firewallv1.FirewallSpec
+		want    *networkConfig
+		wantErr bool
+	}{
+		{
+			name: "home networks and interfaces",
+			spec: firewallv1.FirewallSpec{Data: firewallv1.Data{
+				InternalPrefixes: []string{"10.0.0.0/8", "10.0.1.0/22"},
+				FirewallNetworks: networks,
+			}},
+			want: &networkConfig{
+				HomeNet:    []string{"10.0.0.0/8", "10.0.1.0/22", "10.0.2.0/22", "10.1.0.0/24"},
+				Interfaces: []string{"vlan104009", "vlan3982"},
+			},
+		},
+		{
+			name: "invalid internal prefix",
+			spec: firewallv1.FirewallSpec{Data: firewallv1.Data{
+				InternalPrefixes: []string{"10.0.0.0/33"},
+				FirewallNetworks: networks,
+			}},
+			wantErr: true,
+		},
+		{
+			name: "nothing to monitor",
+			spec: firewallv1.FirewallSpec{Data: firewallv1.Data{
+				FirewallNetworks: networks[:1],
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newNetworkConfig(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newNetworkConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("newNetworkConfig() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func TestConfigManager(t *testing.T) {
+	dir := t.TempDir()
+	commands := []string{}
+	var restartErr error
+	m := NewConfigManager(logr.Discard())
+	m.mainConfig = filepath.Join(dir, "suricata.yaml")
+	m.includeFile = filepath.Join(dir, "firewall-controller.yaml")
+	m.run = func(name string, arg ...string) ([]byte, error) {
+		commands = append(commands, strings.Join(arg, " "))
+		return nil, restartErr
+	}
+	if err := ioutil.WriteFile(m.mainConfig, []byte("%YAML 1.1\n---\nvars: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	typ, vrf := mn.External, int64(104009)
+	f := firewallv1.Firewall{Spec: firewallv1.FirewallSpec{Data: firewallv1.Data{
+		InternalPrefixes: []string{"10.0.0.0/8"},
+		FirewallNetworks: []firewallv1.FirewallNetwork{{Networktype: &typ, Vrf: &vrf, Prefixes: []string{"185.1.2.0/24"}}},
+	}}}
+
+	changed, err := m.Reconcile(f)
+	if err != nil || !changed {
+		t.Fatalf("expected a changed config, got %t and error %v", changed, err)
+	}
+	if want := []string{"restart " + idsService, "try-restart " + ipsService}; !cmp.Equal(commands, want) {
+		t.Errorf("Reconcile() diff: %v", cmp.Diff(commands, want))
+	}
+	include, err := ioutil.ReadFile(m.includeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(include), `HOME_NET: "[10.0.0.0/8]"`) || !strings.Contains(string(include), "- interface: vlan104009\n    cluster-id: 99\n") {
+		t.Errorf("unexpected config %s", include)
+	}
+	main, err := ioutil.ReadFile(m.mainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(main), "\ninclude: "+m.includeFile+"\n") {
+		t.Errorf("expected the config to be included, got %s", main)
+	}
+
+	// an unchanged config is left alone
+	commands = nil
+	if changed, err := m.Reconcile(f); err != nil || changed || len(commands) != 0 {
+		t.Errorf("expected no changes, got %t, error %v and commands %v", changed, err, commands)
+	}
+
+	// a failed restart is retried
+	f.Spec.InternalPrefixes = []string{"10.0.0.0/16"}
+	restartErr = fmt.Errorf("job for suricata.service failed")
+	if changed, err := m.Reconcile(f); err == nil || !changed {
+		t.Errorf("expected a failed restart, got %t and error %v", changed, err)
+	}
+	restartErr = nil
+	commands = nil
+	if changed, err := m.Reconcile(f); err != nil || !changed || len(commands) != 2 {
+		t.Errorf("expected the restart to be retried, got %t, error %v and commands %v", changed, err, commands)
+	}
+	main2, err := ioutil.ReadFile(m.mainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(main2) != string(main) {
+		t.Errorf("expected the config to be included once, got %s", main2)
+	}
+}
@@ -0,0 +1,80 @@
+package suricata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ks2211/go-suricata/client"
+)
+
+// dumpCounters is the command which dumps the counters like in stats.log
+const dumpCounters = "dump-counters"
+
+// EngineStats contains the state and the counters of the suricata engine
+type EngineStats struct {
+	Version string
+	Uptime  time.Duration
+	// Counters are the counters of dump-counters like in stats.log, e.g. capture.kernel_drops, without the counters per thread
+	Counters map[string]uint64
+}
+
+// EngineStats returns the version, uptime and counters of suricata.
+// The counters are decoded generically because they depend on the version and the configuration of suricata,
+// the typed response of DumpCountersCommand misses e.g. most of the memcap counters.
+func (s *Suricata) EngineStats() (*EngineStats, error) {
+	suricata, err := client.CreateSocket(s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to suricata: %w", err)
+	}
+	defer suricata.Close()
+
+	ctx := context.Background()
+	stats := &EngineStats{}
+	if stats.Version, err = suricata.VersionCommand(ctx); err != nil {
+		return nil, err
+	}
+	uptime, err := suricata.UptimeCommand(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Uptime = time.Duration(uptime) * time.Second
+
+	var counters map[string]interface{}
+	if err := suricata.DoCommand(ctx, dumpCounters, nil, &counters); err != nil {
+		return nil, err
+	}
+	delete(counters, "threads")
+	stats.Counters = map[string]uint64{}
+	flattenCounters("", counters, stats.Counters)
+	return stats, nil
+}
+
+// MemcapHits sums the counters of events which hit a memcap, e.g. flow.memcap or tcp.segment_memcap_drop
+func (e *EngineStats) MemcapHits() uint64 {
+	var hits uint64
+	for name, value := range e.Counters {
+		if strings.Contains(name[strings.LastIndex(name, ".")+1:], "memcap") {
+			hits += value
+		}
+	}
+	return hits
+}
+
+// flattenCounters joins the names of nested counters with dots, values which are no counters are skipped
+func flattenCounters(prefix string, counters map[string]interface{}, result map[string]uint64) {
+	for name, value := range counters {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenCounters(name, v, result)
+		case float64:
+			if v >= 0 {
+				result[name] = uint64(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package suricata
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSuricata answers the commands of the command socket with the given messages
+func fakeSuricata(t *testing.T, messages map[string]string) string {
+	socket := filepath.Join(t.TempDir(), "suricata-command.socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// the requests are not delimited by newlines
+				decoder := json.NewDecoder(conn)
+				for {
+					var request map[string]interface{}
+					if err := decoder.Decode(&request); err != nil {
+						return
+					}
+					if _, ok := request["version"]; ok {
+						_, _ = conn.Write([]byte(`{"return": "OK"}`))
+						continue
+					}
+					command, _ := request["command"].(string)
+					message, ok := messages[command]
+					if !ok {
+						_, _ = conn.Write([]byte(`{"return": "NOK", "message": "Unknown command"}`))
+						continue
+					}
+					_, _ = conn.Write([]byte(`{"return": "OK", "message": ` + message + `}`))
+				}
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestEngineStats(t *testing.T) {
+	s := Suricata{socket: fakeSuricata(t, map[string]string{
+		"version": `"6.0.1 RELEASE"`,
+		"uptime":  `3600`,
+		"dump-counters": `{
+			"uptime": 3600,
+			"capture": {"kernel_packets": 1000, "kernel_drops": 10},
+			"decoder": {"pkts": 990, "invalid": 2, "event": {"ipv4": {"trunc_pkt": 1}}},
+			"flow": {"memcap": 3, "memuse": 7000000},
+			"tcp": {"segment_memcap_drop": 4},
+			"threads": {"W#01-eth0": {"capture": {"kernel_packets": 1000}}}
+		}`,
+	})}
+
+	got, err := s.EngineStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &EngineStats{
+		Version: "6.0.1 RELEASE",
+		Uptime:  time.Hour,
+		Counters: map[string]uint64{
+			"uptime":                       3600,
+			"capture.kernel_packets":       1000,
+			"capture.kernel_drops":         10,
+			"decoder.pkts":                 990,
+			"decoder.invalid":              2,
+			"decoder.event.ipv4.trunc_pkt": 1,
+			"flow.memcap":                  3,
+			"flow.memuse":                  7000000,
+			"tcp.segment_memcap_drop":      4,
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("EngineStats() diff: %v", cmp.Diff(got, want))
+	}
+	if hits := got.MemcapHits(); hits != 7 {
+		t.Errorf("expected 7 memcap hits, got %d", hits)
+	}
+
+	s = Suricata{socket: fakeSuricata(t, map[string]string{"version": `"6.0.1 RELEASE"`})}
+	if _, err := s.EngineStats(); err == nil {
+		t.Errorf("expected an error for an unknown command")
+	}
+
+	s = Suricata{socket: filepath.Join(t.TempDir(), "missing.socket")}
+	if _, err := s.EngineStats(); err == nil {
+		t.Errorf("expected an error for an unreachable socket")
+	}
+}
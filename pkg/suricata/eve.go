@@ -0,0 +1,255 @@
+package suricata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// DefaultEVEOutput is the default EVE JSON output of suricata
+	DefaultEVEOutput = "/var/log/suricata/eve.json"
+
+	// unixSocketPrefix marks an EVE output of type unix_stream, suricata connects to the socket created by the reader
+	unixSocketPrefix = "unix://"
+
+	// pollInterval is the interval an EVE file is checked for new events and rotation
+	pollInterval = time.Second
+	// maxEventSize limits the size of an EVE event read from a socket
+	maxEventSize = 1024 * 1024
+
+	// eveTimeFormat is the format of the timestamps of EVE events
+	eveTimeFormat = "2006-01-02T15:04:05.999999-0700"
+)
+
+// eveEvent contains the attributes of an EVE event which are required for an alert
+type eveEvent struct {
+	Timestamp string `json:"timestamp"`
+	EventType string `json:"event_type"`
+	SrcIP     string `json:"src_ip"`
+	DestIP    string `json:"dest_ip"`
+	Alert     *struct {
+		SignatureID int64  `json:"signature_id"`
+		Signature   string `json:"signature"`
+		Category    string `json:"category"`
+		Severity    int    `json:"severity"`
+		Action      string `json:"action"`
+	} `json:"alert"`
+}
+
+// EVEReader reads the alerts from the EVE JSON output of suricata
+type EVEReader struct {
+	output      string
+	alerts      *AlertAggregator
+	log         logr.Logger
+	blockedOnly bool
+}
+
+// NewEVEReader creates a new reader which adds the alerts of the given output to the aggregator.
+// An output with the prefix unix:// is a unix socket suricata connects to, any other output is a file.
+func NewEVEReader(output string, alerts *AlertAggregator, log logr.Logger) *EVEReader {
+	return &EVEReader{
+		output: output,
+		alerts: alerts,
+		log:    log,
+	}
+}
+
+// NewIPSEVEReader creates a new reader which adds the alerts of the IPS instance to the aggregator.
+// Only the alerts of dropped packets are added, the IDS instance observes all traffic and reports the alerts already.
+func NewIPSEVEReader(alerts *AlertAggregator, log logr.Logger) *EVEReader {
+	return &EVEReader{
+		output:      IPSEVEOutput,
+		alerts:      alerts,
+		log:         log,
+		blockedOnly: true,
+	}
+}
+
+// Run reads the alerts until stop is closed
+func (r *EVEReader) Run(stop <-chan struct{}) error {
+	if strings.HasPrefix(r.output, unixSocketPrefix) {
+		return r.listen(strings.TrimPrefix(r.output, unixSocketPrefix), stop)
+	}
+	r.follow(r.output, stop)
+	return nil
+}
+
+// follow reads the events appended to an EVE file like tail -F, events written before the reader started are skipped.
+// A rotated or truncated file is read from the beginning.
+func (r *EVEReader) follow(path string, stop <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var (
+		f       *os.File
+		reader  *bufio.Reader
+		partial []byte
+		offset  int64
+		first   = true
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for {
+		if f == nil {
+			var err error
+			f, offset, err = openEVEFile(path, first)
+			if err == nil {
+				first = false
+				reader = bufio.NewReader(f)
+				partial = nil
+			} else if !os.IsNotExist(err) {
+				r.log.Error(err, "unable to open eve output", "file", path)
+			}
+		}
+
+		if f != nil {
+			var n int64
+			partial, n = readLines(reader, partial, r.handle)
+			offset += n
+
+			if rotated(f, path, offset) {
+				f.Close()
+				f = nil
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func openEVEFile(path string, seekEnd bool) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !seekEnd {
+		return f, 0, nil
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("unable to seek to the end of %s: %w", path, err)
+	}
+	return f, offset, nil
+}
+
+// rotated checks whether the file at path was replaced or truncated
+func rotated(f *os.File, path string, offset int64) bool {
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(current, opened) || current.Size() < offset
+}
+
+// readLines reads the complete lines which are available and handles them, an incomplete line is returned to be continued.
+// The number of bytes read is returned as well.
+func readLines(reader *bufio.Reader, partial []byte, handle func([]byte)) ([]byte, int64) {
+	var n int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		n += int64(len(line))
+		partial = append(partial, line...)
+		if err != nil {
+			return partial, n
+		}
+		handle(partial)
+		partial = nil
+	}
+}
+
+// listen creates a unix socket and reads the events of the connections of suricata
+func (r *EVEReader) listen(path string, stop <-chan struct{}) error {
+	_ = os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("unable to listen on eve socket %s: %w", path, err)
+	}
+	go func() {
+		<-stop
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			r.log.Error(err, "unable to accept eve connection", "socket", path)
+			time.Sleep(pollInterval)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+			for scanner.Scan() {
+				r.handle(scanner.Bytes())
+			}
+			if err := scanner.Err(); err != nil {
+				r.log.Error(err, "unable to read eve connection", "socket", path)
+			}
+		}()
+	}
+}
+
+func (r *EVEReader) handle(line []byte) {
+	alert, ok := parseAlert(line)
+	if !ok || (r.blockedOnly && !alert.Blocked) {
+		return
+	}
+	r.alerts.Add(alert)
+}
+
+// parseAlert parses an EVE event, events other than alerts are skipped
+func parseAlert(line []byte) (Alert, bool) {
+	line = bytes.TrimSpace(line)
+	// the event type is checked before parsing to skip the bulk of flow and stats events cheaply
+	if !bytes.Contains(line, []byte(`"alert"`)) {
+		return Alert{}, false
+	}
+	var e eveEvent
+	if err := json.Unmarshal(line, &e); err != nil || e.EventType != "alert" || e.Alert == nil {
+		return Alert{}, false
+	}
+
+	t, err := time.Parse(eveTimeFormat, e.Timestamp)
+	if err != nil {
+		t = time.Now()
+	}
+	return Alert{
+		Time:        t,
+		SignatureID: e.Alert.SignatureID,
+		Signature:   e.Alert.Signature,
+		Category:    e.Alert.Category,
+		Severity:    e.Alert.Severity,
+		Source:      e.SrcIP,
+		Destination: e.DestIP,
+		Blocked:     e.Alert.Action == "blocked",
+	}, true
+}
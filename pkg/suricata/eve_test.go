@@ -0,0 +1,134 @@
+package suricata
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAlert(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		want  Alert
+		alert bool
+	}{
+		{
+			name: "alert",
+			line: `{"timestamp":"2021-01-01T10:00:00.123456+0000","flow_id":1,"in_iface":"vlan104009","event_type":"alert","src_ip":"1.2.3.4","src_port":4711,"dest_ip":"185.0.0.1","dest_port":443,"proto":"TCP",` +
+				`"alert":{"action":"allowed","gid":1,"signature_id":2024897,"rev":1,"signature":"ET USER_AGENTS Go HTTP Client User-Agent","category":"Unknown Traffic","severity":3}}`,
+			want: Alert{
+				Time:        time.Date(2021, 1, 1, 10, 0, 0, 123456000, time.UTC),
+				SignatureID: 2024897,
+				Signature:   "ET USER_AGENTS Go HTTP Client User-Agent",
+				Category:    "Unknown Traffic",
+				Severity:    3,
+				Source:      "1.2.3.4",
+				Destination: "185.0.0.1",
+			},
+			alert: true,
+		},
+		{
+			name: "blocked by the ips",
+			line: `{"timestamp":"2021-01-01T10:00:00.123456+0000","event_type":"alert","src_ip":"1.2.3.4","dest_ip":"185.0.0.1",` +
+				`"alert":{"action":"blocked","signature_id":2010937,"signature":"ET SCAN Suspicious inbound to mySQL port 3306","category":"Potentially Bad Traffic","severity":2}}`,
+			want: Alert{
+				Time:        time.Date(2021, 1, 1, 10, 0, 0, 123456000, time.UTC),
+				SignatureID: 2010937,
+				Signature:   "ET SCAN Suspicious inbound to mySQL port 3306",
+				Category:    "Potentially Bad Traffic",
+				Severity:    2,
+				Source:      "1.2.3.4",
+				Destination: "185.0.0.1",
+				Blocked:     true,
+			},
+			alert: true,
+		},
+		{
+			name: "flow event",
+			line: `{"timestamp":"2021-01-01T10:00:00.123456+0000","event_type":"flow","src_ip":"1.2.3.4","dest_ip":"185.0.0.1","app_proto":"alert"}`,
+		},
+		{
+			name: "malformed event",
+			line: `{"event_type":"alert",`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseAlert([]byte(tt.line))
+			if ok != tt.alert {
+				t.Fatalf("parseAlert() = %v, want %v", ok, tt.alert)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("parseAlert() time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time = tt.want.Time
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("parseAlert() diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	lines := []string{}
+	handle := func(line []byte) {
+		lines = append(lines, string(line))
+	}
+
+	partial, n := readLines(bufio.NewReader(strings.NewReader("first\nsecond\nthi")), nil, handle)
+	if string(partial) != "thi" || n != 16 {
+		t.Errorf("expected incomplete line thi after 16 bytes, got %q after %d bytes", partial, n)
+	}
+	partial, n = readLines(bufio.NewReader(strings.NewReader("rd\n")), partial, handle)
+	if partial != nil || n != 3 {
+		t.Errorf("expected no incomplete line after 3 bytes, got %q after %d bytes", partial, n)
+	}
+
+	want := []string{"first\n", "second\n", "third\n"}
+	if !cmp.Equal(lines, want) {
+		t.Errorf("readLines() diff: %v", cmp.Diff(lines, want))
+	}
+}
+
+func TestRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eve.json")
+	if err := ioutil.WriteFile(path, []byte("first\nsecond\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, offset, err := openEVEFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if offset != 13 {
+		t.Errorf("expected the file to be opened at its end, got offset %d", offset)
+	}
+	if rotated(f, path, offset) {
+		t.Errorf("expected the file not to be rotated")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !rotated(f, path, offset) {
+		t.Errorf("expected a truncated file to be rotated")
+	}
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("first\nsecond\nthird\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !rotated(f, path, 0) {
+		t.Errorf("expected a replaced file to be rotated")
+	}
+}
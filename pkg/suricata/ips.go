@@ -0,0 +1,155 @@
+package suricata
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/go-logr/logr"
+
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+)
+
+const (
+	// DefaultIPSQueue is the default NFQUEUE the connections inspected inline are sent to
+	DefaultIPSQueue = 0
+
+	// IPSEVEOutput is the EVE JSON output of the IPS instance
+	IPSEVEOutput = ipsLogDir + "/eve.json"
+
+	ipsService  = "suricata-ips.service"
+	ipsUnitFile = "/etc/systemd/system/" + ipsService
+	ipsLogDir   = "/var/log/suricata-ips"
+	// ipsSocket is the command socket of the IPS instance, suricata removes it when it stops
+	ipsSocket = "/run/suricata-ips-command.socket"
+)
+
+// ipsUnit runs a dedicated suricata instance in NFQUEUE mode, the IDS instance of the firewall image keeps observing all traffic.
+// With fail-open the packets are accepted if the queue is full, without suricata listening nftables bypasses the queue.
+var ipsUnit = template.Must(template.New("ips").Parse(`# managed by the firewall-controller
+[Unit]
+Description=Suricata inline IPS for the connections marked by the firewall-controller
+After=network-online.target
+
+[Service]
+ExecStartPre=/bin/mkdir -p {{ .LogDir }}
+ExecStart=/usr/bin/suricata -c /etc/suricata/suricata.yaml -q {{ .Queue }} -l {{ .LogDir }} --pidfile /run/suricata-ips.pid --set nfq.mode=accept --set nfq.fail-open=yes --set unix-command.filename={{ .Socket }}
+ExecReload=/bin/kill -USR2 $MAINPID
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// IPS manages the suricata instance which inspects the connections of the NFQUEUE inline
+type IPS struct {
+	lock     sync.Mutex
+	log      logr.Logger
+	queue    uint16
+	unitFile string
+	started  bool
+
+	run func(name string, arg ...string) ([]byte, error)
+}
+
+// NewIPS creates a new IPS for the given queue
+func NewIPS(queue uint16, log logr.Logger) *IPS {
+	return &IPS{
+		log:      log,
+		queue:    queue,
+		unitFile: ipsUnitFile,
+		run: func(name string, arg ...string) ([]byte, error) {
+			return exec.Command(name, arg...).CombinedOutput()
+		},
+	}
+}
+
+// Queue returns the NFQUEUE of the IPS
+func (i *IPS) Queue() uint16 {
+	return i.queue
+}
+
+// Reconcile starts the IPS if connections are inspected inline and stops it otherwise.
+// A changed configuration restarts the IPS, the packets bypass the inspection during the restart.
+func (i *IPS) Reconcile(enabled bool) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if !enabled {
+		return i.stop()
+	}
+
+	var b bytes.Buffer
+	data := struct {
+		Queue  uint16
+		LogDir string
+		Socket string
+	}{Queue: i.queue, LogDir: ipsLogDir, Socket: ipsSocket}
+	if err := ipsUnit.Execute(&b, data); err != nil {
+		return fmt.Errorf("unable to render ips unit: %w", err)
+	}
+	current, err := ioutil.ReadFile(i.unitFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read ips unit: %w", err)
+	}
+	changed := !bytes.Equal(current, b.Bytes())
+	if changed {
+		if err := helper.WriteFile(i.unitFile, b.Bytes(), 0644); err != nil {
+			return err
+		}
+		if err := systemctl(i.run, "daemon-reload"); err != nil {
+			return err
+		}
+	}
+
+	if !changed && i.started {
+		return nil
+	}
+	if err := systemctl(i.run, "enable", ipsService); err != nil {
+		return err
+	}
+	// start keeps an instance which was started by a previous controller
+	action := "start"
+	if changed {
+		action = "restart"
+	}
+	if err := systemctl(i.run, action, ipsService); err != nil {
+		return err
+	}
+	i.started = true
+	i.log.Info("started inline ips", "queue", i.queue)
+	return nil
+}
+
+// stop stops and removes the IPS if it was set up
+func (i *IPS) stop() error {
+	if _, err := os.Stat(i.unitFile); os.IsNotExist(err) {
+		i.started = false
+		return nil
+	}
+	if err := systemctl(i.run, "disable", "--now", ipsService); err != nil {
+		return err
+	}
+	if err := os.Remove(i.unitFile); err != nil {
+		return fmt.Errorf("unable to remove ips unit: %w", err)
+	}
+	if err := systemctl(i.run, "daemon-reload"); err != nil {
+		return err
+	}
+	i.started = false
+	i.log.Info("stopped inline ips", "queue", i.queue)
+	return nil
+}
+
+// systemctl runs systemctl with the given runner, the output is added to the error
+func systemctl(run func(name string, arg ...string) ([]byte, error), arg ...string) error {
+	if out, err := run("/bin/systemctl", arg...); err != nil {
+		return fmt.Errorf("unable to %s: %w: %s", strings.Join(append([]string{"systemctl"}, arg...), " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
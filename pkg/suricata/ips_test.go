@@ -0,0 +1,75 @@
+package suricata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIPS(t *testing.T) {
+	commands := []string{}
+	i := NewIPS(3, logr.Discard())
+	i.unitFile = filepath.Join(t.TempDir(), ipsService)
+	i.run = func(name string, arg ...string) ([]byte, error) {
+		commands = append(commands, strings.Join(arg, " "))
+		return nil, nil
+	}
+
+	if err := i.Reconcile(false); err != nil || len(commands) != 0 {
+		t.Errorf("expected nothing to stop, got error %v and commands %v", err, commands)
+	}
+
+	if err := i.Reconcile(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"daemon-reload", "enable " + ipsService, "restart " + ipsService}
+	if !cmp.Equal(commands, want) {
+		t.Errorf("Reconcile() diff: %v", cmp.Diff(commands, want))
+	}
+	unit, err := ioutil.ReadFile(i.unitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(unit), " -q 3 ") || !strings.Contains(string(unit), "nfq.fail-open=yes") {
+		t.Errorf("expected the queue and fail-open in the unit, got %s", unit)
+	}
+
+	// an unchanged configuration is left alone
+	commands = nil
+	if err := i.Reconcile(true); err != nil || len(commands) != 0 {
+		t.Errorf("expected no commands for an unchanged ips, got error %v and commands %v", err, commands)
+	}
+
+	// an instance of a previous controller is only started
+	path := i.unitFile
+	i = NewIPS(3, logr.Discard())
+	i.unitFile = path
+	i.run = func(name string, arg ...string) ([]byte, error) {
+		commands = append(commands, strings.Join(arg, " "))
+		return nil, nil
+	}
+	if err := i.Reconcile(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []string{"enable " + ipsService, "start " + ipsService}
+	if !cmp.Equal(commands, want) {
+		t.Errorf("Reconcile() diff: %v", cmp.Diff(commands, want))
+	}
+
+	commands = nil
+	if err := i.Reconcile(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []string{"disable --now " + ipsService, "daemon-reload"}
+	if !cmp.Equal(commands, want) {
+		t.Errorf("Reconcile() diff: %v", cmp.Diff(commands, want))
+	}
+	if _, err := os.Stat(i.unitFile); !os.IsNotExist(err) {
+		t.Errorf("expected the unit to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package suricata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+	"github.com/metal-stack/firewall-controller/pkg/helper"
+)
+
+const (
+	// DefaultRulesStateFile is the default file the state of the ruleset applied by the controller is persisted to
+	DefaultRulesStateFile = "/var/lib/firewall-controller/ids-rules.json"
+
+	// localRulesFile contains the custom local rules, it is merged into the ruleset by suricata-update
+	localRulesFile = "/etc/suricata/rules/firewall-controller.rules"
+	// disableConfFile contains the disabled signature ids, it is read by suricata-update
+	disableConfFile = "/etc/suricata/disable.conf"
+
+	// the keys of a ConfigMap which extends the ruleset
+	configMapSources      = "sources"
+	configMapDisabledSIDs = "disabledSIDs"
+	configMapRules        = "rules"
+
+	// minRetryInterval is the interval a ruleset which failed to apply is first retried, it doubles with every failure up to maxRetryInterval
+	minRetryInterval = time.Minute
+	maxRetryInterval = time.Hour
+)
+
+var (
+	ruleRegex = regexp.MustCompile(`^(alert|drop|pass|reject|rejectsrc|rejectdst|rejectboth)\s+\S+\s+.*\(.*\)$`)
+	sidRegex  = regexp.MustCompile(`[(;\s]sid\s*:\s*(\d+)\s*;`)
+)
+
+type (
+	// RuleManager applies the ruleset configured in the cluster to suricata. The ruleset is only applied if it changed,
+	// as suricata-update downloads the rule sources.
+	RuleManager struct {
+		lock        sync.Mutex
+		log         logr.Logger
+		stateFile   string
+		localRules  string
+		disableConf string
+		state       rulesState
+		// applied is the hash of the ruleset which was applied successfully, it is empty after a failure
+		applied string
+		// failed is the hash of the ruleset which failed to apply with err, it is retried at retryAt
+		failed  string
+		err     error
+		retryAt time.Time
+		backoff time.Duration
+
+		run    func(name string, arg ...string) ([]byte, error)
+		reload func() error
+		stats  func() (loaded int, failed int, err error)
+		now    func() time.Time
+	}
+
+	// rulesState is the state of the ruleset which survives restarts of the controller
+	rulesState struct {
+		// Sources are the rule sources enabled by the controller
+		Sources    []string     `json:"sources"`
+		Hash       string       `json:"hash"`
+		LastReload *metav1.Time `json:"lastReload,omitempty"`
+	}
+)
+
+// NewRuleManager creates a new rule manager which persists its state to the given file, a previously persisted state is restored
+func NewRuleManager(stateFile string, log logr.Logger) *RuleManager {
+	s := New()
+	m := &RuleManager{
+		log:         log,
+		stateFile:   stateFile,
+		localRules:  localRulesFile,
+		disableConf: disableConfFile,
+		run: func(name string, arg ...string) ([]byte, error) {
+			return exec.Command(name, arg...).CombinedOutput()
+		},
+		reload: func() error {
+			if err := s.ReloadRules(); err != nil {
+				return err
+			}
+			// the ips instance shares the ruleset, it loads the current ruleset when it is started
+			if _, err := os.Stat(ipsSocket); os.IsNotExist(err) {
+				return nil
+			}
+			ips := newIPS()
+			if err := ips.ReloadRules(); err != nil {
+				return fmt.Errorf("ips: %w", err)
+			}
+			return nil
+		},
+		stats: s.RulesetStats,
+		now:   time.Now,
+	}
+	if err := m.load(); err != nil {
+		log.Error(err, "unable to restore the state of the ids ruleset", "file", stateFile)
+	}
+	m.applied = m.state.Hash
+	return m
+}
+
+// Reconcile applies the given ruleset, nil restores the ruleset of the firewall image.
+// A ruleset which failed to apply is retried with an exponential backoff, meanwhile its error is returned.
+func (m *RuleManager) Reconcile(ruleset *firewallv1.IDSRuleset) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	desired := normalizeRuleset(ruleset)
+	hash := hashRuleset(desired)
+	if hash == m.applied {
+		return nil
+	}
+	// the ruleset of the image is left untouched until a ruleset is configured
+	if desired == nil && m.state.Hash == "" {
+		m.applied = hash
+		m.failed = ""
+		m.err = nil
+		return nil
+	}
+	if hash == m.failed && m.now().Before(m.retryAt) {
+		return m.err
+	}
+
+	// the files and sources may be changed partially by a failed attempt, so the previous ruleset must be applied again as well
+	m.applied = ""
+	if err := m.apply(desired); err != nil {
+		if hash == m.failed {
+			m.backoff *= 2
+			if m.backoff > maxRetryInterval {
+				m.backoff = maxRetryInterval
+			}
+		} else {
+			m.backoff = minRetryInterval
+		}
+		m.failed = hash
+		m.err = err
+		m.retryAt = m.now().Add(m.backoff)
+		return err
+	}
+	m.applied = hash
+	m.failed = ""
+	m.err = nil
+
+	now := metav1.NewTime(m.now())
+	m.state.Hash = hash
+	m.state.LastReload = &now
+	if desired != nil {
+		m.state.Sources = desired.Sources
+	} else {
+		m.state.Sources = nil
+	}
+	m.persist()
+	return nil
+}
+
+// Status returns the state of the ruleset, nil if no ruleset is configured
+func (m *RuleManager) Status() *firewallv1.IDSRulesStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if (m.state.Hash == "" || m.state.Hash == hashRuleset(nil)) && m.err == nil {
+		return nil
+	}
+	status := &firewallv1.IDSRulesStatus{}
+	if m.state.LastReload != nil {
+		t := *m.state.LastReload
+		status.LastReload = &t
+	}
+	if m.err != nil {
+		status.Error = m.err.Error()
+	}
+	loaded, failed, err := m.stats()
+	if err != nil && status.Error == "" {
+		status.Error = fmt.Sprintf("unable to query ruleset statistics: %v", err)
+	}
+	status.Loaded = loaded
+	status.Failed = failed
+	return status
+}
+
+func (m *RuleManager) apply(ruleset *firewallv1.IDSRuleset) error {
+	if ruleset == nil {
+		ruleset = &firewallv1.IDSRuleset{}
+	}
+	if err := ValidateRules(ruleset.Rules); err != nil {
+		return err
+	}
+
+	rules := "# managed by the firewall-controller\n" + strings.Join(ruleset.Rules, "\n") + "\n"
+	if err := helper.WriteFile(m.localRules, []byte(rules), 0644); err != nil {
+		return err
+	}
+	sids := []string{"# managed by the firewall-controller"}
+	for _, sid := range ruleset.DisabledSIDs {
+		sids = append(sids, strconv.FormatInt(sid, 10))
+	}
+	if err := helper.WriteFile(m.disableConf, []byte(strings.Join(sids, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	enabled := map[string]bool{}
+	for _, s := range m.state.Sources {
+		enabled[s] = true
+	}
+	desired := map[string]bool{}
+	for _, s := range ruleset.Sources {
+		desired[s] = true
+		if !enabled[s] {
+			if out, err := m.run("suricata-update", "enable-source", s); err != nil {
+				return fmt.Errorf("unable to enable rule source %s: %w: %s", s, err, strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	for _, s := range m.state.Sources {
+		if !desired[s] {
+			if out, err := m.run("suricata-update", "disable-source", s); err != nil {
+				return fmt.Errorf("unable to disable rule source %s: %w: %s", s, err, strings.TrimSpace(string(out)))
+			}
+		}
+	}
+
+	// suricata-update tests the merged ruleset with suricata and keeps the previous ruleset if the test fails
+	if out, err := m.run("suricata-update", "--local", m.localRules, "--disable-conf", m.disableConf); err != nil {
+		return fmt.Errorf("unable to update ruleset: %w: %s", err, lastLines(string(out), 5))
+	}
+	if err := m.reload(); err != nil {
+		return fmt.Errorf("unable to reload rules: %w", err)
+	}
+	m.log.Info("applied ids ruleset", "sources", ruleset.Sources, "disabled", len(ruleset.DisabledSIDs), "rules", len(ruleset.Rules))
+	return nil
+}
+
+// ValidateRules checks the syntax of custom rules, every rule requires a unique signature id
+func ValidateRules(rules []string) error {
+	var errors *multierror.Error
+	sids := map[string]int{}
+	for i, rule := range rules {
+		if !ruleRegex.MatchString(rule) {
+			errors = multierror.Append(errors, fmt.Errorf("rule %d is malformed: %s", i, rule))
+			continue
+		}
+		match := sidRegex.FindStringSubmatch(rule)
+		if match == nil {
+			errors = multierror.Append(errors, fmt.Errorf("rule %d has no signature id: %s", i, rule))
+			continue
+		}
+		if other, ok := sids[match[1]]; ok {
+			errors = multierror.Append(errors, fmt.Errorf("rule %d has the same signature id %s as rule %d", i, match[1], other))
+			continue
+		}
+		sids[match[1]] = i
+	}
+	return errors.ErrorOrNil()
+}
+
+// MergeRuleset extends the ruleset by the data of a ConfigMap, the keys sources, disabledSIDs and rules contain one entry per line,
+// empty lines and lines starting with # are skipped.
+func MergeRuleset(ruleset *firewallv1.IDSRuleset, data map[string]string) error {
+	ruleset.Sources = append(ruleset.Sources, lines(data[configMapSources])...)
+	ruleset.Rules = append(ruleset.Rules, lines(data[configMapRules])...)
+	for _, l := range lines(data[configMapDisabledSIDs]) {
+		sid, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid signature id %q: %w", l, err)
+		}
+		ruleset.DisabledSIDs = append(ruleset.DisabledSIDs, sid)
+	}
+	return nil
+}
+
+func lines(s string) []string {
+	result := []string{}
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+// normalizeRuleset sorts the sources and disabled signature ids and removes duplicates, an empty ruleset is nil.
+// The order of the rules is kept, the config maps are already merged.
+func normalizeRuleset(ruleset *firewallv1.IDSRuleset) *firewallv1.IDSRuleset {
+	if ruleset == nil || (len(ruleset.Sources) == 0 && len(ruleset.DisabledSIDs) == 0 && len(ruleset.Rules) == 0) {
+		return nil
+	}
+	n := &firewallv1.IDSRuleset{Rules: append([]string{}, ruleset.Rules...)}
+
+	sources := map[string]bool{}
+	for _, s := range ruleset.Sources {
+		if !sources[s] {
+			sources[s] = true
+			n.Sources = append(n.Sources, s)
+		}
+	}
+	sort.Strings(n.Sources)
+
+	sids := map[int64]bool{}
+	for _, sid := range ruleset.DisabledSIDs {
+		if !sids[sid] {
+			sids[sid] = true
+			n.DisabledSIDs = append(n.DisabledSIDs, sid)
+		}
+	}
+	sort.Slice(n.DisabledSIDs, func(i, j int) bool { return n.DisabledSIDs[i] < n.DisabledSIDs[j] })
+	return n
+}
+
+func hashRuleset(ruleset *firewallv1.IDSRuleset) string {
+	if ruleset == nil {
+		return "none"
+	}
+	data, _ := json.Marshal(ruleset)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func lastLines(s string, n int) string {
+	l := strings.Split(strings.TrimSpace(s), "\n")
+	if len(l) > n {
+		l = l[len(l)-n:]
+	}
+	return strings.Join(l, "\n")
+}
+
+func (m *RuleManager) load() error {
+	if m.stateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(m.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.state)
+}
+
+// persist writes the state, errors are only logged because the ruleset is applied already
+func (m *RuleManager) persist() {
+	if m.stateFile == "" {
+		return
+	}
+	data, err := json.Marshal(m.state)
+	if err != nil {
+		m.log.Error(err, "unable to marshal the state of the ids ruleset")
+		return
+	}
+	if err := helper.WriteFile(m.stateFile, data, 0600); err != nil {
+		m.log.Error(err, "unable to write the state of the ids ruleset", "file", m.stateFile)
+	}
+}
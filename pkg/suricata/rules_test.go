@@ -0,0 +1,191 @@
+package suricata
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+
+	firewallv1 "github.com/metal-stack/firewall-controller/api/v1"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr string
+	}{
+		{
+			name: "valid rules",
+			rules: []string{
+				`alert tcp any any -> $HOME_NET 22 (msg:"ssh to home net"; sid:1000001; rev:1;)`,
+				`drop udp any any -> any 53 (msg:"dns"; content:"sid:1000001;"; sid:1000002;)`,
+			},
+		},
+		{
+			name:    "malformed rule",
+			rules:   []string{`alert tcp any any -> any 22 msg:"ssh"; sid:1000001;`},
+			wantErr: "rule 0 is malformed",
+		},
+		{
+			name:    "rule without signature id",
+			rules:   []string{`alert tcp any any -> any 22 (msg:"ssh"; rev:1;)`},
+			wantErr: "rule 0 has no signature id",
+		},
+		{
+			name: "duplicate signature id",
+			rules: []string{
+				`alert tcp any any -> any 22 (msg:"ssh"; sid:1000001;)`,
+				`alert tcp any any -> any 23 (msg:"telnet"; sid:1000001;)`,
+			},
+			wantErr: "rule 1 has the same signature id 1000001 as rule 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(tt.rules)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMergeRuleset(t *testing.T) {
+	ruleset := &firewallv1.IDSRuleset{Sources: []string{"et/open"}, DisabledSIDs: []int64{1}}
+	err := MergeRuleset(ruleset, map[string]string{
+		"sources":      "oisf/trafficid\n\n# ptresearch/attackdetection\n",
+		"disabledSIDs": "2\n 3 \n",
+		"rules":        `alert tcp any any -> any 22 (msg:"ssh"; sid:1000001;)`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &firewallv1.IDSRuleset{
+		Sources:      []string{"et/open", "oisf/trafficid"},
+		DisabledSIDs: []int64{1, 2, 3},
+		Rules:        []string{`alert tcp any any -> any 22 (msg:"ssh"; sid:1000001;)`},
+	}
+	if !cmp.Equal(ruleset, want) {
+		t.Errorf("MergeRuleset() diff: %v", cmp.Diff(ruleset, want))
+	}
+
+	if err := MergeRuleset(ruleset, map[string]string{"disabledSIDs": "abc"}); err == nil {
+		t.Errorf("expected an error for an invalid signature id")
+	}
+}
+
+func TestRuleManager(t *testing.T) {
+	dir := t.TempDir()
+	commands := []string{}
+	reloads := 0
+	var updateErr error
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newManager := func() *RuleManager {
+		m := NewRuleManager(filepath.Join(dir, "state.json"), logr.Discard())
+		m.localRules = filepath.Join(dir, "local.rules")
+		m.disableConf = filepath.Join(dir, "disable.conf")
+		m.run = func(name string, arg ...string) ([]byte, error) {
+			commands = append(commands, strings.Join(append([]string{name}, arg...), " "))
+			if len(arg) > 0 && arg[0] == "--local" {
+				return []byte("testing ruleset\nfailed"), updateErr
+			}
+			return nil, nil
+		}
+		m.reload = func() error {
+			reloads++
+			return nil
+		}
+		m.stats = func() (int, int, error) {
+			return 42, 1, nil
+		}
+		m.now = func() time.Time {
+			return now
+		}
+		return m
+	}
+	update := fmt.Sprintf("suricata-update --local %s --disable-conf %s", filepath.Join(dir, "local.rules"), filepath.Join(dir, "disable.conf"))
+
+	m := newManager()
+	if err := m.Reconcile(nil); err != nil || len(commands) != 0 || m.Status() != nil {
+		t.Fatalf("expected the image ruleset to be left untouched, got error %v and commands %v", err, commands)
+	}
+
+	ruleset := &firewallv1.IDSRuleset{
+		Sources:      []string{"oisf/trafficid", "et/open", "et/open"},
+		DisabledSIDs: []int64{2, 1},
+		Rules:        []string{`alert tcp any any -> any 22 (msg:"ssh"; sid:1000001;)`},
+	}
+	if err := m.Reconcile(ruleset); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"suricata-update enable-source et/open", "suricata-update enable-source oisf/trafficid", update}
+	if !cmp.Equal(commands, want) || reloads != 1 {
+		t.Errorf("unexpected commands %v and %d reloads", commands, reloads)
+	}
+	disabled, _ := ioutil.ReadFile(filepath.Join(dir, "disable.conf"))
+	if string(disabled) != "# managed by the firewall-controller\n1\n2\n" {
+		t.Errorf("unexpected disable.conf: %q", disabled)
+	}
+	if status := m.Status(); status == nil || status.Loaded != 42 || status.Failed != 1 || status.LastReload == nil || status.Error != "" {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	// an unchanged ruleset is not applied again, also not after a restart
+	commands = nil
+	m = newManager()
+	if err := m.Reconcile(ruleset); err != nil || len(commands) != 0 {
+		t.Errorf("expected no commands for an unchanged ruleset, got error %v and commands %v", err, commands)
+	}
+
+	// a failed update is reported and retried with backoff
+	updateErr = fmt.Errorf("exit status 1")
+	ruleset.Sources = []string{"et/open"}
+	if err := m.Reconcile(ruleset); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("expected the output of the failed update, got %v", err)
+	}
+	want = []string{"suricata-update disable-source oisf/trafficid", update}
+	if !cmp.Equal(commands, want) || reloads != 1 {
+		t.Errorf("unexpected commands %v and %d reloads", commands, reloads)
+	}
+	if status := m.Status(); status == nil || status.Error == "" {
+		t.Errorf("expected the error in the status, got %v", status)
+	}
+	commands = nil
+	if err := m.Reconcile(ruleset); err == nil || len(commands) != 0 {
+		t.Errorf("expected the cached error without commands, got %v and commands %v", err, commands)
+	}
+	now = now.Add(minRetryInterval)
+	if err := m.Reconcile(ruleset); err == nil || !cmp.Equal(commands, want) {
+		t.Errorf("expected a retry after the backoff, got %v and commands %v", err, commands)
+	}
+	commands = nil
+	now = now.Add(minRetryInterval)
+	if err := m.Reconcile(ruleset); err == nil || len(commands) != 0 {
+		t.Errorf("expected the doubled backoff, got %v and commands %v", err, commands)
+	}
+
+	// invalid rules are not written
+	ruleset.Rules = []string{"invalid"}
+	if err := m.Reconcile(ruleset); err == nil || len(commands) != 0 {
+		t.Errorf("expected a validation error without commands, got %v and commands %v", err, commands)
+	}
+
+	// removing the ruleset restores the rules of the image
+	updateErr = nil
+	if err := m.Reconcile(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []string{"suricata-update disable-source et/open", "suricata-update disable-source oisf/trafficid", update}
+	if !cmp.Equal(commands, want) || reloads != 2 || m.Status() != nil {
+		t.Errorf("unexpected commands %v and %d reloads", commands, reloads)
+	}
+}
@@ -25,6 +25,11 @@ func New() Suricata {
 	return Suricata{socket: defaultSocket}
 }
 
+// newIPS returns the suricata instance which inspects the connections of the NFQUEUE inline
+func newIPS() Suricata {
+	return Suricata{socket: ipsSocket}
+}
+
 func (s *Suricata) InterfaceStats() (*InterfaceStats, error) {
 	suricata, err := client.CreateSocket(s.socket)
 	if err != nil {
@@ -51,3 +56,35 @@ func (s *Suricata) InterfaceStats() (*InterfaceStats, error) {
 
 	return &result, nil
 }
+
+// ReloadRules reloads the ruleset
+func (s *Suricata) ReloadRules() error {
+	suricata, err := client.CreateSocket(s.socket)
+	if err != nil {
+		return err
+	}
+	defer suricata.Close()
+
+	_, err = suricata.ReloadRulesCommand(context.Background())
+	return err
+}
+
+// RulesetStats returns the number of rules which were loaded and which failed to load
+func (s *Suricata) RulesetStats() (int, int, error) {
+	suricata, err := client.CreateSocket(s.socket)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer suricata.Close()
+
+	stats, err := suricata.RulesetStatsCommand(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+	loaded, failed := 0, 0
+	for _, stat := range stats {
+		loaded += stat.RulesLoaded
+		failed += stat.RulesFailed
+	}
+	return loaded, failed, nil
+}